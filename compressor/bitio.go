@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io"
+)
+
+// bitWriter packs bits into bytes, least significant bit first
+type bitWriter struct {
+	w     io.Writer
+	buf   []byte
+	bits  uint64
+	nbits uint
+	err   error
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{w: w, buf: make([]byte, 0, 4096)}
+}
+
+// writeBits writes the n low bits of value, n is at most 32
+func (bw *bitWriter) writeBits(value uint64, n uint) {
+	bw.bits |= value << bw.nbits
+	bw.nbits += n
+
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits >>= 8
+		bw.nbits -= 8
+	}
+
+	if len(bw.buf) == cap(bw.buf) {
+		bw.writeBuffer()
+	}
+}
+
+// alignToByte pads the partial byte with zero bits
+func (bw *bitWriter) alignToByte() {
+	if bw.nbits > 0 {
+		bw.writeBits(0, 8-bw.nbits)
+	}
+}
+
+// writeBytes writes p as is, the writer must be aligned to a byte
+func (bw *bitWriter) writeBytes(p []byte) {
+	for len(p) > 0 {
+		n := copy(bw.buf[len(bw.buf):cap(bw.buf)], p)
+		bw.buf = bw.buf[:len(bw.buf)+n]
+		p = p[n:]
+
+		if len(bw.buf) == cap(bw.buf) {
+			bw.writeBuffer()
+		}
+	}
+}
+
+// flush writes the buffered bytes and the last partial byte, padded with
+// zero bits
+func (bw *bitWriter) flush() error {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits, bw.nbits = 0, 0
+	}
+
+	bw.writeBuffer()
+	return bw.err
+}
+
+func (bw *bitWriter) writeBuffer() {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(bw.buf)
+	}
+	bw.buf = bw.buf[:0]
+}
+
+// bitReader reads bits written by bitWriter
+type bitReader struct {
+	r     io.ByteReader
+	bits  uint64
+	nbits uint
+	err   error
+}
+
+func newBitReader(r io.ByteReader) *bitReader {
+	return &bitReader{r: r}
+}
+
+// fill tries to buffer at least n bits, n is at most 56. It returns how
+// many bits are buffered, less than n only at the end of the input
+func (br *bitReader) fill(n uint) uint {
+	for br.nbits < n && br.err == nil {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			br.err = err
+			break
+		}
+
+		br.bits |= uint64(b) << br.nbits
+		br.nbits += 8
+	}
+	return br.nbits
+}
+
+// consume drops n buffered bits
+func (br *bitReader) consume(n uint) {
+	br.bits >>= n
+	br.nbits -= n
+}
+
+// alignToByte drops the bits left in the current byte
+func (br *bitReader) alignToByte() {
+	br.consume(br.nbits % 8)
+}
+
+// readBits reads n bits, n is at most 32. The input ending in the middle
+// is reported as io.ErrUnexpectedEOF
+func (br *bitReader) readBits(n uint) (uint64, error) {
+	if br.fill(n) < n {
+		if br.err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, br.err
+	}
+
+	value := br.bits & (1<<n - 1)
+	br.consume(n)
+	return value, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// Chunked files split the input in blocks of the same size compressed on
+// their own, so they can be compressed, decompressed and read in parallel:
+//
+//	header  "CHK" followed by the format version and the block size as a
+//	        uvarint
+//	blocks  one raw DEFLATE stream per block, each with its own codes
+//	index   uvarint number of blocks then, for every block, its compressed
+//	        length and its length as uvarints and the CRC-32 of its data
+//	footer  offset of the index, 8 bytes little endian
+//
+// A block is at most MaxBlockSize bytes, larger ones are refused as the
+// readers keep a whole block in memory
+const (
+	chunkedMagic     = "CHK"
+	chunkedVersion   = 1
+	chunkedFooter    = 8
+	DefaultBlockSize = 1 << 20
+	MaxBlockSize     = 1 << 30
+)
+
+// maxDeflateRatio is the most DEFLATE can expand, a 258 bytes match takes
+// at least 2 bits
+const maxDeflateRatio = 1032
+
+// chunk describes a block of a chunked file
+type chunk struct {
+	offset     int64 // of the compressed block in the file
+	compressed int64
+	start      int64 // of the block in the decompressed data
+	size       int64
+	crc        uint32
+}
+
+// compressedBlock is a block once compressed by a worker
+type compressedBlock struct {
+	data []byte
+	size int
+	crc  uint32
+}
+
+// compressChunked reads r in blocks of blockSize bytes and compresses them
+// on workers goroutines
+func compressChunked(r io.Reader, w io.Writer, level, blockSize, workers int) error {
+	if _, err := newDeflater(io.Discard, level); err != nil {
+		return err
+	}
+	if blockSize <= 0 || blockSize > MaxBlockSize {
+		return fmt.Errorf("invalid block size %d, must be between 1 and %d", blockSize, MaxBlockSize)
+	}
+
+	header := append([]byte(chunkedMagic), chunkedVersion)
+	header = binary.AppendUvarint(header, uint64(blockSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	offset := int64(len(header))
+
+	index := []chunk{}
+	done := false
+	next := func() (func() (compressedBlock, error), error) {
+		if done {
+			return nil, nil
+		}
+
+		block := make([]byte, blockSize)
+		n, err := io.ReadFull(r, block)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			done = true
+		} else if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+
+		return func() (compressedBlock, error) {
+			var buf bytes.Buffer
+			err := deflate(block[:n], &buf, level)
+			return compressedBlock{buf.Bytes(), n, crc32.ChecksumIEEE(block[:n])}, err
+		}, nil
+	}
+
+	emit := func(b compressedBlock) error {
+		if _, err := w.Write(b.data); err != nil {
+			return err
+		}
+		index = append(index, chunk{compressed: int64(len(b.data)), size: int64(b.size), crc: b.crc})
+		offset += int64(len(b.data))
+		return nil
+	}
+
+	if err := ordered(workers, next, emit); err != nil {
+		return err
+	}
+
+	trailer := binary.AppendUvarint(nil, uint64(len(index)))
+	for _, c := range index {
+		trailer = binary.AppendUvarint(trailer, uint64(c.compressed))
+		trailer = binary.AppendUvarint(trailer, uint64(c.size))
+		trailer = binary.LittleEndian.AppendUint32(trailer, c.crc)
+	}
+	trailer = binary.LittleEndian.AppendUint64(trailer, uint64(offset))
+	_, err := w.Write(trailer)
+	return err
+}
+
+// ordered runs the tasks returned by next on up to workers goroutines and
+// hands their results to emit in the order of the tasks. next returns a
+// nil task when there are none left
+func ordered[T any](workers int, next func() (func() (T, error), error), emit func(T) error) error {
+	type result struct {
+		value T
+		err   error
+	}
+
+	queue := make(chan chan result, max(workers, 1))
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer close(queue)
+		for {
+			task, err := next()
+			if task == nil && err == nil {
+				return
+			}
+
+			ch := make(chan result, 1)
+			select {
+			case queue <- ch:
+			case <-stop:
+				return
+			}
+
+			if err != nil {
+				ch <- result{err: err}
+				return
+			}
+			go func() {
+				value, err := task()
+				ch <- result{value, err}
+			}()
+		}
+	}()
+
+	for ch := range queue {
+		res := <-ch
+		if res.err != nil {
+			return res.err
+		}
+		if err := emit(res.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkedFile reads a chunked file through its index
+type chunkedFile struct {
+	r      io.ReaderAt
+	blocks []chunk
+	size   int64
+}
+
+func openChunked(r io.ReaderAt, size int64) (*chunkedFile, error) {
+	header := make([]byte, len(chunkedMagic)+1+binary.MaxVarintLen64)
+	n, err := r.ReadAt(header, 0)
+	header = header[:n]
+	if n < len(chunkedMagic)+1 || string(header[:len(chunkedMagic)]) != chunkedMagic {
+		return nil, ErrFormat
+	}
+	if header[len(chunkedMagic)] != chunkedVersion {
+		return nil, ErrVersion
+	}
+	blockSize, used := binary.Uvarint(header[len(chunkedMagic)+1:])
+	if used <= 0 || blockSize == 0 || blockSize > MaxBlockSize {
+		return nil, ErrCorrupt
+	}
+	headerSize := int64(len(chunkedMagic) + 1 + used)
+	if headerSize > size-chunkedFooter {
+		return nil, ErrCorrupt
+	}
+
+	footer := make([]byte, chunkedFooter)
+	if _, err := r.ReadAt(footer, size-chunkedFooter); err != nil {
+		return nil, ErrCorrupt
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(footer))
+	if indexOffset < headerSize || indexOffset > size-chunkedFooter {
+		return nil, ErrCorrupt
+	}
+
+	index := bufio.NewReader(io.NewSectionReader(r, indexOffset, size-chunkedFooter-indexOffset))
+	count, err := binary.ReadUvarint(index)
+	if err != nil || count > uint64(indexOffset) {
+		return nil, ErrCorrupt
+	}
+
+	f := &chunkedFile{r: r, blocks: make([]chunk, 0, count)}
+	offset := headerSize
+	for i := uint64(0); i < count; i++ {
+		compressed, err1 := binary.ReadUvarint(index)
+		length, err2 := binary.ReadUvarint(index)
+		var crc [4]byte
+		_, err3 := io.ReadFull(index, crc[:])
+		if err1 != nil || err2 != nil || err3 != nil || length > blockSize {
+			return nil, ErrCorrupt
+		}
+
+		c := chunk{offset, int64(compressed), f.size, int64(length), binary.LittleEndian.Uint32(crc[:])}
+		offset += c.compressed
+		f.size += c.size
+		if offset > indexOffset {
+			return nil, ErrCorrupt
+		}
+		f.blocks = append(f.blocks, c)
+	}
+
+	if offset != indexOffset {
+		return nil, ErrCorrupt
+	}
+	return f, nil
+}
+
+// Size is the length of the decompressed data
+func (f *chunkedFile) Size() int64 {
+	return f.size
+}
+
+// block decompresses a block and checks it against the index
+func (f *chunkedFile) block(i int) ([]byte, error) {
+	c := f.blocks[i]
+	var out bytes.Buffer
+	// the size comes from the file, it is not trusted beyond what the
+	// compressed block can hold
+	out.Grow(int(min(c.size, c.compressed*maxDeflateRatio)))
+	if err := inflate(io.NewSectionReader(f.r, c.offset, c.compressed), &out); err != nil {
+		return nil, err
+	}
+
+	if int64(out.Len()) != c.size || crc32.ChecksumIEEE(out.Bytes()) != c.crc {
+		return nil, ErrChecksum
+	}
+	return out.Bytes(), nil
+}
+
+// ReadAt decompresses only the blocks holding the bytes asked for
+func (f *chunkedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	i := sort.Search(len(f.blocks), func(i int) bool {
+		return f.blocks[i].start+f.blocks[i].size > off
+	})
+
+	n := 0
+	for ; n < len(p) && i < len(f.blocks); i++ {
+		data, err := f.block(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[off+int64(n)-f.blocks[i].start:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// decompressTo decompresses the blocks on workers goroutines
+func (f *chunkedFile) decompressTo(w io.Writer, workers int) (int64, error) {
+	i := 0
+	next := func() (func() ([]byte, error), error) {
+		if i == len(f.blocks) {
+			return nil, nil
+		}
+
+		block := i
+		i++
+		return func() ([]byte, error) {
+			return f.block(block)
+		}, nil
+	}
+
+	written := int64(0)
+	err := ordered(workers, next, func(data []byte) error {
+		n, err := w.Write(data)
+		written += int64(n)
+		return err
+	})
+	return written, err
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+func compressChunkedBytes(t testing.TB, data []byte, blockSize, workers int) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := compressChunked(bytes.NewReader(data), &out, DefaultCompression, blockSize, workers); err != nil {
+		t.Fatalf("Error compressing: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	text := benchmarkCorpus()[:1<<20]
+	tests := map[string]struct {
+		data      []byte
+		blockSize int
+	}{
+		"empty":         {[]byte{}, 1024},
+		"single block":  {text[:1000], 1024},
+		"exact blocks":  {text[:64<<10], 16 << 10},
+		"partial block": {text[:100000], 16 << 10},
+		"large":         {text, 128 << 10},
+	}
+
+	for name, test := range tests {
+		var reference []byte
+		for _, workers := range []int{1, 4, 16} {
+			compressed := compressChunkedBytes(t, test.data, test.blockSize, workers)
+			if reference == nil {
+				reference = compressed
+			} else if !bytes.Equal(compressed, reference) {
+				t.Errorf("%s: the output depends on the number of workers", name)
+			}
+
+			f, err := openChunked(bytes.NewReader(compressed), int64(len(compressed)))
+			if err != nil {
+				t.Fatalf("Error opening %s: %v", name, err)
+			}
+			if f.Size() != int64(len(test.data)) {
+				t.Errorf("%s: expected size %d, got %d", name, len(test.data), f.Size())
+			}
+
+			var out bytes.Buffer
+			if _, err := f.decompressTo(&out, workers); err != nil {
+				t.Fatalf("Error decompressing %s: %v", name, err)
+			}
+			if !bytes.Equal(out.Bytes(), test.data) {
+				t.Errorf("%s with %d workers: round trip changed the data", name, workers)
+			}
+		}
+	}
+}
+
+// countingReaderAt counts the bytes read from the compressed file
+type countingReaderAt struct {
+	r    io.ReaderAt
+	read int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += int64(n)
+	return n, err
+}
+
+func TestChunkedReadAt(t *testing.T) {
+	data := benchmarkCorpus()[:1<<20]
+	compressed := compressChunkedBytes(t, data, 64<<10, 4)
+
+	counter := &countingReaderAt{r: bytes.NewReader(compressed)}
+	f, err := openChunked(counter, int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 50; i++ {
+		off := rng.Int63n(int64(len(data)))
+		p := make([]byte, rng.Intn(200000))
+		n, err := f.ReadAt(p, off)
+
+		want := data[off:min(off+int64(len(p)), int64(len(data)))]
+		if n != len(want) || !bytes.Equal(p[:n], want) {
+			t.Fatalf("ReadAt(%d bytes, %d): got %d bytes that differ", len(p), off, n)
+		}
+		if n < len(p) && err != io.EOF {
+			t.Errorf("ReadAt past the end: expected io.EOF, got %v", err)
+		}
+		if n == len(p) && err != nil {
+			t.Errorf("Error reading at %d: %v", off, err)
+		}
+	}
+
+	// the last bytes only need the last block
+	counter.read = 0
+	p := make([]byte, 10)
+	if _, err := f.ReadAt(p, int64(len(data)-10)); err != nil {
+		t.Fatal(err)
+	}
+	last := f.blocks[len(f.blocks)-1]
+	if counter.read > last.compressed {
+		t.Errorf("expected to read at most %d compressed bytes, read %d", last.compressed, counter.read)
+	}
+
+	if _, err := f.ReadAt(p, int64(len(data))); err != io.EOF {
+		t.Errorf("expected io.EOF at the end, got %v", err)
+	}
+}
+
+func TestChunkedErrors(t *testing.T) {
+	data := benchmarkCorpus()[:100000]
+	compressed := compressChunkedBytes(t, data, 16<<10, 2)
+
+	f, err := openChunked(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := f.blocks[1]
+
+	badFooter := bytes.Clone(compressed)
+	badFooter[len(badFooter)-2] = 0xff
+
+	tests := []struct {
+		name  string
+		input []byte
+		err   error
+	}{
+		{"empty", []byte{}, ErrFormat},
+		{"bad magic", []byte("HUF\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"), ErrFormat},
+		{"bad version", append([]byte(chunkedMagic), 9, 0, 0, 0, 0, 0, 0, 0, 0, 0), ErrVersion},
+		{"truncated", compressed[:len(compressed)-3], ErrCorrupt},
+		{"bad footer", badFooter, ErrCorrupt},
+	}
+	for _, test := range tests {
+		_, err := openChunked(bytes.NewReader(test.input), int64(len(test.input)))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	// a damaged block is reported, the others can still be read
+	damaged := bytes.Clone(compressed)
+	damaged[second.offset+second.compressed/2] ^= 0x10
+	f, err = openChunked(bytes.NewReader(damaged), int64(len(damaged)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.decompressTo(io.Discard, 4); !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected a damaged block to be reported, got %v", err)
+	}
+	p := make([]byte, 1000)
+	if _, err := f.ReadAt(p, 0); err != nil || !bytes.Equal(p, data[:1000]) {
+		t.Errorf("expected the first block to be readable: %v", err)
+	}
+}
+
+// craftChunked builds a chunked file with a single block, declaring
+// blockSize and length whatever the compressed data holds
+func craftChunked(blockSize, length uint64, compressed []byte) []byte {
+	file := append([]byte(chunkedMagic), chunkedVersion)
+	file = binary.AppendUvarint(file, blockSize)
+	file = append(file, compressed...)
+	indexOffset := len(file)
+	file = binary.AppendUvarint(file, 1)
+	file = binary.AppendUvarint(file, uint64(len(compressed)))
+	file = binary.AppendUvarint(file, length)
+	file = binary.LittleEndian.AppendUint32(file, 0)
+	return binary.LittleEndian.AppendUint64(file, uint64(indexOffset))
+}
+
+func TestChunkedCraftedSizes(t *testing.T) {
+	var block bytes.Buffer
+	if err := deflate([]byte("hello"), &block, DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blockSize := range []uint64{0, MaxBlockSize + 1, 1 << 60} {
+		input := craftChunked(blockSize, blockSize, block.Bytes())
+		if _, err := openChunked(bytes.NewReader(input), int64(len(input))); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("block size %d: expected ErrCorrupt, got %v", blockSize, err)
+		}
+	}
+
+	// a block declaring the largest size is not allocated up front
+	input := craftChunked(MaxBlockSize, MaxBlockSize, block.Bytes())
+	f, err := openChunked(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("Error opening: %v", err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := f.ReadAt(make([]byte, 10), 0); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected a small allocation, got %d bytes", allocated)
+	}
+
+	if err := compressChunked(bytes.NewReader(nil), io.Discard, DefaultCompression, MaxBlockSize+1, 1); err == nil {
+		t.Error("expected an error for a block size above MaxBlockSize")
+	}
+}
+
+func FuzzChunked(f *testing.F) {
+	f.Add(compressChunkedBytes(f, []byte{}, 1024, 1))
+	f.Add(compressChunkedBytes(f, []byte("hello, hello, hello world"), 8, 1))
+	f.Add(compressChunkedBytes(f, benchmarkCorpus()[:5000], 1024, 1))
+	f.Add(craftChunked(1<<60, 1<<60, []byte{0x03, 0x00}))
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		c, err := openChunked(bytes.NewReader(input), int64(len(input)))
+		if err != nil {
+			return
+		}
+
+		p := make([]byte, 4096)
+		for _, off := range []int64{0, c.Size() / 2, c.Size() - 1} {
+			if off >= 0 {
+				c.ReadAt(p, off)
+			}
+		}
+		c.decompressTo(io.Discard, 2)
+	})
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestChunkedReadError(t *testing.T) {
+	r := io.MultiReader(bytes.NewReader(benchmarkCorpus()[:50000]), failingReader{})
+	err := compressChunked(r, io.Discard, DefaultCompression, 4096, 4)
+	if err == nil || err.Error() != "read failed" {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
+
+func BenchmarkChunked(b *testing.B) {
+	data := benchmarkCorpus()[:32<<20]
+	compressed := compressChunkedBytes(b, data, DefaultBlockSize, 8)
+
+	b.Run("compress", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			compressChunked(bytes.NewReader(data), io.Discard, DefaultCompression, DefaultBlockSize, 8)
+		}
+	})
+
+	b.Run("decompress", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			f, _ := openChunked(bytes.NewReader(compressed), int64(len(compressed)))
+			f.decompressTo(io.Discard, 8)
+		}
+	})
+}
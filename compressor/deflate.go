@@ -0,0 +1,655 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Sizes of RFC 1951
+const (
+	windowSize     = 1 << 15
+	windowMask     = windowSize - 1
+	minMatchLength = 3
+	maxMatchLength = 258
+	maxStoredBlock = 65535
+	endOfBlock     = 256
+	numLitLen      = 286
+	numDist        = 30
+	numCodeLength  = 19
+)
+
+const (
+	hashBits       = 15
+	hashSize       = 1 << hashBits
+	maxBlockTokens = 1 << 14
+	// a match of 3 bytes this far away costs more than the literals
+	tooFar = 4096
+)
+
+const (
+	NoCompression      = 0
+	BestSpeed          = 1
+	DefaultCompression = 6
+	BestCompression    = 9
+)
+
+var (
+	lengthBase = [29]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase = [30]int{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra = [30]uint{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+	// order in which the code length code lengths are written
+	codeLengthOrder = [numCodeLength]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+	lengthCodes [maxMatchLength + 1]uint8
+
+	fixedLitLengths  = make([]uint8, 288)
+	fixedDistLengths = make([]uint8, numDist)
+)
+
+func init() {
+	for code, base := range lengthBase {
+		for length := base; length < base+1<<lengthExtra[code] && length <= maxMatchLength; length++ {
+			lengthCodes[length] = uint8(code)
+		}
+	}
+	// 258 has its own code instead of being 227 + 31
+	lengthCodes[maxMatchLength] = 28
+
+	for i := range fixedLitLengths {
+		switch {
+		case i < 144:
+			fixedLitLengths[i] = 8
+		case i < 256:
+			fixedLitLengths[i] = 9
+		case i < 280:
+			fixedLitLengths[i] = 7
+		default:
+			fixedLitLengths[i] = 8
+		}
+	}
+	for i := range fixedDistLengths {
+		fixedDistLengths[i] = 5
+	}
+}
+
+func distCode(dist int) int {
+	d := uint32(dist - 1)
+	if d < 4 {
+		return int(d)
+	}
+	n := bits.Len32(d)
+	return 2*(n-1) + int(d>>(n-2)&1)
+}
+
+// levelConfig tunes the match finder like zlib does
+type levelConfig struct {
+	good  int // the chain is cut when the previous match is this long
+	lazy  int // a match shorter than this is compared with the next one, 0 is greedy
+	nice  int // the search stops at a match this long
+	chain int // how many candidates of the hash chain are tried
+}
+
+var levels = [...]levelConfig{
+	0: {},
+	1: {4, 0, 8, 4},
+	2: {4, 0, 16, 8},
+	3: {4, 0, 32, 32},
+	4: {4, 4, 16, 16},
+	5: {8, 16, 32, 32},
+	6: {8, 16, 128, 128},
+	7: {8, 32, 128, 256},
+	8: {32, 128, 258, 1024},
+	9: {32, 258, 258, 4096},
+}
+
+// token is a literal byte or, with matchFlag set, a match with its length
+// minus 3 in bits 16-23 and its distance minus 1 in the low bits
+type token uint32
+
+const matchFlag token = 1 << 31
+
+func literalToken(b byte) token {
+	return token(b)
+}
+
+func matchToken(length, dist int) token {
+	return matchFlag | token(length-minMatchLength)<<16 | token(dist-1)
+}
+
+func (t token) isMatch() bool {
+	return t&matchFlag != 0
+}
+
+func (t token) length() int {
+	return int(t>>16&0xff) + minMatchLength
+}
+
+func (t token) dist() int {
+	return int(t&0xffff) + 1
+}
+
+// deflater writes a raw DEFLATE stream. The window holds the last 32 KiB
+// already compressed followed by the data waiting to be compressed
+type deflater struct {
+	bw     *bitWriter
+	level  int
+	config levelConfig
+
+	win        []byte
+	pos        int // next byte to look at
+	tokenEnd   int // end of the bytes covered by the tokens
+	blockStart int // first byte of the current block
+	head       []int32
+	prev       []int32
+	tokens     []token
+
+	// lazy matching, a match starting at pos-1 waits to be compared with
+	// the one at pos
+	pending    bool
+	prevLength int
+	prevDist   int
+}
+
+func newDeflater(w io.Writer, level int) (*deflater, error) {
+	if level < NoCompression || level > BestCompression {
+		return nil, fmt.Errorf("invalid compression level %d", level)
+	}
+
+	d := &deflater{
+		bw:     newBitWriter(w),
+		level:  level,
+		config: levels[level],
+		win:    make([]byte, 0, 2*windowSize),
+		tokens: make([]token, 0, maxBlockTokens),
+	}
+
+	if level > NoCompression {
+		d.head = make([]int32, hashSize)
+		d.prev = make([]int32, windowSize)
+		for i := range d.head {
+			d.head[i] = -1
+		}
+	}
+	return d, nil
+}
+
+// deflate compresses data into a raw DEFLATE stream
+func deflate(data []byte, w io.Writer, level int) error {
+	d, err := newDeflater(w, level)
+	if err != nil {
+		return err
+	}
+
+	if err := d.write(data); err != nil {
+		return err
+	}
+	return d.close()
+}
+
+func (d *deflater) write(p []byte) error {
+	for len(p) > 0 {
+		if len(d.win) == cap(d.win) {
+			d.compress(false)
+			d.slide()
+		}
+
+		n := copy(d.win[len(d.win):cap(d.win)], p)
+		d.win = d.win[:len(d.win)+n]
+		p = p[n:]
+	}
+	return d.bw.err
+}
+
+// flush compresses everything written so far and ends the block on a byte
+// boundary with an empty stored block, so a reader gets all the data
+func (d *deflater) flush() error {
+	d.compress(true)
+	if len(d.tokens) > 0 || d.tokenEnd > d.blockStart {
+		d.writeBlock(false)
+	}
+
+	writeStoredBlocks(d.bw, nil, false)
+	return d.bw.flush()
+}
+
+// close compresses what is left and writes the final block
+func (d *deflater) close() error {
+	d.compress(true)
+	d.writeBlock(true)
+	return d.bw.flush()
+}
+
+// slide drops the oldest half of the window
+func (d *deflater) slide() {
+	if d.blockStart < windowSize {
+		d.writeBlock(false)
+	}
+
+	copy(d.win, d.win[windowSize:])
+	d.win = d.win[:len(d.win)-windowSize]
+	d.pos -= windowSize
+	d.tokenEnd -= windowSize
+	d.blockStart -= windowSize
+
+	for _, table := range [][]int32{d.head, d.prev} {
+		for i, v := range table {
+			table[i] = max(v-windowSize, -1)
+		}
+	}
+}
+
+// compress turns the window into tokens. Unless final, enough lookahead
+// is kept for the longest match
+func (d *deflater) compress(final bool) {
+	end := len(d.win)
+
+	if d.level == NoCompression {
+		d.pos, d.tokenEnd = end, end
+		return
+	}
+
+	limit := end
+	if !final {
+		limit = end - maxMatchLength - minMatchLength
+	}
+
+	for d.pos < limit {
+		length, dist := 0, 0
+		if d.pos+minMatchLength <= end {
+			candidate := d.insertHash(d.pos)
+			if d.config.lazy == 0 || d.prevLength < d.config.lazy {
+				length, dist = d.findMatch(d.pos, candidate, end)
+			}
+		}
+
+		if d.config.lazy == 0 {
+			if length >= minMatchLength {
+				d.emit(matchToken(length, dist), length)
+				d.insertHashes(d.pos+1, d.pos+length, end)
+				d.pos += length
+			} else {
+				d.emit(literalToken(d.win[d.pos]), 1)
+				d.pos++
+			}
+			continue
+		}
+
+		if d.pending && d.prevLength >= minMatchLength && length <= d.prevLength {
+			// the match at pos-1 is better, pos is already hashed
+			matchEnd := d.pos - 1 + d.prevLength
+			d.emit(matchToken(d.prevLength, d.prevDist), d.prevLength)
+			d.insertHashes(d.pos+1, matchEnd, end)
+			d.pos = matchEnd
+			d.pending = false
+			d.prevLength = 0
+			continue
+		}
+
+		if d.pending {
+			d.emit(literalToken(d.win[d.pos-1]), 1)
+		}
+		d.pending = true
+		d.prevLength, d.prevDist = length, dist
+		d.pos++
+	}
+
+	if final && d.pending {
+		d.emit(literalToken(d.win[d.pos-1]), 1)
+		d.pending = false
+		d.prevLength = 0
+	}
+}
+
+func (d *deflater) emit(t token, size int) {
+	d.tokens = append(d.tokens, t)
+	d.tokenEnd += size
+
+	if len(d.tokens) == maxBlockTokens {
+		d.writeBlock(false)
+	}
+}
+
+func hash3(b []byte) uint32 {
+	return (uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) * 0x9e3779b1 >> (32 - hashBits)
+}
+
+// insertHash adds pos to its hash chain and returns the previous head
+func (d *deflater) insertHash(pos int) int32 {
+	h := hash3(d.win[pos:])
+	candidate := d.head[h]
+	d.prev[pos&windowMask] = candidate
+	d.head[h] = int32(pos)
+	return candidate
+}
+
+func (d *deflater) insertHashes(from, to, end int) {
+	for pos := from; pos < to && pos+minMatchLength <= end; pos++ {
+		d.insertHash(pos)
+	}
+}
+
+// findMatch walks the hash chain from candidate and returns the longest
+// match better than the pending one
+func (d *deflater) findMatch(pos int, candidate int32, end int) (int, int) {
+	maxLength := min(maxMatchLength, end-pos)
+	nice := min(d.config.nice, maxLength)
+
+	chain := d.config.chain
+	if d.pending && d.prevLength >= d.config.good {
+		chain >>= 2
+	}
+
+	bestLength, bestDist := minMatchLength-1, 0
+	if d.pending {
+		bestLength = max(bestLength, d.prevLength)
+	}
+	if bestLength >= maxLength {
+		return 0, 0
+	}
+
+	current := d.win[pos : pos+maxLength]
+	for ; chain > 0 && candidate >= 0; chain-- {
+		c := int(candidate)
+		if c >= pos || pos-c > windowSize {
+			break
+		}
+
+		if d.win[c+bestLength] == current[bestLength] {
+			length := matchLength(d.win[c:], current)
+			if length > bestLength {
+				bestLength, bestDist = length, pos-c
+				if length >= nice {
+					break
+				}
+			}
+		}
+
+		next := d.prev[c&windowMask]
+		if next >= candidate {
+			break
+		}
+		candidate = next
+	}
+
+	if bestDist == 0 || (bestLength == minMatchLength && bestDist > tooFar) {
+		return 0, 0
+	}
+	return bestLength, bestDist
+}
+
+// matchLength compares 8 bytes at a time while it can
+func matchLength(a, b []byte) int {
+	n := 0
+	for ; n+8 <= len(b) && n+8 <= len(a); n += 8 {
+		if diff := binary.LittleEndian.Uint64(a[n:]) ^ binary.LittleEndian.Uint64(b[n:]); diff != 0 {
+			return n + bits.TrailingZeros64(diff)/8
+		}
+	}
+	for n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func (d *deflater) writeBlock(final bool) {
+	raw := d.win[d.blockStart:d.tokenEnd]
+	writeBlock(d.bw, d.tokens, raw, final, d.level == NoCompression)
+	d.tokens = d.tokens[:0]
+	d.blockStart = d.tokenEnd
+}
+
+// writeBlock writes the tokens as the smallest of a stored, fixed or
+// dynamic Huffman block. raw holds the bytes the tokens stand for
+func writeBlock(bw *bitWriter, tokens []token, raw []byte, final, storedOnly bool) {
+	if storedOnly {
+		writeStoredBlocks(bw, raw, final)
+		return
+	}
+
+	litFreq := make([]int, numLitLen)
+	distFreq := make([]int, numDist)
+	for _, t := range tokens {
+		if t.isMatch() {
+			litFreq[257+int(lengthCodes[t.length()])]++
+			distFreq[distCode(t.dist())]++
+		} else {
+			litFreq[t]++
+		}
+	}
+	litFreq[endOfBlock]++
+
+	litLengths := buildCodeLengths(litFreq, maxCodeLength)
+	distLengths := buildCodeLengths(distFreq, maxCodeLength)
+	if !hasCode(distLengths) {
+		// a block without matches still declares one distance code
+		distLengths[0] = 1
+	}
+
+	header := newDynamicHeader(litLengths, distLengths)
+	dynamicBits := header.bits() + dataBits(litFreq, distFreq, litLengths, distLengths)
+	fixedBits := 3 + dataBits(litFreq, distFreq, fixedLitLengths, fixedDistLengths)
+	storedBits := storedSize(len(raw))
+
+	switch {
+	case storedBits <= min(dynamicBits, fixedBits):
+		writeStoredBlocks(bw, raw, final)
+	case fixedBits <= dynamicBits:
+		writeBlockHeader(bw, final, 1)
+		writeTokens(bw, tokens, canonicalCodes(fixedLitLengths), canonicalCodes(fixedDistLengths))
+	default:
+		writeBlockHeader(bw, final, 2)
+		header.write(bw)
+		writeTokens(bw, tokens, canonicalCodes(litLengths), canonicalCodes(distLengths))
+	}
+}
+
+func hasCode(lengths []uint8) bool {
+	for _, length := range lengths {
+		if length > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func writeBlockHeader(bw *bitWriter, final bool, blockType uint64) {
+	if final {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(blockType, 2)
+}
+
+// dataBits is the size of the tokens and the end of block with the codes
+func dataBits(litFreq, distFreq []int, litLengths, distLengths []uint8) int {
+	size := 0
+	for symbol, f := range litFreq {
+		size += f * int(litLengths[symbol])
+		if symbol > endOfBlock {
+			size += f * int(lengthExtra[symbol-257])
+		}
+	}
+	for symbol, f := range distFreq {
+		size += f * (int(distLengths[symbol]) + int(distExtra[symbol]))
+	}
+	return size
+}
+
+// storedSize counts the worst case alignment of every stored block
+func storedSize(n int) int {
+	blocks := max(1, (n+maxStoredBlock-1)/maxStoredBlock)
+	return blocks*(3+7+32) + 8*n
+}
+
+func writeStoredBlocks(bw *bitWriter, raw []byte, final bool) {
+	for {
+		n := min(len(raw), maxStoredBlock)
+		last := n == len(raw)
+
+		writeBlockHeader(bw, final && last, 0)
+		bw.alignToByte()
+		bw.writeBits(uint64(n), 16)
+		bw.writeBits(uint64(^uint16(n)), 16)
+		bw.writeBytes(raw[:n])
+
+		raw = raw[n:]
+		if last {
+			return
+		}
+	}
+}
+
+func writeTokens(bw *bitWriter, tokens []token, litCodes, distCodes []code) {
+	for _, t := range tokens {
+		if !t.isMatch() {
+			c := litCodes[t]
+			bw.writeBits(uint64(c.bits), uint(c.length))
+			continue
+		}
+
+		length, dist := t.length(), t.dist()
+		lc := int(lengthCodes[length])
+		c := litCodes[257+lc]
+		bw.writeBits(uint64(c.bits), uint(c.length))
+		bw.writeBits(uint64(length-lengthBase[lc]), lengthExtra[lc])
+
+		dc := distCode(dist)
+		c = distCodes[dc]
+		bw.writeBits(uint64(c.bits), uint(c.length))
+		bw.writeBits(uint64(dist-distBase[dc]), distExtra[dc])
+	}
+
+	c := litCodes[endOfBlock]
+	bw.writeBits(uint64(c.bits), uint(c.length))
+}
+
+// codeLengthSymbol is a symbol of the code length alphabet, 16 to 18
+// repeat a length and carry the count in extra
+type codeLengthSymbol struct {
+	symbol uint8
+	extra  uint8
+}
+
+var codeLengthExtra = [numCodeLength]uint{16: 2, 17: 3, 18: 7}
+
+// dynamicHeader describes the codes of a dynamic block
+type dynamicHeader struct {
+	numLit    int
+	numDist   int
+	numCL     int
+	symbols   []codeLengthSymbol
+	clFreq    []int
+	clLengths []uint8
+}
+
+func newDynamicHeader(litLengths, distLengths []uint8) *dynamicHeader {
+	h := &dynamicHeader{numLit: numLitLen, numDist: numDist}
+	for h.numLit > 257 && litLengths[h.numLit-1] == 0 {
+		h.numLit--
+	}
+	for h.numDist > 1 && distLengths[h.numDist-1] == 0 {
+		h.numDist--
+	}
+
+	lengths := append(append([]uint8{}, litLengths[:h.numLit]...), distLengths[:h.numDist]...)
+	h.symbols = runLengthEncode(lengths)
+
+	h.clFreq = make([]int, numCodeLength)
+	for _, s := range h.symbols {
+		h.clFreq[s.symbol]++
+	}
+
+	// decoders reject an incomplete code length code, two codes of one
+	// bit are needed when a single symbol is used
+	used := 0
+	for _, f := range h.clFreq {
+		if f > 0 {
+			used++
+		}
+	}
+	if used == 1 {
+		if h.clFreq[0] == 0 {
+			h.clFreq[0] = 1
+		} else {
+			h.clFreq[1] = 1
+		}
+	}
+
+	h.clLengths = buildCodeLengths(h.clFreq, 7)
+	h.numCL = numCodeLength
+	for h.numCL > 4 && h.clLengths[codeLengthOrder[h.numCL-1]] == 0 {
+		h.numCL--
+	}
+	return h
+}
+
+// runLengthEncode encodes the code lengths with the repeat symbols
+func runLengthEncode(lengths []uint8) []codeLengthSymbol {
+	symbols := []codeLengthSymbol{}
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == length {
+			run++
+		}
+		i += run
+
+		if length == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				symbols = append(symbols, codeLengthSymbol{18, uint8(n - 11)})
+				run -= n
+			}
+			if run >= 3 {
+				symbols = append(symbols, codeLengthSymbol{17, uint8(run - 3)})
+				run = 0
+			}
+		} else {
+			symbols = append(symbols, codeLengthSymbol{symbol: length})
+			run--
+			for run >= 3 {
+				n := min(run, 6)
+				symbols = append(symbols, codeLengthSymbol{16, uint8(n - 3)})
+				run -= n
+			}
+		}
+
+		for ; run > 0; run-- {
+			symbols = append(symbols, codeLengthSymbol{symbol: length})
+		}
+	}
+	return symbols
+}
+
+func (h *dynamicHeader) bits() int {
+	size := 3 + 5 + 5 + 4 + 3*h.numCL
+	for _, s := range h.symbols {
+		size += int(h.clLengths[s.symbol]) + int(codeLengthExtra[s.symbol])
+	}
+	return size
+}
+
+func (h *dynamicHeader) write(bw *bitWriter) {
+	bw.writeBits(uint64(h.numLit-257), 5)
+	bw.writeBits(uint64(h.numDist-1), 5)
+	bw.writeBits(uint64(h.numCL-4), 4)
+	for _, symbol := range codeLengthOrder[:h.numCL] {
+		bw.writeBits(uint64(h.clLengths[symbol]), 3)
+	}
+
+	codes := canonicalCodes(h.clLengths)
+	for _, s := range h.symbols {
+		c := codes[s.symbol]
+		bw.writeBits(uint64(c.bits), uint(c.length))
+		bw.writeBits(uint64(s.extra), codeLengthExtra[s.symbol])
+	}
+}
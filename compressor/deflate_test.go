@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"os/exec"
+	"testing"
+)
+
+// deflateInputs covers stored, fixed and dynamic blocks, matches reaching
+// back the whole window and inputs longer than several windows
+func deflateInputs() map[string][]byte {
+	random := make([]byte, 200000)
+	rand.New(rand.NewSource(3)).Read(random)
+
+	return map[string][]byte{
+		"empty":       {},
+		"single byte": {'a'},
+		"short":       []byte("hello, hello, hello world"),
+		"run":         bytes.Repeat([]byte{'x'}, 100000),
+		"random":      random,
+		"far match":   append(append(append([]byte{}, random[:1000]...), random[1000:1000+windowSize-1000]...), random[:1000]...),
+		"text":        benchmarkCorpus()[:300000],
+		"mixed":       append(append([]byte{}, random[:70000]...), benchmarkCorpus()[:70000]...),
+	}
+}
+
+func TestDeflateRoundTrip(t *testing.T) {
+	for name, data := range deflateInputs() {
+		for level := NoCompression; level <= BestCompression; level++ {
+			var compressed bytes.Buffer
+			if err := deflate(data, &compressed, level); err != nil {
+				t.Fatalf("Error compressing %s at level %d: %v", name, level, err)
+			}
+
+			var ours bytes.Buffer
+			if err := inflate(bytes.NewReader(compressed.Bytes()), &ours); err != nil {
+				t.Fatalf("Error decompressing %s at level %d: %v", name, level, err)
+			}
+			if !bytes.Equal(ours.Bytes(), data) {
+				t.Errorf("%s at level %d: round trip changed the data", name, level)
+			}
+
+			theirs, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed.Bytes())))
+			if err != nil {
+				t.Fatalf("Error decompressing %s at level %d with compress/flate: %v", name, level, err)
+			}
+			if !bytes.Equal(theirs, data) {
+				t.Errorf("%s at level %d: compress/flate decoded different data", name, level)
+			}
+		}
+	}
+}
+
+func TestInflateFlate(t *testing.T) {
+	for name, data := range deflateInputs() {
+		for _, level := range []int{flate.NoCompression, flate.HuffmanOnly, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression} {
+			var compressed bytes.Buffer
+			w, err := flate.NewWriter(&compressed, level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(data[:len(data)/2])
+			// a sync flush puts an empty stored block in the middle
+			w.Flush()
+			w.Write(data[len(data)/2:])
+			w.Close()
+
+			var out bytes.Buffer
+			if err := inflate(&compressed, &out); err != nil {
+				t.Fatalf("Error decompressing %s from compress/flate level %d: %v", name, level, err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Errorf("%s from compress/flate level %d: decoded different data", name, level)
+			}
+		}
+	}
+}
+
+func TestGzip(t *testing.T) {
+	data := benchmarkCorpus()[:200000]
+
+	var compressed bytes.Buffer
+	if err := gzipCompress(data, &compressed, DefaultCompression); err != nil {
+		t.Fatalf("Error compressing: %v", err)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("Error reading the header with compress/gzip: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected compress/gzip to decode the data: %v", err)
+	}
+
+	// two members written by compress/gzip, with a name
+	var theirs bytes.Buffer
+	for _, part := range [][]byte{data[:1000], data[1000:]} {
+		w := gzip.NewWriter(&theirs)
+		w.Name = "corpus.txt"
+		w.Write(part)
+		w.Close()
+	}
+	var out bytes.Buffer
+	if err := gzipDecompress(&theirs, &out); err != nil {
+		t.Fatalf("Error decompressing compress/gzip output: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("compress/gzip output decoded to different data")
+	}
+
+	corrupted := bytes.Clone(compressed.Bytes())
+	corrupted[len(corrupted)-5] ^= 1
+	if err := gzipDecompress(bytes.NewReader(corrupted), io.Discard); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected %v for a bad CRC, got %v", ErrChecksum, err)
+	}
+}
+
+func TestGzipTool(t *testing.T) {
+	tool, err := exec.LookPath("gzip")
+	if err != nil {
+		t.Skip("gzip is not installed")
+	}
+
+	data := benchmarkCorpus()[:500000]
+	for _, level := range []int{BestSpeed, DefaultCompression, BestCompression} {
+		var compressed bytes.Buffer
+		if err := gzipCompress(data, &compressed, level); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(tool, "-d", "-c")
+		cmd.Stdin = &compressed
+		got, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Error decompressing with gzip at level %d: %v", level, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("gzip decoded different data at level %d", level)
+		}
+	}
+
+	cmd := exec.Command(tool, "-9", "-c")
+	cmd.Stdin = bytes.NewReader(data)
+	compressed, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := gzipDecompress(bytes.NewReader(compressed), &out); err != nil {
+		t.Fatalf("Error decompressing gzip output: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("gzip output decoded to different data")
+	}
+}
+
+func TestDeflateLevels(t *testing.T) {
+	data := benchmarkCorpus()[:1<<20]
+
+	sizes := make([]int, BestCompression+1)
+	for level := range sizes {
+		var compressed bytes.Buffer
+		if err := deflate(data, &compressed, level); err != nil {
+			t.Fatal(err)
+		}
+		sizes[level] = compressed.Len()
+	}
+
+	if sizes[NoCompression] < len(data) {
+		t.Errorf("level 0 should store the data, got %d bytes for %d", sizes[NoCompression], len(data))
+	}
+	if sizes[BestSpeed] >= len(data)/2 {
+		t.Errorf("level 1 should at least halve text, got %d bytes for %d", sizes[BestSpeed], len(data))
+	}
+	if sizes[BestCompression] > sizes[BestSpeed] || sizes[DefaultCompression] > sizes[BestSpeed] {
+		t.Errorf("higher levels should compress better: %v", sizes)
+	}
+
+	var huffman bytes.Buffer
+	compress(data, &huffman)
+	if sizes[DefaultCompression] >= huffman.Len() {
+		t.Errorf("LZ77 should beat Huffman alone: %d bytes against %d", sizes[DefaultCompression], huffman.Len())
+	}
+}
+
+func TestInflateErrors(t *testing.T) {
+	var valid bytes.Buffer
+	deflate(benchmarkCorpus()[:10000], &valid, DefaultCompression)
+	data := valid.Bytes()
+
+	// a fixed block starting with a match, there is nothing to copy
+	var noHistory bytes.Buffer
+	bw := newBitWriter(&noHistory)
+	writeBlockHeader(bw, true, 1)
+	writeTokens(bw, []token{matchToken(3, 1)}, canonicalCodes(fixedLitLengths), canonicalCodes(fixedDistLengths))
+	bw.flush()
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", []byte{}},
+		{"reserved block type", []byte{0x07}},
+		{"bad stored length", []byte{0x01, 0x05, 0x00, 0x00, 0x00}},
+		{"truncated stored", []byte{0x01, 0x05, 0x00, 0xfa, 0xff, 'a'}},
+		{"truncated", data[:len(data)/2]},
+		{"distance too far", noHistory.Bytes()},
+	}
+
+	for _, test := range tests {
+		err := inflate(bytes.NewReader(test.input), io.Discard)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected %v, got %v", test.name, ErrCorrupt, err)
+		}
+	}
+}
+
+func BenchmarkDeflate(b *testing.B) {
+	data := benchmarkCorpus()[:8<<20]
+	for _, level := range []int{BestSpeed, DefaultCompression, BestCompression} {
+		b.Run(string(rune('0'+level)), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				deflate(data, io.Discard, level)
+			}
+		})
+	}
+}
+
+func BenchmarkInflate(b *testing.B) {
+	data := benchmarkCorpus()[:8<<20]
+	var compressed bytes.Buffer
+	deflate(data, &compressed, DefaultCompression)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inflate(bytes.NewReader(compressed.Bytes()), io.Discard)
+	}
+}
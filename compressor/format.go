@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compressed files start with a header describing how to decode them:
+//
+//	magic   "HUF" followed by the format version
+//	length  uvarint, number of bytes once decompressed
+//	lengths the canonical code length of the 256 byte values, 4 bits each,
+//	        absent when length is 0
+//	payload the code of every byte, packed least significant bit first
+//	        and padded with zero bits to a full byte
+const (
+	magic         = "HUF"
+	formatVersion = 2
+)
+
+var (
+	ErrFormat  = errors.New("not a compressed file")
+	ErrVersion = errors.New("unsupported format version")
+	ErrCorrupt = errors.New("corrupt compressed data")
+	// ErrTruncated is also an ErrCorrupt
+	ErrTruncated = fmt.Errorf("%w: unexpected end of input", ErrCorrupt)
+)
+
+// compress encodes data with a Huffman code built from its byte
+// frequencies
+func compress(data []byte, w io.Writer) error {
+	header := append([]byte(magic), formatVersion)
+	header = binary.AppendUvarint(header, uint64(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	lengths := buildCodeLengths(buildFreqTable(data), maxCodeLength)
+	codes := canonicalCodes(lengths)
+
+	bw := newBitWriter(w)
+	for _, length := range lengths {
+		bw.writeBits(uint64(length), 4)
+	}
+
+	for _, b := range data {
+		c := codes[b]
+		bw.writeBits(uint64(c.bits), uint(c.length))
+	}
+
+	return bw.flush()
+}
+
+// decompress decodes what compress wrote
+func decompress(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return ErrFormat
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return ErrFormat
+	}
+	if header[len(magic)] != formatVersion {
+		return ErrVersion
+	}
+
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return ErrCorrupt
+	}
+
+	if length == 0 {
+		return nil
+	}
+
+	bits := newBitReader(br)
+	lengths := make([]uint8, 256)
+	for i := range lengths {
+		l, err := bits.readBits(4)
+		if err != nil {
+			return corrupt(err)
+		}
+		lengths[i] = uint8(l)
+	}
+
+	decoder, err := newHuffmanDecoder(lengths)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	for i := uint64(0); i < length; i++ {
+		symbol, err := decoder.decode(bits)
+		if err != nil {
+			return corrupt(err)
+		}
+		if err := out.WriteByte(byte(symbol)); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
+
+// corrupt reports the input ending too early as truncated
+func corrupt(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func roundTrip(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	if err := compress(data, &compressed); err != nil {
+		t.Fatalf("Error compressing: %v", err)
+	}
+
+	var decompressed bytes.Buffer
+	if err := decompress(bytes.NewReader(compressed.Bytes()), &decompressed); err != nil {
+		t.Fatalf("Error decompressing: %v", err)
+	}
+
+	if !bytes.Equal(decompressed.Bytes(), data) {
+		t.Fatalf("round trip changed the data: %d bytes in, %d bytes out", len(data), decompressed.Len())
+	}
+	return compressed.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	allBytes := make([]byte, 256*4)
+	for i := range allBytes {
+		allBytes[i] = byte(i)
+	}
+
+	tests := map[string][]byte{
+		"empty":         {},
+		"single byte":   {'a'},
+		"single symbol": bytes.Repeat([]byte{0}, 1000),
+		"two symbols":   []byte("abababababbbbbbbba"),
+		"mississippi":   []byte("MISSISSIPPI"),
+		"all bytes":     allBytes,
+		"binary":        random,
+		"invalid utf8":  {0xff, 0xfe, 0xc3, 0x28, 0xa0, 0xa1},
+		"text":          bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 500),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			roundTrip(t, data)
+		})
+	}
+}
+
+func TestCompressionRatio(t *testing.T) {
+	data := bytes.Repeat([]byte("aaaaaaabbbc"), 1000)
+	compressed := roundTrip(t, data)
+
+	// a takes 1 bit, b and c 2 bits: 15 bits for every 11 bytes, plus the
+	// header and its 128 bytes of code lengths
+	if len(compressed) > len(data)*15/88+140 {
+		t.Errorf("expected about %d bytes, got %d", len(data)*15/88, len(compressed))
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	var valid bytes.Buffer
+	if err := compress([]byte("hello, world"), &valid); err != nil {
+		t.Fatal(err)
+	}
+	data := valid.Bytes()
+
+	tests := []struct {
+		name  string
+		input []byte
+		err   error
+	}{
+		{"empty", []byte{}, ErrFormat},
+		{"bad magic", []byte("ZIP\x01\x00"), ErrFormat},
+		{"bad version", append([]byte(magic), 9, 0), ErrVersion},
+		{"missing length", append([]byte(magic), formatVersion), ErrCorrupt},
+		{"truncated", data[:len(data)-2], ErrCorrupt},
+		{"missing lengths", data[:5], ErrCorrupt},
+		{"over-subscribed lengths", append(append([]byte(magic), formatVersion, 1), bytes.Repeat([]byte{0x11}, 128)...), ErrCorrupt},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := decompress(bytes.NewReader(test.input), &out)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestCompressFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.bin")
+	compressed := filepath.Join(dir, "input.cmp")
+	output := filepath.Join(dir, "output.bin")
+
+	data := make([]byte, 50000)
+	rand.New(rand.NewSource(2)).Read(data[:1000])
+	if err := os.WriteFile(input, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for format := range compressors {
+		s := defaultSettings()
+		s.format = format
+		s.blockSize = 4096
+		if err := compressFile(input, compressed, s); err != nil {
+			t.Fatalf("Error compressing %s: %v", format, err)
+		}
+		if err := decompressFile(compressed, output, s); err != nil {
+			t.Fatalf("Error decompressing %s: %v", format, err)
+		}
+
+		got, err := os.ReadFile(output)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("expected the original file back from %s: %v", format, err)
+		}
+	}
+}
+
+func TestDecompressFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.bin")
+	output := filepath.Join(dir, "output.bin")
+
+	// not compressed, read as a raw DEFLATE stream
+	if err := os.WriteFile(input, []byte("plain text, not compressed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := decompressFile(input, output, defaultSettings()); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected %v, got %v", ErrCorrupt, err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("expected the output to be removed: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Streams are gzip members (RFC 1952): a DEFLATE stream between a header
+// and a trailer holding the CRC-32 and the length of the data
+const (
+	gzipID1     = 0x1f
+	gzipID2     = 0x8b
+	gzipDeflate = 8
+
+	gzipFlagHCRC    = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+)
+
+var ErrChecksum = errors.New("checksum mismatch")
+
+// gzipCompress writes data as a single gzip member
+func gzipCompress(data []byte, w io.Writer, level int) error {
+	z, err := NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	}
+	if _, err := z.Write(data); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// gzipDecompress decodes every member of a gzip file
+func gzipDecompress(r io.Reader, w io.Writer) error {
+	z, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, z)
+	return err
+}
+
+func gzipHeader(level int) []byte {
+	header := []byte{gzipID1, gzipID2, gzipDeflate, 0, 0, 0, 0, 0, 0, 255}
+	switch level {
+	case BestCompression:
+		header[8] = 2
+	case BestSpeed:
+		header[8] = 4
+	}
+	return header
+}
+
+func readGzipHeader(br *bufio.Reader) error {
+	header := make([]byte, 10)
+	if n, err := io.ReadFull(br, header); err != nil {
+		if n >= 2 && header[0] == gzipID1 && header[1] == gzipID2 {
+			return ErrTruncated
+		}
+		return ErrFormat
+	}
+	if header[0] != gzipID1 || header[1] != gzipID2 || header[2] != gzipDeflate {
+		return ErrFormat
+	}
+
+	flags := header[3]
+	if flags&gzipFlagExtra != 0 {
+		var length [2]byte
+		if _, err := io.ReadFull(br, length[:]); err != nil {
+			return ErrTruncated
+		}
+		if _, err := br.Discard(int(binary.LittleEndian.Uint16(length[:]))); err != nil {
+			return ErrTruncated
+		}
+	}
+	for _, flag := range []byte{gzipFlagName, gzipFlagComment} {
+		if flags&flag == 0 {
+			continue
+		}
+		if _, err := br.ReadBytes(0); err != nil {
+			return ErrTruncated
+		}
+	}
+	if flags&gzipFlagHCRC != 0 {
+		if _, err := br.Discard(2); err != nil {
+			return ErrTruncated
+		}
+	}
+	return nil
+}
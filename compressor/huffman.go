@@ -0,0 +1,317 @@
+package main
+
+import (
+	"container/heap"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// maxCodeLength is the longest code we assign, as in DEFLATE
+const maxCodeLength = 15
+
+type Node struct {
+	symbol      int
+	freq        int
+	left, right *Node
+}
+
+func (n *Node) isLeaf() bool {
+	return n.left == nil && n.right == nil
+}
+
+// buildFreqTable counts the bytes of data, the table is indexed by byte
+func buildFreqTable(data []byte) []int {
+	freq := make([]int, 256)
+	for _, b := range data {
+		freq[b]++
+	}
+	return freq
+}
+
+type PriorityQueue []*Node
+
+func (pq PriorityQueue) Len() int { return len(pq) }
+func (pq PriorityQueue) Less(i, j int) bool {
+	if pq[i].freq != pq[j].freq {
+		return pq[i].freq < pq[j].freq
+	}
+	// ties are broken by symbol so the same input always gives the same tree
+	return pq[i].symbol < pq[j].symbol
+}
+func (pq PriorityQueue) Swap(i, j int) { pq[i], pq[j] = pq[j], pq[i] }
+func (pq *PriorityQueue) Push(x any)   { *pq = append(*pq, x.(*Node)) }
+func (pq *PriorityQueue) Pop() any {
+	old := *pq
+	n := len(old)
+	x := old[n-1]
+	*pq = old[:n-1]
+	return x
+}
+
+// buildHuffmanTree returns nil when every frequency is zero, freq is
+// indexed by symbol
+func buildHuffmanTree(freq []int) *Node {
+	pq := &PriorityQueue{}
+	heap.Init(pq)
+
+	for symbol, f := range freq {
+		if f > 0 {
+			heap.Push(pq, &Node{symbol: symbol, freq: f})
+		}
+	}
+
+	if pq.Len() == 0 {
+		return nil
+	}
+
+	for pq.Len() > 1 {
+		left := heap.Pop(pq).(*Node)
+		right := heap.Pop(pq).(*Node)
+		merged := &Node{
+			symbol: min(left.symbol, right.symbol),
+			freq:   left.freq + right.freq,
+			left:   left,
+			right:  right,
+		}
+		heap.Push(pq, merged)
+	}
+
+	return heap.Pop(pq).(*Node)
+}
+
+// buildCodeLengths returns the length of the code of every symbol, zero
+// for the unused ones. Lengths are limited to maxBits, a single used symbol
+// gets a one bit code
+func buildCodeLengths(freq []int, maxBits int) []uint8 {
+	lengths := make([]uint8, len(freq))
+
+	root := buildHuffmanTree(freq)
+	if root == nil {
+		return lengths
+	}
+	if root.isLeaf() {
+		lengths[root.symbol] = 1
+		return lengths
+	}
+
+	depths := make([]int, len(freq))
+	var walk func(node *Node, depth int)
+	walk = func(node *Node, depth int) {
+		if node.isLeaf() {
+			depths[node.symbol] = depth
+			return
+		}
+		walk(node.left, depth+1)
+		walk(node.right, depth+1)
+	}
+	walk(root, 0)
+
+	limitCodeLengths(depths, freq, maxBits)
+	for symbol, depth := range depths {
+		lengths[symbol] = uint8(depth)
+	}
+	return lengths
+}
+
+// limitCodeLengths shortens the codes longer than maxBits. The lengths are
+// then adjusted until the Kraft sum is exactly one again, lengthening the
+// rarest codes when it is over and shortening the most frequent ones when
+// there is room left, so the code stays complete
+func limitCodeLengths(lengths []int, freq []int, maxBits int) {
+	one := 1 << maxBits
+	kraft := 0
+	used := []int{}
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		if length > maxBits {
+			lengths[symbol] = maxBits
+		}
+		kraft += one >> lengths[symbol]
+		used = append(used, symbol)
+	}
+
+	if kraft == one {
+		return
+	}
+
+	// most frequent first
+	sort.SliceStable(used, func(i, j int) bool {
+		return freq[used[i]] > freq[used[j]]
+	})
+
+	for kraft > one {
+		// lengthen the rarest of the longest codes that can grow, it costs
+		// the least
+		best := -1
+		for _, symbol := range used {
+			if lengths[symbol] < maxBits && (best == -1 || lengths[symbol] >= lengths[best]) {
+				best = symbol
+			}
+		}
+		lengths[best]++
+		kraft -= one >> lengths[best]
+	}
+
+	for shortened := true; kraft < one && shortened; {
+		// shorten the most frequent code that still fits
+		shortened = false
+		for _, symbol := range used {
+			if lengths[symbol] > 1 && kraft+(one>>lengths[symbol]) <= one {
+				kraft += one >> lengths[symbol]
+				lengths[symbol]--
+				shortened = true
+				break
+			}
+		}
+	}
+}
+
+// code is a canonical Huffman code, bits are stored reversed so they can
+// be written least significant bit first
+type code struct {
+	bits   uint32
+	length uint8
+}
+
+// canonicalCodes assigns the codes from the lengths like DEFLATE does:
+// shorter codes first and, for the same length, in symbol order
+func canonicalCodes(lengths []uint8) []code {
+	var count [maxCodeLength + 1]int
+	for _, length := range lengths {
+		count[length]++
+	}
+	count[0] = 0
+
+	var next [maxCodeLength + 1]uint32
+	c := uint32(0)
+	for length := 1; length <= maxCodeLength; length++ {
+		c = (c + uint32(count[length-1])) << 1
+		next[length] = c
+	}
+
+	codes := make([]code, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		codes[symbol] = code{bits: reverseBits(next[length], length), length: length}
+		next[length]++
+	}
+	return codes
+}
+
+func reverseBits(value uint32, length uint8) uint32 {
+	return bits.Reverse32(value) >> (32 - length)
+}
+
+// The decoder looks up primaryBits bits at once. Longer codes go through a
+// second table for the bits left
+const primaryBits = 9
+
+const (
+	entryLengthMask = 0x1f
+	entryLink       = 0x20
+	entryValueShift = 16
+)
+
+// huffmanDecoder decodes canonical codes with lookup tables. An entry
+// holds the code length in its low bits and the symbol, or the index of the
+// second table for the link entries, in its high bits
+type huffmanDecoder struct {
+	maxLength uint
+	primary   []uint32
+	links     [][]uint32
+	linkBits  uint
+}
+
+// newHuffmanDecoder fails on over-subscribed lengths. Incomplete codes are
+// accepted, the unused bit patterns are reported as corrupt data
+func newHuffmanDecoder(lengths []uint8) (*huffmanDecoder, error) {
+	var count [maxCodeLength + 1]int
+	maxLength := uint8(0)
+	for _, length := range lengths {
+		if length > maxCodeLength {
+			return nil, ErrCorrupt
+		}
+		count[length]++
+		maxLength = max(maxLength, length)
+	}
+	count[0] = 0
+
+	if maxLength == 0 {
+		return nil, ErrCorrupt
+	}
+
+	left := 1
+	for length := 1; length <= maxCodeLength; length++ {
+		left = left<<1 - count[length]
+		if left < 0 {
+			return nil, ErrCorrupt
+		}
+	}
+
+	d := &huffmanDecoder{maxLength: uint(maxLength)}
+	tableBits := min(uint(maxLength), primaryBits)
+	d.primary = make([]uint32, 1<<tableBits)
+	if d.maxLength > tableBits {
+		d.linkBits = d.maxLength - tableBits
+	}
+
+	codes := canonicalCodes(lengths)
+	for symbol, c := range codes {
+		if c.length == 0 {
+			continue
+		}
+
+		entry := uint32(symbol)<<entryValueShift | uint32(c.length)
+		if uint(c.length) <= tableBits {
+			// every index that starts with the code
+			for i := c.bits; i < uint32(len(d.primary)); i += 1 << c.length {
+				d.primary[i] = entry
+			}
+			continue
+		}
+
+		prefix := c.bits & (1<<tableBits - 1)
+		link := d.primary[prefix]
+		if link&entryLink == 0 {
+			link = uint32(len(d.links))<<entryValueShift | entryLink
+			d.primary[prefix] = link
+			d.links = append(d.links, make([]uint32, 1<<d.linkBits))
+		}
+
+		table := d.links[link>>entryValueShift]
+		rest := c.bits >> tableBits
+		for i := rest; i < uint32(len(table)); i += 1 << (uint(c.length) - tableBits) {
+			table[i] = entry
+		}
+	}
+
+	return d, nil
+}
+
+// decode reads the next symbol
+func (d *huffmanDecoder) decode(br *bitReader) (int, error) {
+	available := br.fill(d.maxLength)
+	lookup := uint32(br.bits)
+
+	entry := d.primary[lookup&uint32(len(d.primary)-1)]
+	if entry&entryLink != 0 {
+		table := d.links[entry>>entryValueShift]
+		entry = table[(lookup>>primaryBits)&uint32(len(table)-1)]
+	}
+
+	length := uint(entry & entryLengthMask)
+	if length == 0 {
+		return 0, ErrCorrupt
+	}
+	if length > available {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	br.consume(length)
+	return int(entry >> entryValueShift), nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func kraftSum(lengths []uint8) int {
+	sum := 0
+	for _, length := range lengths {
+		if length > 0 {
+			sum += 1 << (maxCodeLength - length)
+		}
+	}
+	return sum
+}
+
+func TestCanonicalCodes(t *testing.T) {
+	// the example of RFC 1951 section 3.2.2
+	lengths := []uint8{3, 3, 3, 3, 3, 2, 4, 4}
+	expected := []string{"010", "011", "100", "101", "110", "00", "1110", "1111"}
+
+	codes := canonicalCodes(lengths)
+	for symbol, c := range codes {
+		got := ""
+		for i := uint8(0); i < c.length; i++ {
+			// codes are stored reversed
+			got += string('0' + byte(c.bits>>i&1))
+		}
+		if got != expected[symbol] {
+			t.Errorf("symbol %d: expected %s, got %s", symbol, expected[symbol], got)
+		}
+	}
+}
+
+func TestLengthLimit(t *testing.T) {
+	// Fibonacci frequencies give the deepest possible tree
+	freq := make([]int, 40)
+	a, b := 1, 1
+	for i := range freq {
+		freq[i] = a
+		a, b = b, a+b
+	}
+
+	lengths := buildCodeLengths(freq, maxCodeLength)
+	for symbol, length := range lengths {
+		if length == 0 || length > maxCodeLength {
+			t.Errorf("symbol %d: invalid length %d", symbol, length)
+		}
+	}
+	if sum := kraftSum(lengths); sum != 1<<maxCodeLength {
+		t.Errorf("expected a complete code, got Kraft sum %d/%d", sum, 1<<maxCodeLength)
+	}
+
+	// the most frequent symbols keep the shortest codes
+	if lengths[len(lengths)-1] > lengths[0] {
+		t.Errorf("expected the most frequent symbol to have the shortest code: %v", lengths)
+	}
+}
+
+func TestLengthLimitRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for round := 0; round < 200; round++ {
+		freq := make([]int, 2+rng.Intn(300))
+		for i := range freq {
+			if rng.Intn(4) > 0 {
+				freq[i] = 1 << rng.Intn(24)
+			}
+		}
+
+		lengths := buildCodeLengths(freq, maxCodeLength)
+		used := 0
+		for symbol, length := range lengths {
+			if (length == 0) != (freq[symbol] == 0) || length > maxCodeLength {
+				t.Fatalf("symbol %d with frequency %d got length %d", symbol, freq[symbol], length)
+			}
+			if length > 0 {
+				used++
+			}
+		}
+		if sum := kraftSum(lengths); used > 1 && sum != 1<<maxCodeLength {
+			t.Fatalf("expected a complete code, got Kraft sum %d", sum)
+		}
+	}
+}
+
+func TestDecoderLongCodes(t *testing.T) {
+	// skewed frequencies over every byte value need codes longer than the
+	// primary table
+	data := []byte{}
+	for i := 0; i < 256; i++ {
+		count := 1
+		if i < 20 {
+			count = 1 << (20 - i)
+		}
+		data = append(data, bytes.Repeat([]byte{byte(i)}, count)...)
+	}
+	rand.New(rand.NewSource(4)).Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+
+	lengths := buildCodeLengths(buildFreqTable(data), maxCodeLength)
+	longest := uint8(0)
+	for _, length := range lengths {
+		longest = max(longest, length)
+	}
+	if longest <= primaryBits {
+		t.Fatalf("expected codes longer than %d bits, got %d", primaryBits, longest)
+	}
+
+	roundTrip(t, data)
+}
+
+func TestDecoderInvalidLengths(t *testing.T) {
+	tests := map[string][]uint8{
+		"empty":           make([]uint8, 256),
+		"over-subscribed": {1, 1, 1},
+		"too long":        {16, 1},
+	}
+
+	for name, lengths := range tests {
+		if _, err := newHuffmanDecoder(lengths); err != ErrCorrupt {
+			t.Errorf("%s: expected ErrCorrupt, got %v", name, err)
+		}
+	}
+
+	// a lone one bit code is incomplete but valid, its unused pattern is not
+	decoder, err := newHuffmanDecoder([]uint8{0, 1})
+	if err != nil {
+		t.Fatalf("Error building decoder: %v", err)
+	}
+	if _, err := decoder.decode(newBitReader(bytes.NewReader([]byte{0xff}))); err != ErrCorrupt {
+		t.Errorf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+const benchmarkCorpusSize = 100 << 20
+
+var (
+	corpusOnce sync.Once
+	corpus     []byte
+)
+
+// benchmarkCorpus returns 100 MB of text with words following a Zipf
+// distribution, like logs or prose
+func benchmarkCorpus() []byte {
+	corpusOnce.Do(func() {
+		rng := rand.New(rand.NewSource(5))
+		words := make([][]byte, 5000)
+		for i := range words {
+			word := make([]byte, 2+rng.Intn(9))
+			for j := range word {
+				word[j] = "etaoinshrdlcumwfgypbvkjxqz"[min(rng.Intn(26), rng.Intn(26))]
+			}
+			words[i] = word
+		}
+
+		zipf := rand.NewZipf(rng, 1.1, 1, uint64(len(words)-1))
+		corpus = make([]byte, 0, benchmarkCorpusSize+16)
+		for len(corpus) < benchmarkCorpusSize {
+			corpus = append(corpus, words[zipf.Uint64()]...)
+			if rng.Intn(12) == 0 {
+				corpus = append(corpus, '.', '\n')
+			} else {
+				corpus = append(corpus, ' ')
+			}
+		}
+		corpus = corpus[:benchmarkCorpusSize]
+	})
+	return corpus
+}
+
+func BenchmarkCompress(b *testing.B) {
+	data := benchmarkCorpus()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := compress(data, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	data := benchmarkCorpus()
+	var compressed bytes.Buffer
+	if err := compress(data, &compressed); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := decompress(bytes.NewReader(compressed.Bytes()), io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+var fixedLitDecoder, fixedDistDecoder *huffmanDecoder
+
+func init() {
+	var err error
+	if fixedLitDecoder, err = newHuffmanDecoder(fixedLitLengths); err != nil {
+		panic(err)
+	}
+	if fixedDistDecoder, err = newHuffmanDecoder(fixedDistLengths); err != nil {
+		panic(err)
+	}
+}
+
+// inflater decodes a raw DEFLATE stream a piece at a time. out holds the
+// last 32 KiB already read, needed by the matches, followed by the bytes
+// not read yet
+type inflater struct {
+	br   *bitReader
+	out  []byte
+	read int
+
+	// the block being decoded, lit is nil for a stored block
+	inBlock bool
+	final   bool
+	done    bool
+	lit     *huffmanDecoder
+	dist    *huffmanDecoder
+	stored  int // bytes left in the stored block
+}
+
+func newInflater(br *bitReader) *inflater {
+	return &inflater{br: br, out: make([]byte, 0, 4*windowSize)}
+}
+
+// inflate decompresses a raw DEFLATE stream
+func inflate(r io.Reader, w io.Writer) error {
+	return newInflater(newBitReader(bufio.NewReader(r))).writeTo(w)
+}
+
+// writeTo decodes the stream up to its final block. The bit reader is left
+// after the stream, on a byte boundary
+func (f *inflater) writeTo(w io.Writer) error {
+	for !f.done {
+		f.slide()
+		if err := f.decode(); err != nil {
+			return corrupt(err)
+		}
+
+		if _, err := w.Write(f.out[f.read:]); err != nil {
+			return err
+		}
+		f.read = len(f.out)
+	}
+	return nil
+}
+
+// Read returns io.EOF after the final block, errors are not mapped by
+// corrupt
+func (f *inflater) Read(p []byte) (int, error) {
+	for f.read == len(f.out) {
+		if f.done {
+			return 0, io.EOF
+		}
+
+		f.slide()
+		if err := f.decode(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, f.out[f.read:])
+	f.read += n
+	return n, nil
+}
+
+// slide drops the bytes read, apart from the window
+func (f *inflater) slide() {
+	drop := min(f.read, len(f.out)-windowSize)
+	if drop <= 0 {
+		return
+	}
+
+	copy(f.out, f.out[drop:])
+	f.out = f.out[:len(f.out)-drop]
+	f.read -= drop
+}
+
+// decode fills out until a match may not fit anymore, a block ends with
+// bytes to read or the stream ends. Stopping at the end of a block lets
+// a Reader return what was flushed without waiting for more input
+func (f *inflater) decode() error {
+	for len(f.out) <= cap(f.out)-maxMatchLength {
+		if !f.inBlock {
+			if f.read < len(f.out) {
+				return nil
+			}
+			if f.final {
+				f.done = true
+				f.br.alignToByte()
+				return nil
+			}
+			if err := f.blockHeader(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if f.lit == nil {
+			if f.stored == 0 {
+				f.inBlock = false
+				continue
+			}
+
+			b, err := f.br.readBits(8)
+			if err != nil {
+				return err
+			}
+			f.out = append(f.out, byte(b))
+			f.stored--
+			continue
+		}
+
+		if err := f.symbol(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockHeader starts the next block
+func (f *inflater) blockHeader() error {
+	header, err := f.br.readBits(3)
+	if err != nil {
+		return err
+	}
+	f.final = header&1 == 1
+	f.inBlock = true
+
+	switch header >> 1 {
+	case 0:
+		f.lit, f.dist = nil, nil
+		return f.storedHeader()
+	case 1:
+		f.lit, f.dist = fixedLitDecoder, fixedDistDecoder
+		return nil
+	case 2:
+		f.lit, f.dist, err = f.dynamicCodes()
+		return err
+	}
+	return ErrCorrupt
+}
+
+func (f *inflater) storedHeader() error {
+	f.br.alignToByte()
+	length, err := f.br.readBits(16)
+	if err != nil {
+		return err
+	}
+	complement, err := f.br.readBits(16)
+	if err != nil {
+		return err
+	}
+	if length != ^complement&0xffff {
+		return ErrCorrupt
+	}
+
+	f.stored = int(length)
+	return nil
+}
+
+// dynamicCodes reads the code lengths of a dynamic block
+func (f *inflater) dynamicCodes() (*huffmanDecoder, *huffmanDecoder, error) {
+	counts, err := f.br.readBits(5 + 5 + 4)
+	if err != nil {
+		return nil, nil, err
+	}
+	litCount := int(counts&0x1f) + 257
+	distCount := int(counts>>5&0x1f) + 1
+	clCount := int(counts>>10) + 4
+	if litCount > numLitLen || distCount > numDist {
+		return nil, nil, ErrCorrupt
+	}
+
+	clLengths := make([]uint8, numCodeLength)
+	for _, symbol := range codeLengthOrder[:clCount] {
+		length, err := f.br.readBits(3)
+		if err != nil {
+			return nil, nil, err
+		}
+		clLengths[symbol] = uint8(length)
+	}
+	clDecoder, err := newHuffmanDecoder(clLengths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lengths := make([]uint8, litCount+distCount)
+	for i := 0; i < len(lengths); {
+		symbol, err := clDecoder.decode(f.br)
+		if err != nil {
+			return nil, nil, err
+		}
+		if symbol < 16 {
+			lengths[i] = uint8(symbol)
+			i++
+			continue
+		}
+
+		repeat, err := f.br.readBits(codeLengthExtra[symbol])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value := uint8(0)
+		switch symbol {
+		case 16:
+			if i == 0 {
+				return nil, nil, ErrCorrupt
+			}
+			value = lengths[i-1]
+			repeat += 3
+		case 17:
+			repeat += 3
+		default:
+			repeat += 11
+		}
+
+		if i+int(repeat) > len(lengths) {
+			return nil, nil, ErrCorrupt
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = value
+			i++
+		}
+	}
+
+	if lengths[endOfBlock] == 0 {
+		return nil, nil, ErrCorrupt
+	}
+	lit, err := newHuffmanDecoder(lengths[:litCount])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a block of literals only may have no distance code at all
+	var dist *huffmanDecoder
+	if hasCode(lengths[litCount:]) {
+		if dist, err = newHuffmanDecoder(lengths[litCount:]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return lit, dist, nil
+}
+
+// symbol decodes a literal, a match or the end of the block
+func (f *inflater) symbol() error {
+	symbol, err := f.lit.decode(f.br)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case symbol < endOfBlock:
+		f.out = append(f.out, byte(symbol))
+		return nil
+	case symbol == endOfBlock:
+		f.inBlock = false
+		return nil
+	case symbol-257 >= len(lengthBase) || f.dist == nil:
+		return ErrCorrupt
+	}
+
+	lc := symbol - 257
+	extra, err := f.br.readBits(lengthExtra[lc])
+	if err != nil {
+		return err
+	}
+	length := lengthBase[lc] + int(extra)
+
+	dc, err := f.dist.decode(f.br)
+	if err != nil {
+		return err
+	}
+	if dc >= numDist {
+		return ErrCorrupt
+	}
+	if extra, err = f.br.readBits(distExtra[dc]); err != nil {
+		return err
+	}
+	distance := distBase[dc] + int(extra)
+
+	if distance > len(f.out) {
+		return ErrCorrupt
+	}
+
+	// the match may overlap the bytes it produces
+	start := len(f.out) - distance
+	for length > 0 {
+		n := min(length, distance)
+		f.out = append(f.out, f.out[start:start+n]...)
+		start += n
+		length -= n
+	}
+	return nil
+}
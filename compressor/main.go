@@ -1,118 +1,213 @@
 package main
 
 import (
-	"container/heap"
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"runtime"
 )
 
-type Node struct {
-	char        rune
-	freq        int
-	left, right *Node
+const usage = `Usage: compressor compress [-format chunked|gzip|deflate|huffman] [-level 0-9]
+                           [-block SIZE] [-workers N] <input> <output>
+       compressor decompress [-workers N] [-offset N] [-length N] <input> <output>`
+
+// settings are the command line options
+type settings struct {
+	format    string
+	level     int
+	blockSize int
+	workers   int
+	offset    int64
+	length    int64 // -1 for everything after offset
 }
 
-func buildFreqTable(s string) map[rune]int {
-	freq := make(map[rune]int)
-	for _, ch := range s {
-		freq[ch]++
+func defaultSettings() settings {
+	return settings{
+		format:    "chunked",
+		level:     DefaultCompression,
+		blockSize: DefaultBlockSize,
+		workers:   runtime.NumCPU(),
+		length:    -1,
 	}
-	return freq
 }
 
-type PriorityQueue []*Node
-
-func (pq PriorityQueue) Len() int           { return len(pq) }
-func (pq PriorityQueue) Less(i, j int) bool { return pq[i].freq < pq[j].freq }
-func (pq PriorityQueue) Swap(i, j int)      { pq[i], pq[j] = pq[j], pq[i] }
-func (pq *PriorityQueue) Push(x any)        { *pq = append(*pq, x.(*Node)) }
-func (pq *PriorityQueue) Pop() any {
-	old := *pq
-	n := len(old)
-	x := old[n-1]
-	*pq = old[:n-1]
-	return x
+// compressors write the input in one of the output formats
+var compressors = map[string]func(r io.Reader, w io.Writer, s settings) error{
+	"chunked": func(r io.Reader, w io.Writer, s settings) error {
+		return compressChunked(r, w, s.level, s.blockSize, s.workers)
+	},
+	"gzip": func(r io.Reader, w io.Writer, s settings) error {
+		z, err := NewWriterLevel(w, s.level)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(z, r); err != nil {
+			return err
+		}
+		return z.Close()
+	},
+	"deflate": wholeInput(deflate),
+	"huffman": wholeInput(func(data []byte, w io.Writer, level int) error {
+		return compress(data, w)
+	}),
+}
+
+// wholeInput adapts the compressors that need all the data in memory
+func wholeInput(compressor func(data []byte, w io.Writer, level int) error) func(io.Reader, io.Writer, settings) error {
+	return func(r io.Reader, w io.Writer, s settings) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return compressor(data, w, s.level)
+	}
 }
 
-func buildHuffmanTree(freq map[rune]int) *Node {
-	pq := &PriorityQueue{}
-	heap.Init(pq)
+func compressFile(input, output string, s settings) error {
+	compressor, ok := compressors[s.format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", s.format)
+	}
 
-	for ch, f := range freq {
-		heap.Push(pq, &Node{char: ch, freq: f})
+	in, err := os.Open(input)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	for pq.Len() > 1 {
-		left := heap.Pop(pq).(*Node)
-		right := heap.Pop(pq).(*Node)
-		merged := &Node{
-			freq:  left.freq + right.freq,
-			left:  left,
-			right: right,
-		}
-		heap.Push(pq, merged)
+	file, err := os.Create(output)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	return heap.Pop(pq).(*Node)
+	w := bufio.NewWriter(file)
+	if err := compressor(bufio.NewReader(in), w, s); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
 }
 
-func buildCodes(node *Node, prefix string, codes map[rune]string) {
-	if node == nil {
-		return
+// decompressFile detects the format from the first bytes, anything that is
+// neither a Huffman, a chunked nor a gzip file is read as a raw DEFLATE
+// stream. Only chunked files can be read from an offset
+func decompressFile(input, output string, s settings) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	if node.left == nil && node.right == nil {
-		codes[node.char] = prefix
+	file, err := os.Create(output)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	buildCodes(node.left, prefix+"0", codes)
-	buildCodes(node.right, prefix+"1", codes)
-}
+	r := bufio.NewReader(in)
+	start, _ := r.Peek(len(magic))
+
+	decompressor := inflate
+	switch {
+	case bytes.Equal(start, []byte(chunkedMagic)):
+		decompressor = func(_ io.Reader, w io.Writer) error {
+			return decompressChunked(in, w, s)
+		}
+	case s.offset != 0 || s.length >= 0:
+		decompressor = func(io.Reader, io.Writer) error {
+			return errors.New("-offset and -length need a chunked file")
+		}
+	case bytes.Equal(start, []byte(magic)):
+		decompressor = decompress
+	case len(start) >= 2 && start[0] == gzipID1 && start[1] == gzipID2:
+		decompressor = gzipDecompress
+	}
 
-func encode(s string, codes map[rune]string) string {
-	result := ""
-	for _, ch := range s {
-		val := string(ch)
-		fmt.Println(val)
-		result += codes[ch]
+	w := bufio.NewWriter(file)
+	err = decompressor(r, w)
+	if err == nil {
+		err = w.Flush()
 	}
-	return result
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+	return file.Close()
 }
 
-func decode(encoded string, root *Node) string {
-	result := ""
-	current := root
+func decompressChunked(in *os.File, w io.Writer, s settings) error {
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	f, err := openChunked(in, info.Size())
+	if err != nil {
+		return err
+	}
 
-	for _, bit := range encoded {
-		if bit == '0' {
-			current = current.left
-		} else {
-			current = current.right
-		}
+	if s.offset == 0 && s.length < 0 {
+		_, err = f.decompressTo(w, s.workers)
+		return err
+	}
 
-		if current.left == nil && current.right == nil {
-			result += string(current.char)
-			current = root
-		}
+	length := s.length
+	if length < 0 || s.offset+length > f.Size() {
+		length = max(f.Size()-s.offset, 0)
 	}
-	return result
+	_, err = io.Copy(w, io.NewSectionReader(f, s.offset, length))
+	return err
 }
 
 func main() {
-	input := "MISSISSIPPI"
-
-	freq := buildFreqTable(input)
-
-	root := buildHuffmanTree(freq)
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
 
-	codes := make(map[rune]string)
-	buildCodes(root, "", codes)
-	fmt.Println("Huffman Codes:", codes)
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() { fmt.Println(usage) }
+	s := defaultSettings()
+	flags.StringVar(&s.format, "format", s.format, "output format: chunked, gzip, deflate or huffman")
+	flags.IntVar(&s.level, "level", s.level, "compression level, 0 stores and 9 is the smallest")
+	flags.IntVar(&s.blockSize, "block", s.blockSize, "size of the blocks of chunked files")
+	flags.IntVar(&s.workers, "workers", s.workers, "number of blocks processed at once")
+	flags.Int64Var(&s.offset, "offset", s.offset, "first byte to decompress")
+	flags.Int64Var(&s.length, "length", s.length, "number of bytes to decompress, all by default")
+	flags.Parse(os.Args[2:])
+
+	if flags.NArg() != 2 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+
+	var err error
+	switch command {
+	case "compress":
+		err = compressFile(input, output, s)
+	case "decompress":
+		err = decompressFile(input, output, s)
+	default:
+		fmt.Println("Unknown command:", command)
+		os.Exit(1)
+	}
 
-	// Step 4: Encode
-	encoded := encode(input, codes)
-	fmt.Println("Encoded:", encoded)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
 
-	// Step 5: Decode
-	decoded := decode(encoded, root)
-	fmt.Println("Decoded:", decoded)
+	if info, err := os.Stat(output); err == nil {
+		if in, err := os.Stat(input); err == nil {
+			fmt.Printf("%s: %d bytes -> %s: %d bytes\n", input, in.Size(), output, info.Size())
+		}
+	}
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+var ErrClosed = errors.New("write to a closed stream")
+
+// Writer compresses what is written to it into a gzip stream. Close must
+// be called to write the checksum trailer
+type Writer struct {
+	w           io.Writer
+	level       int
+	d           *deflater
+	crc         uint32
+	size        uint32
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+// NewWriter returns a Writer compressing at DefaultCompression
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterLevel(w, DefaultCompression)
+	return z
+}
+
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	d, err := newDeflater(w, level)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, level: level, d: d}, nil
+}
+
+// writeHeader writes the header before the deflater writes anything
+func (z *Writer) writeHeader() error {
+	if z.wroteHeader {
+		return nil
+	}
+	z.wroteHeader = true
+	_, err := z.w.Write(gzipHeader(z.level))
+	return err
+}
+
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, ErrClosed
+	}
+
+	if z.err = z.writeHeader(); z.err != nil {
+		return 0, z.err
+	}
+	if z.err = z.d.write(p); z.err != nil {
+		return 0, z.err
+	}
+
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, p)
+	z.size += uint32(len(p))
+	return len(p), nil
+}
+
+// Flush writes everything written so far, a Reader on the other side can
+// decode it without waiting for more data. Flushing often hurts the ratio
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return ErrClosed
+	}
+
+	if z.err = z.writeHeader(); z.err != nil {
+		return z.err
+	}
+	z.err = z.d.flush()
+	return z.err
+}
+
+// Close ends the stream with its trailer, it does not close the
+// underlying writer
+func (z *Writer) Close() error {
+	if z.err != nil || z.closed {
+		return z.err
+	}
+	z.closed = true
+
+	if z.err = z.writeHeader(); z.err != nil {
+		return z.err
+	}
+	if z.err = z.d.close(); z.err != nil {
+		return z.err
+	}
+
+	trailer := binary.LittleEndian.AppendUint32(nil, z.crc)
+	trailer = binary.LittleEndian.AppendUint32(trailer, z.size)
+	_, z.err = z.w.Write(trailer)
+	return z.err
+}
+
+// Reader decompresses a gzip stream, or several ones written one after
+// the other. The checksum of every stream is checked at its end: Read
+// returns ErrChecksum when it does not match, ErrTruncated when the input
+// ends too early and ErrCorrupt for anything else that cannot be decoded
+type Reader struct {
+	r    *bufio.Reader
+	br   *bitReader
+	f    *inflater
+	crc  uint32
+	size uint32
+	err  error
+}
+
+// NewReader reads the header of the first stream
+func NewReader(r io.Reader) (*Reader, error) {
+	z := &Reader{r: bufio.NewReader(r)}
+	if err := z.start(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *Reader) start() error {
+	if err := readGzipHeader(z.r); err != nil {
+		return err
+	}
+
+	z.br = newBitReader(z.r)
+	z.f = newInflater(z.br)
+	z.crc, z.size = 0, 0
+	return nil
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	for z.err == nil {
+		n, err := z.f.Read(p)
+		z.crc = crc32.Update(z.crc, crc32.IEEETable, p[:n])
+		z.size += uint32(n)
+
+		switch {
+		case err == nil:
+			return n, nil
+		case err != io.EOF:
+			z.err = corrupt(err)
+		default:
+			z.err = z.next()
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, z.err
+}
+
+// next checks the trailer of the stream and starts the next one, it
+// returns io.EOF at the end of the input
+func (z *Reader) next() error {
+	// the inflater stops on a byte boundary, whole bytes of the trailer may
+	// already be in the bit reader
+	sum, err := z.br.readBits(32)
+	if err != nil {
+		return corrupt(err)
+	}
+	size, err := z.br.readBits(32)
+	if err != nil {
+		return corrupt(err)
+	}
+	if uint32(sum) != z.crc || uint32(size) != z.size {
+		return ErrChecksum
+	}
+
+	if _, err := z.r.Peek(1); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return err
+	}
+	return z.start()
+}
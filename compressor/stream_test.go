@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func writeStream(t testing.TB, data []byte, chunk int) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	z := NewWriter(&out)
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		if _, err := z.Write(data[:n]); err != nil {
+			t.Fatalf("Error writing: %v", err)
+		}
+		data = data[n:]
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("Error closing: %v", err)
+	}
+	return out.Bytes()
+}
+
+func readStream(data []byte) ([]byte, error) {
+	z, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(z)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	random := make([]byte, 300000)
+	rand.New(rand.NewSource(11)).Read(random)
+
+	tests := map[string][]byte{
+		"empty":  {},
+		"short":  []byte("hello, world"),
+		"text":   benchmarkCorpus()[:500000],
+		"random": random,
+	}
+
+	for name, data := range tests {
+		for _, chunk := range []int{1, 1000, 1 << 20} {
+			if chunk == 1 && len(data) > 100000 {
+				continue
+			}
+
+			compressed := writeStream(t, data, chunk)
+			got, err := readStream(compressed)
+			if err != nil {
+				t.Fatalf("Error reading %s written %d bytes at a time: %v", name, chunk, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s written %d bytes at a time: round trip changed the data", name, chunk)
+			}
+
+			theirs, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("Error reading %s with compress/gzip: %v", name, err)
+			}
+			if got, err := io.ReadAll(theirs); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s: expected compress/gzip to decode the stream: %v", name, err)
+			}
+		}
+	}
+}
+
+func TestStreamPipe(t *testing.T) {
+	data := benchmarkCorpus()[:1<<20]
+	pr, pw := io.Pipe()
+
+	go func() {
+		z := NewWriter(pw)
+		_, err := io.Copy(z, bytes.NewReader(data))
+		if err == nil {
+			err = z.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	z, err := NewReader(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(z)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected the data back through the pipe: %v", err)
+	}
+}
+
+func TestStreamFlush(t *testing.T) {
+	pr, pw := io.Pipe()
+	z := NewWriter(pw)
+	messages := []string{"first message\n", "second message\n"}
+
+	done := make(chan error)
+	go func() {
+		for _, m := range messages {
+			if _, err := z.Write([]byte(m)); err != nil {
+				done <- err
+				return
+			}
+			if err := z.Flush(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	// every message can be read before the stream is closed
+	r, err := NewReader(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range messages {
+		got := make([]byte, len(m))
+		if _, err := io.ReadFull(r, got); err != nil || string(got) != m {
+			t.Fatalf("expected %q after Flush, got %q: %v", m, got, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		z.Close()
+		pw.Close()
+	}()
+	if rest, err := io.ReadAll(r); err != nil || len(rest) != 0 {
+		t.Errorf("expected a clean end of stream, got %q: %v", rest, err)
+	}
+
+	if _, err := z.Write([]byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestStreamConcatenated(t *testing.T) {
+	first := writeStream(t, []byte("first stream, "), 100)
+	second := writeStream(t, []byte("second stream"), 100)
+
+	got, err := readStream(append(append([]byte{}, first...), second...))
+	if err != nil || string(got) != "first stream, second stream" {
+		t.Errorf("expected both streams, got %q: %v", got, err)
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	data := benchmarkCorpus()[:20000]
+	compressed := writeStream(t, data, 4096)
+
+	for n := 0; n < len(compressed); n++ {
+		_, err := readStream(compressed[:n])
+		if n < 2 {
+			if !errors.Is(err, ErrFormat) {
+				t.Errorf("%d bytes: expected %v, got %v", n, ErrFormat, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("%d of %d bytes: expected %v, got %v", n, len(compressed), ErrTruncated, err)
+		}
+	}
+}
+
+func TestStreamCorrupted(t *testing.T) {
+	data := benchmarkCorpus()[:20000]
+	compressed := writeStream(t, data, 4096)
+
+	// the header flags only change how the header is read, the mtime and
+	// the OS are not checked
+	for i := 10; i < len(compressed); i++ {
+		for _, bit := range []byte{0x01, 0x20} {
+			damaged := bytes.Clone(compressed)
+			damaged[i] ^= bit
+
+			got, err := readStream(damaged)
+			if err == nil && !bytes.Equal(got, data) {
+				t.Fatalf("byte %d: damaged stream decoded to other data without error", i)
+			}
+			if err != nil && !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrChecksum) {
+				t.Fatalf("byte %d: unexpected error %v", i, err)
+			}
+		}
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(writeStream(f, []byte("hello, hello, hello world"), 100))
+	f.Add(writeStream(f, benchmarkCorpus()[:2000], 100))
+	f.Add(append(writeStream(f, []byte("a"), 1), writeStream(f, []byte("b"), 1)...))
+
+	var stored bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&stored, gzip.NoCompression)
+	w.Write([]byte("stored block"))
+	w.Close()
+	f.Add(stored.Bytes())
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		z, err := NewReader(bytes.NewReader(input))
+		if err != nil {
+			return
+		}
+		got, err := io.ReadAll(io.LimitReader(z, 1<<24))
+		if err != nil {
+			return
+		}
+
+		// whatever we accept compress/gzip must decode the same way
+		theirs, err := gzip.NewReader(bytes.NewReader(input))
+		if err != nil {
+			return
+		}
+		want, err := io.ReadAll(io.LimitReader(theirs, 1<<24))
+		if err == nil && !bytes.Equal(got, want) {
+			t.Errorf("decoded %d bytes, compress/gzip decoded %d other bytes", len(got), len(want))
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte{}, 6)
+	f.Add([]byte("abracadabra abracadabra"), 1)
+	f.Add(bytes.Repeat([]byte{0}, 1000), 9)
+
+	f.Fuzz(func(t *testing.T, data []byte, level int) {
+		var compressed bytes.Buffer
+		z, err := NewWriterLevel(&compressed, level)
+		if err != nil {
+			return
+		}
+		z.Write(data)
+		if err := z.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readStream(compressed.Bytes())
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("round trip at level %d failed: %v", level, err)
+		}
+	})
+}
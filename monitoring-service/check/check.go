@@ -0,0 +1,366 @@
+// Package check runs the checks of the monitored URLs: http requests, tcp
+// connections, dns lookups and tls certificates
+package check
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"monitoring/db"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+
+	// maxBodySize is how much of a body is read and searched for the keyword
+	maxBodySize = 1 << 20
+
+	// maxRedirects is how many redirects are followed, as the default
+	// client does
+	maxRedirects = 10
+)
+
+var (
+	ErrMissingPort      = errors.New("missing port")
+	ErrInvalidHeader    = errors.New("invalid header")
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// Result is the outcome of a check. Warning is set when the check passed
+// but needs attention, Message then says why
+type Result struct {
+	db.HealthCheck
+	Warning bool
+}
+
+// Resolver looks up the names of the dns checks, net.Resolver implements it
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// Checker runs the checks. Timeout is the one of the URLs without their
+// own. TLSConfig, when set, is used by the http and tls checks to verify
+// the certificates
+type Checker struct {
+	Timeout   time.Duration
+	Resolver  Resolver
+	TLSConfig *tls.Config
+	Now       func() time.Time
+}
+
+func New() *Checker {
+	return &Checker{
+		Timeout:  DefaultTimeout,
+		Resolver: net.DefaultResolver,
+		Now:      time.Now,
+	}
+}
+
+// Run checks a URL the way its check type says. A failure is not an error,
+// the result is not alive and Message says why
+func (c *Checker) Run(ctx context.Context, u db.URL) Result {
+	timeout := c.Timeout
+	if u.Timeout > 0 {
+		timeout = time.Duration(u.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := Result{HealthCheck: db.HealthCheck{URLID: u.ID, CheckType: u.CheckType}}
+	if result.CheckType == "" {
+		result.CheckType = db.CheckTypeFromURL(u.URL)
+	}
+
+	start := time.Now()
+	var err error
+	switch result.CheckType {
+	case db.CheckHTTP:
+		err = c.checkHTTP(ctx, u, &result)
+	case db.CheckTCP:
+		err = c.checkTCP(ctx, u)
+	case db.CheckDNS:
+		err = c.checkDNS(ctx, u)
+	case db.CheckTLS:
+		err = c.checkTLS(ctx, u, &result)
+	default:
+		err = fmt.Errorf("unknown check type %q", result.CheckType)
+	}
+	result.ResponseTime = milliseconds(time.Since(start))
+
+	result.IsAlive = err == nil
+	if err != nil {
+		result.Message = err.Error()
+	}
+	return result
+}
+
+// checkHTTP sends a GET request timed by phase, it must answer with a
+// status in the expected range and a body matching the keyword. The
+// redirects are followed as the policy of the URL says
+func (c *Checker) checkHTTP(ctx context.Context, u db.URL, result *Result) error {
+	header, err := ParseHeaders(u.Headers)
+	if err != nil {
+		return err
+	}
+	checkRedirect, err := redirectPolicy(u.Redirects)
+	if err != nil {
+		return err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.TLSConfig != nil {
+		transport.TLSClientConfig = c.TLSConfig.Clone()
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+
+	timing := &timing{}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, timing.trace()), "GET", u.URL, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		timing.record(result)
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	timing.record(result)
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		return err
+	}
+
+	min, max := u.ExpectedStatusMin, u.ExpectedStatusMax
+	if min == 0 && max == 0 {
+		min, max = 200, 399
+	}
+	if resp.StatusCode < min || resp.StatusCode > max {
+		return fmt.Errorf("status %d, expected %d-%d", resp.StatusCode, min, max)
+	}
+
+	return matchKeyword(u.CheckConfig, body)
+}
+
+// redirectPolicy returns the CheckRedirect of a redirect policy. A
+// redirect not followed is the response of the check
+func redirectPolicy(policy string) (func(*http.Request, []*http.Request) error, error) {
+	switch policy {
+	case "", db.RedirectsFollow:
+		return func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("%w, stopped after %d", ErrTooManyRedirects, maxRedirects)
+			}
+			return nil
+		}, nil
+	case db.RedirectsSameHost:
+		return func(req *http.Request, via []*http.Request) error {
+			if req.URL.Host != via[0].URL.Host {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("%w, stopped after %d", ErrTooManyRedirects, maxRedirects)
+			}
+			return nil
+		}, nil
+	case db.RedirectsNone:
+		return func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown redirect policy %q", policy)
+	}
+}
+
+// ParseHeaders reads "Name: value" lines, the empty lines are skipped
+func ParseHeaders(text string) (http.Header, error) {
+	header := make(http.Header)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !validHeaderName(name) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidHeader, line)
+		}
+		value = strings.TrimSpace(value)
+		if strings.ContainsFunc(value, func(r rune) bool { return r < ' ' && r != '\t' || r == 0x7f }) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidHeader, line)
+		}
+		header.Add(name, value)
+	}
+	return header, nil
+}
+
+// validHeaderName reports whether name is a token of RFC 9110
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchKeyword(config db.CheckConfig, body []byte) error {
+	if config.Keyword == "" {
+		return nil
+	}
+
+	if !config.KeywordRegex {
+		if !strings.Contains(string(body), config.Keyword) {
+			return fmt.Errorf("keyword %q not found", config.Keyword)
+		}
+		return nil
+	}
+
+	re, err := regexp.Compile(config.Keyword)
+	if err != nil {
+		return fmt.Errorf("invalid keyword pattern: %w", err)
+	}
+	if !re.Match(body) {
+		return fmt.Errorf("pattern %q not matched", config.Keyword)
+	}
+	return nil
+}
+
+// checkTCP connects to tcp://host:port
+func (c *Checker) checkTCP(ctx context.Context, u db.URL) error {
+	addr, _, err := address(u.URL, "")
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkDNS resolves dns://name, one of the answers must be DNSExpected when
+// it is set: an address, or else the CNAME of the name
+func (c *Checker) checkDNS(ctx context.Context, u db.URL) error {
+	parsed, err := url.Parse(u.URL)
+	if err != nil {
+		return err
+	}
+	name := parsed.Hostname()
+
+	addrs, err := c.Resolver.LookupHost(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no answer for %s", name)
+	}
+
+	expected := u.DNSExpected
+	if expected == "" {
+		return nil
+	}
+
+	if ip := net.ParseIP(expected); ip != nil {
+		for _, addr := range addrs {
+			if ip.Equal(net.ParseIP(addr)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected %s, got %s", expected, strings.Join(addrs, ", "))
+	}
+
+	cname, err := c.Resolver.LookupCNAME(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSuffix(cname, "."), strings.TrimSuffix(expected, ".")) {
+		return fmt.Errorf("expected %s, got %s", expected, cname)
+	}
+	return nil
+}
+
+// checkTLS connects to tls://host[:port], port 443 by default, and warns
+// when the certificate expires within TLSWarnDays days. 0 turns the warning
+// off
+func (c *Checker) checkTLS(ctx context.Context, u db.URL, result *Result) error {
+	addr, host, err := address(u.URL, "443")
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{}
+	if c.TLSConfig != nil {
+		config = c.TLSConfig.Clone()
+	}
+	config.ServerName = host
+	config.Time = c.Now
+
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	certificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return errors.New("no certificate")
+	}
+	expiresAt := certificates[0].NotAfter
+	result.TLSExpiresAt = expiresAt
+
+	days := int(expiresAt.Sub(c.Now()).Hours() / 24)
+	if u.TLSWarnDays > 0 && days < u.TLSWarnDays {
+		result.Warning = true
+		result.Message = fmt.Sprintf("certificate expires in %d days, on %s", days, expiresAt.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// address returns the host:port and the host of a URL, the port is
+// required when defaultPort is empty
+func address(rawURL string, defaultPort string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		if defaultPort == "" {
+			return "", "", fmt.Errorf("%w in %s", ErrMissingPort, rawURL)
+		}
+		port = defaultPort
+	}
+
+	return net.JoinHostPort(host, port), host, nil
+}
+
+func milliseconds(d time.Duration) int {
+	return int(d.Milliseconds())
+}
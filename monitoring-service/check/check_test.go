@@ -0,0 +1,347 @@
+package check
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"monitoring/db"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "status: ok, version 1.2.3")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		config db.CheckConfig
+		alive  bool
+		status int
+	}{
+		{"default range", "/", db.CheckConfig{}, true, 200},
+		{"not found", "/missing", db.CheckConfig{}, false, 404},
+		{"expected not found", "/missing", db.CheckConfig{ExpectedStatusMin: 404, ExpectedStatusMax: 404}, true, 404},
+		{"keyword", "/", db.CheckConfig{Keyword: "status: ok"}, true, 200},
+		{"missing keyword", "/", db.CheckConfig{Keyword: "status: down"}, false, 200},
+		{"regex", "/", db.CheckConfig{Keyword: `version \d+\.\d+`, KeywordRegex: true}, true, 200},
+		{"regex not matched", "/", db.CheckConfig{Keyword: `version 2\.`, KeywordRegex: true}, false, 200},
+		{"invalid regex", "/", db.CheckConfig{Keyword: `(`, KeywordRegex: true}, false, 200},
+	}
+
+	checker := New()
+	for _, test := range tests {
+		test.config.CheckType = db.CheckHTTP
+		result := checker.Run(context.Background(), db.URL{ID: 1, URL: server.URL + test.path, CheckConfig: test.config})
+		if result.IsAlive != test.alive || result.StatusCode != test.status {
+			t.Errorf("%s: expected alive %v with status %d, got %+v", test.name, test.alive, test.status, result)
+		}
+		if !result.IsAlive && result.Message == "" {
+			t.Errorf("%s: expected a message for a failed check", test.name)
+		}
+		if result.URLID != 1 || result.CheckType != db.CheckHTTP {
+			t.Errorf("%s: unexpected result %+v", test.name, result)
+		}
+	}
+
+	server.Close()
+	result := checker.Run(context.Background(), db.URL{URL: server.URL})
+	if result.IsAlive || result.Message == "" {
+		t.Errorf("expected a closed server to be down, got %+v", result)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	addr := listener.Addr().String()
+
+	checker := New()
+	result := checker.Run(context.Background(), db.URL{URL: "tcp://" + addr})
+	if !result.IsAlive || result.CheckType != db.CheckTCP {
+		t.Errorf("expected the listener to be up, got %+v", result)
+	}
+
+	listener.Close()
+	result = checker.Run(context.Background(), db.URL{URL: "tcp://" + addr})
+	if result.IsAlive {
+		t.Errorf("expected a closed listener to be down")
+	}
+
+	result = checker.Run(context.Background(), db.URL{URL: "tcp://127.0.0.1"})
+	if result.IsAlive || !strings.Contains(result.Message, ErrMissingPort.Error()) {
+		t.Errorf("expected a missing port, got %+v", result)
+	}
+}
+
+type fakeResolver struct {
+	hosts map[string][]string
+	cname map[string]string
+}
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func (r fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if cname, ok := r.cname[host]; ok {
+		return cname, nil
+	}
+	return host + ".", nil
+}
+
+func TestDNS(t *testing.T) {
+	checker := New()
+	checker.Resolver = fakeResolver{
+		hosts: map[string][]string{
+			"example.com":     {"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+			"www.example.com": {"93.184.215.14"},
+		},
+		cname: map[string]string{"www.example.com": "example.com."},
+	}
+
+	tests := []struct {
+		url      string
+		expected string
+		alive    bool
+	}{
+		{"dns://example.com", "", true},
+		{"dns://example.com", "93.184.215.14", true},
+		{"dns://example.com", "2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"dns://example.com", "10.0.0.1", false},
+		{"dns://www.example.com", "example.com", true},
+		{"dns://www.example.com", "example.org.", false},
+		{"dns://missing.example.com", "", false},
+	}
+
+	for _, test := range tests {
+		u := db.URL{URL: test.url, CheckConfig: db.CheckConfig{CheckType: db.CheckDNS, DNSExpected: test.expected}}
+		result := checker.Run(context.Background(), u)
+		if result.IsAlive != test.alive {
+			t.Errorf("%s expecting %q: expected alive %v, got %+v", test.url, test.expected, test.alive, result)
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	expiresAt := server.Certificate().NotAfter
+
+	checker := New()
+	checker.TLSConfig = &tls.Config{RootCAs: roots}
+	u := db.URL{URL: "tls://" + server.Listener.Addr().String(), CheckConfig: db.CheckConfig{TLSWarnDays: 14}}
+
+	result := checker.Run(context.Background(), u)
+	if !result.IsAlive || result.Warning || !result.TLSExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected a valid certificate, got %+v", result)
+	}
+
+	// the http checks trust the same roots
+	result = checker.Run(context.Background(), db.URL{URL: server.URL})
+	if !result.IsAlive {
+		t.Errorf("expected the https server to be up, got %+v", result)
+	}
+
+	checker.Now = func() time.Time { return expiresAt.Add(-5 * 24 * time.Hour) }
+	result = checker.Run(context.Background(), u)
+	if !result.IsAlive || !result.Warning || !strings.Contains(result.Message, "expires in 5 days") {
+		t.Errorf("expected a warning 5 days before the expiry, got %+v", result)
+	}
+
+	checker.Now = func() time.Time { return expiresAt.Add(24 * time.Hour) }
+	result = checker.Run(context.Background(), u)
+	if result.IsAlive {
+		t.Errorf("expected an expired certificate to fail")
+	}
+
+	// an unknown authority fails the handshake
+	result = New().Run(context.Background(), u)
+	if result.IsAlive || !strings.Contains(result.Message, "unknown authority") {
+		t.Errorf("expected an unknown authority, got %+v", result)
+	}
+}
+
+func TestUnknownCheckType(t *testing.T) {
+	result := New().Run(context.Background(), db.URL{URL: "https://example.com", CheckConfig: db.CheckConfig{CheckType: "ftp"}})
+	if result.IsAlive || !strings.Contains(result.Message, "unknown check type") {
+		t.Errorf("expected an unknown check type, got %+v", result)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	checker := New()
+	checker.Timeout = 50 * time.Millisecond
+	result := checker.Run(context.Background(), db.URL{URL: server.URL})
+	if result.IsAlive || !strings.Contains(result.Message, context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the check to time out, got %+v", result)
+	}
+}
+
+func TestURLTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(1500 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	// the timeout of the URL replaces the one of the checker
+	checker := New()
+	checker.Timeout = 50 * time.Millisecond
+	result := checker.Run(context.Background(), db.URL{URL: server.URL, CheckConfig: db.CheckConfig{Timeout: 3}})
+	if !result.IsAlive {
+		t.Errorf("expected the timeout of the URL, got %+v", result)
+	}
+
+	checker.Timeout = DefaultTimeout
+	result = checker.Run(context.Background(), db.URL{URL: server.URL, CheckConfig: db.CheckConfig{Timeout: 1}})
+	if result.IsAlive || !strings.Contains(result.Message, context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the check to time out, got %+v", result)
+	}
+}
+
+func TestPhases(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "first part, ")
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "second part")
+	}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	checker := New()
+	checker.TLSConfig = &tls.Config{RootCAs: roots, ServerName: "example.com"}
+
+	// a name to resolve for the DNS phase, the certificate is for
+	// example.com
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	result := checker.Run(context.Background(), db.URL{URL: url, CheckConfig: db.CheckConfig{Keyword: "second part"}})
+	if !result.IsAlive {
+		t.Fatalf("expected the server to be up, got %+v", result)
+	}
+
+	if result.ResponseTimeTTFB < 50 || result.ResponseTimeTransfer < 50 {
+		t.Errorf("expected 50ms to the first byte and 50ms of transfer, got %+v", result)
+	}
+	phases := result.ResponseTimeDNS + result.ResponseTimeConnect + result.ResponseTimeTLS +
+		result.ResponseTimeTTFB + result.ResponseTimeTransfer
+	if phases > result.ResponseTime {
+		t.Errorf("expected the phases within the %dms of the check, got %dms", result.ResponseTime, phases)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "other host")
+	}))
+	defer other.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "same host") })
+	mux.Handle("/here", http.RedirectHandler("/", http.StatusFound))
+	mux.Handle("/away", http.RedirectHandler(other.URL, http.StatusFound))
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/loop", http.StatusFound) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		policy  string
+		alive   bool
+		status  int
+		keyword string
+	}{
+		{"/here", "", true, 200, "same host"},
+		{"/away", db.RedirectsFollow, true, 200, "other host"},
+		{"/here", db.RedirectsSameHost, true, 200, "same host"},
+		{"/away", db.RedirectsSameHost, true, 302, ""},
+		{"/here", db.RedirectsNone, true, 302, ""},
+		{"/loop", db.RedirectsFollow, false, 0, ""},
+		{"/", "sometimes", false, 0, ""},
+	}
+
+	checker := New()
+	for _, test := range tests {
+		config := db.CheckConfig{Redirects: test.policy, Keyword: test.keyword}
+		result := checker.Run(context.Background(), db.URL{URL: server.URL + test.path, CheckConfig: config})
+		if result.IsAlive != test.alive || result.StatusCode != test.status {
+			t.Errorf("%s with %q: expected alive %v with status %d, got %+v", test.path, test.policy, test.alive, test.status, result)
+		}
+	}
+
+	// a redirect not followed is checked against the expected range
+	config := db.CheckConfig{Redirects: db.RedirectsNone, ExpectedStatusMin: 200, ExpectedStatusMax: 299}
+	result := checker.Run(context.Background(), db.URL{URL: server.URL + "/here", CheckConfig: config})
+	if result.IsAlive {
+		t.Errorf("expected a redirect outside the range to fail")
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		fmt.Fprintf(w, "accept %s, host %s", strings.Join(r.Header.Values("Accept"), "+"), r.Host)
+	}))
+	defer server.Close()
+
+	checker := New()
+	u := db.URL{URL: server.URL, CheckConfig: db.CheckConfig{Keyword: "accept text/plain+*/*, host example.com",
+		Headers: "Authorization: Bearer token\r\n\nAccept: text/plain\nAccept:*/*\nHost: example.com\n"}}
+	if result := checker.Run(context.Background(), u); !result.IsAlive {
+		t.Errorf("expected the headers sent, got %+v", result)
+	}
+
+	u.Headers = ""
+	if result := checker.Run(context.Background(), u); result.IsAlive || result.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected no header sent, got %+v", result)
+	}
+
+	for _, headers := range []string{"Authorization", "Bad Name: value", ": value", "X-Test: a\x00b"} {
+		if _, err := ParseHeaders(headers); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("%q: expected an invalid header, got %v", headers, err)
+		}
+	}
+}
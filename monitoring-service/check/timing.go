@@ -0,0 +1,83 @@
+package check
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// timing measures the phases of a request: DNS lookup, connect, TLS
+// handshake, wait from the connection to the first byte, and transfer of
+// the body. The phases of the redirects add up, a connection reused has no
+// DNS, connect or TLS phase
+type timing struct {
+	mu sync.Mutex
+
+	dnsStart, connectStart, tlsStart, gotConn, firstByte time.Time
+	dns, connect, tls, ttfb                              time.Duration
+}
+
+// trace returns the hooks timing the requests. The dial hooks run on other
+// goroutines than the request, hence the mutex
+func (t *timing) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.start(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.done(&t.dnsStart, &t.dns) },
+		// the first attempt starts the connect phase, the one connecting
+		// ends it
+		ConnectStart: func(string, string) { t.start(&t.connectStart) },
+		ConnectDone: func(_ string, _ string, err error) {
+			if err == nil {
+				t.done(&t.connectStart, &t.connect)
+			}
+		},
+		TLSHandshakeStart: func() { t.start(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.done(&t.tlsStart, &t.tls) },
+		GotConn: func(httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			t.ttfb += t.firstByte.Sub(t.gotConn)
+			t.mu.Unlock()
+		},
+	}
+}
+
+func (t *timing) start(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+func (t *timing) done(at *time.Time, phase *time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !at.IsZero() {
+		*phase += time.Since(*at)
+		*at = time.Time{}
+	}
+}
+
+// record sets the phases of the check, the transfer lasts from the first
+// byte until now
+func (t *timing) record(result *Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result.ResponseTimeDNS = milliseconds(t.dns)
+	result.ResponseTimeConnect = milliseconds(t.connect)
+	result.ResponseTimeTLS = milliseconds(t.tls)
+	result.ResponseTimeTTFB = milliseconds(t.ttfb)
+	if !t.firstByte.IsZero() {
+		result.ResponseTimeTransfer = milliseconds(time.Since(t.firstByte))
+	}
+}
@@ -0,0 +1,204 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Incident is a period a URL was down. ResolvedAt is nil and Duration 0
+// while it is open, Duration is in seconds
+type Incident struct {
+	ID         int        `json:"id"`
+	URLID      int        `json:"urlId"`
+	URL        string     `json:"url"`
+	StartedAt  time.Time  `json:"startedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+	Duration   int        `json:"durationSeconds"`
+	Cause      string     `json:"cause"`
+	Flaps      int        `json:"flaps"`
+
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+	AcknowledgedBy string     `json:"acknowledgedBy"`
+}
+
+func (s *sqlStore) CreateIncident(urlID int, cause string, startedAt time.Time) (int, error) {
+	result, err := s.DB.Exec("INSERT INTO incidents (url_id, cause, started_at) VALUES (?, ?, ?)",
+		urlID, truncate(cause), formatTime(startedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (s *sqlStore) ResolveIncident(id int, resolvedAt time.Time, duration time.Duration) error {
+	_, err := s.DB.Exec("UPDATE incidents SET resolved_at = ?, duration_seconds = ? WHERE id = ?",
+		formatTime(resolvedAt), int(duration.Seconds()), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReopenIncident opens a resolved incident again and counts the flap
+func (s *sqlStore) ReopenIncident(id int) error {
+	_, err := s.DB.Exec("UPDATE incidents SET resolved_at = NULL, duration_seconds = NULL, flaps = flaps + 1 WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const selectIncidents = `
+	SELECT i.id, i.url_id, u.url, i.started_at, i.resolved_at, COALESCE(i.duration_seconds, 0),
+		COALESCE(i.cause, ''), i.flaps, i.acknowledged_at, COALESCE(i.acknowledged_by, '')
+	FROM incidents i
+	JOIN urls u ON u.id = i.url_id`
+
+// GetLastIncident returns the latest incident of a URL, open or not, nil
+// when it never had one
+func (s *sqlStore) GetLastIncident(urlID int) (*Incident, error) {
+	rows, err := s.DB.Query(selectIncidents+`
+		WHERE i.url_id = ?
+		ORDER BY i.started_at DESC, i.id DESC
+		LIMIT 1`, urlID)
+	if err != nil {
+		return nil, err
+	}
+
+	incidents, err := scanIncidents(rows)
+	if err != nil || len(incidents) == 0 {
+		return nil, err
+	}
+	return &incidents[0], nil
+}
+
+// GetIncidents returns the incidents of a URL overlapping the dates, or of
+// all of them when urlID is -1
+func (s *sqlStore) GetIncidents(urlID int, startDate string, endDate string) ([]Incident, error) {
+	rows, err := s.DB.Query(selectIncidents+`
+		WHERE
+			(? = -1 OR i.url_id = ?)
+			AND DATE(i.started_at) <= DATE(?)
+			AND (i.resolved_at IS NULL OR DATE(i.resolved_at) >= DATE(?))
+		ORDER BY
+			i.started_at,
+			i.id`, urlID, urlID, endDate, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanIncidents(rows)
+}
+
+func (s *sqlStore) GetIncident(id int) (Incident, error) {
+	rows, err := s.DB.Query(selectIncidents+" WHERE i.id = ?", id)
+	if err != nil {
+		return Incident{}, err
+	}
+
+	incidents, err := scanIncidents(rows)
+	if err != nil {
+		return Incident{}, err
+	}
+	if len(incidents) == 0 {
+		return Incident{}, ErrNotFound
+	}
+	return incidents[0], nil
+}
+
+func (s *sqlStore) GetOpenIncidents() ([]Incident, error) {
+	rows, err := s.DB.Query(selectIncidents + `
+		WHERE i.resolved_at IS NULL
+		ORDER BY i.started_at, i.id`)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanIncidents(rows)
+}
+
+func (s *sqlStore) AcknowledgeIncident(id int, by string, at time.Time) error {
+	_, err := s.DB.Exec("UPDATE incidents SET acknowledged_at = ?, acknowledged_by = ? WHERE id = ?",
+		formatTime(at), truncate(by), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanIncidents(rows *sql.Rows) ([]Incident, error) {
+	defer rows.Close()
+
+	incidents := []Incident{}
+	for rows.Next() {
+		var incident Incident
+		var startedAt, resolvedAt, acknowledgedAt timestamp
+		err := rows.Scan(&incident.ID, &incident.URLID, &incident.URL, &startedAt, &resolvedAt,
+			&incident.Duration, &incident.Cause, &incident.Flaps, &acknowledgedAt, &incident.AcknowledgedBy)
+		if err != nil {
+			return nil, err
+		}
+
+		incident.StartedAt = startedAt.Time
+		if resolvedAt.Valid {
+			incident.ResolvedAt = &resolvedAt.Time
+		}
+		if acknowledgedAt.Valid {
+			incident.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		incidents = append(incidents, incident)
+	}
+
+	return incidents, rows.Err()
+}
+
+// formatTime writes the times in UTC, in the format both databases read
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.DateTime)
+}
+
+// timestamp scans a TIMESTAMP column. MySQL returns text without parseTime,
+// SQLite text or a time.Time
+type timestamp struct {
+	Time  time.Time
+	Valid bool
+}
+
+var timestampFormats = []string{
+	time.DateTime,
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+}
+
+func (t *timestamp) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = v.UTC(), true
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+
+	for _, format := range timestampFormats {
+		if parsed, err := time.Parse(format, text); err == nil {
+			t.Time, t.Valid = parsed.UTC(), true
+			return nil
+		}
+	}
+	return errors.New("invalid timestamp " + text)
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations live in migrations/<dialect>/NNNN_name.sql and are applied in
+// order. The versions applied are recorded in schema_migrations
+//
+//go:embed migrations
+var migrations embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrations.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []migration
+	for _, entry := range entries {
+		name := entry.Name()
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || !strings.HasSuffix(name, ".sql") {
+			return nil, fmt.Errorf("invalid migration name %s", name)
+		}
+
+		content, err := migrations.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, migration{version, name, string(content)})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].version < list[j].version
+	})
+	return list, nil
+}
+
+// migrate applies the migrations the database has not seen yet
+func migrate(db *sql.DB, dialect string) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (version)
+		)`)
+	if err != nil {
+		return err
+	}
+
+	list, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, m := range list {
+		if applied[m.version] {
+			continue
+		}
+
+		if err := apply(db, dialect, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// addColumn matches the statements adding a column, with the table and
+// the column
+var addColumn = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+COLUMN\s+(\w+)\s`)
+
+// apply runs the statements of a migration in a transaction. MySQL commits
+// DDL statements on its own, a failed MySQL migration may be left half
+// applied and is run again from the start: its statements only add columns,
+// which are skipped when they exist, or create tables IF NOT EXISTS. A
+// column may also come from a database created by hand from data.txt
+func apply(db *sql.DB, dialect string, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(m.sql) {
+		if match := addColumn.FindStringSubmatch(statement); match != nil {
+			exists, err := columnExists(tx, dialect, match[1], match[2])
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+		}
+
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func columnExists(tx *sql.Tx, dialect, table, column string) (bool, error) {
+	query := `SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	if dialect == "sqlite" {
+		query = "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+	}
+
+	var count int
+	if err := tx.QueryRow(query, table, column).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// splitStatements splits a migration on the semicolons ending a line and
+// drops the comment lines. Triggers end their body with "END;"
+func splitStatements(content string) []string {
+	var statements []string
+	var current strings.Builder
+	inTrigger := false
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		upper := strings.ToUpper(trimmed)
+		if strings.HasPrefix(upper, "CREATE TRIGGER") {
+			inTrigger = true
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if !strings.HasSuffix(trimmed, ";") || (inTrigger && upper != "END;") {
+			continue
+		}
+
+		statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+		current.Reset()
+		inTrigger = false
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
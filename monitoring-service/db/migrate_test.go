@@ -0,0 +1,133 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	content := `-- a comment; with a semicolon
+CREATE TABLE a (
+    id INT
+);
+
+CREATE TRIGGER a_updated AFTER UPDATE ON a
+BEGIN
+    UPDATE a SET id = 1;
+END;
+ALTER TABLE a ADD COLUMN b INT`
+
+	statements := splitStatements(content)
+	if len(statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d: %q", len(statements), statements)
+	}
+	if !strings.HasSuffix(statements[1], "END") || !strings.Contains(statements[1], "SET id = 1;") {
+		t.Errorf("expected the whole trigger, got %q", statements[1])
+	}
+	if statements[2] != "ALTER TABLE a ADD COLUMN b INT" {
+		t.Errorf("expected the statement without a semicolon, got %q", statements[2])
+	}
+}
+
+// MySQL commits every DDL statement, a migration failing half way is run
+// again from the start and must not fail on what it already did
+func TestMySQLMigrationsRerunnable(t *testing.T) {
+	list, err := loadMigrations("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createTable := regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+IF\s+NOT\s+EXISTS\s`)
+	for _, m := range list {
+		for _, statement := range splitStatements(m.sql) {
+			if !addColumn.MatchString(statement) && !createTable.MatchString(statement) {
+				t.Errorf("%s: statement cannot run twice: %s", m.name, statement)
+			}
+		}
+	}
+}
+
+var (
+	createTableName = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)\s*\(`)
+	columnDefault   = regexp.MustCompile(`(?i)\sDEFAULT\s+('[^']*'|\S+)`)
+)
+
+// schemaColumns returns the columns the migrations of the dialect create,
+// as table.column, with whether they are NOT NULL and their default. The
+// types are left out, they are named differently by the dialects
+func schemaColumns(t *testing.T, dialect string) map[string]string {
+	t.Helper()
+
+	list, err := loadMigrations(dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := map[string]string{}
+	add := func(table, definition string) {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(definition), ","))
+		if len(fields) == 0 {
+			return
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PRIMARY", "INDEX", "KEY", "UNIQUE", "FOREIGN", "CONSTRAINT", ")":
+			return
+		}
+
+		rest := " " + strings.Join(fields[1:], " ")
+		value := "NULL"
+		if strings.Contains(strings.ToUpper(rest), "NOT NULL") {
+			value = "NOT NULL"
+		}
+		if match := columnDefault.FindStringSubmatch(rest); match != nil {
+			switch def := strings.ToUpper(match[1]); def {
+			case "FALSE":
+				value += " DEFAULT 0"
+			case "TRUE":
+				value += " DEFAULT 1"
+			default:
+				value += " DEFAULT " + def
+			}
+		}
+		columns[table+"."+fields[0]] = value
+	}
+
+	for _, m := range list {
+		for _, statement := range splitStatements(m.sql) {
+			if match := addColumn.FindStringSubmatchIndex(statement); match != nil {
+				table, column := statement[match[2]:match[3]], statement[match[4]:match[5]]
+				add(table, column+" "+statement[match[1]:])
+				continue
+			}
+
+			match := createTableName.FindStringSubmatch(statement)
+			if match == nil {
+				continue
+			}
+			lines := strings.Split(statement, "\n")
+			for _, line := range lines[1:] {
+				add(match[1], line)
+			}
+		}
+	}
+	return columns
+}
+
+func TestMigrationsParity(t *testing.T) {
+	mysql := schemaColumns(t, "mysql")
+	sqlite := schemaColumns(t, "sqlite")
+
+	for column, definition := range mysql {
+		if other, ok := sqlite[column]; !ok {
+			t.Errorf("%s: only in MySQL", column)
+		} else if other != definition {
+			t.Errorf("%s: %s in MySQL, %s in SQLite", column, definition, other)
+		}
+	}
+	for column := range sqlite {
+		if _, ok := mysql[column]; !ok {
+			t.Errorf("%s: only in SQLite", column)
+		}
+	}
+}
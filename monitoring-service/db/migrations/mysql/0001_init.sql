@@ -0,0 +1,55 @@
+-- Schema of the monitor. IF NOT EXISTS lets databases created by hand from
+-- data.txt adopt the migrations
+
+CREATE TABLE IF NOT EXISTS users (
+    id INT AUTO_INCREMENT,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX idx_username (username)
+);
+
+CREATE TABLE IF NOT EXISTS urls (
+    id INT AUTO_INCREMENT,
+    url VARCHAR(255) NOT NULL UNIQUE,
+    frequency INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    attemps_fails INT DEFAULT 0,
+    user_id INT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_url (url),
+    INDEX idx_frequency (frequency),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS url_health_checks (
+    id INT AUTO_INCREMENT,
+    url_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    status_code INT,
+    response_time_ms_head INT,
+    response_time_ms_ttfb INT,
+    response_time_ms_get INT,
+    is_alive BOOLEAN NOT NULL DEFAULT false,
+    error_message VARCHAR(255),
+    PRIMARY KEY (id),
+    FOREIGN KEY (url_id) REFERENCES urls(id),
+    INDEX idx_created_at (created_at),
+    INDEX idx_status_code (status_code),
+    INDEX idx_is_alive (is_alive)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id INT AUTO_INCREMENT,
+    url_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    message VARCHAR(255),
+    sent BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (id),
+    FOREIGN KEY (url_id) REFERENCES urls(id),
+    INDEX idx_created_at (created_at)
+);
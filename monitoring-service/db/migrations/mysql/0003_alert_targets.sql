@@ -0,0 +1,15 @@
+-- Where the alerts of a URL go. channel is webhook, slack or smtp, target
+-- the webhook URL or the email address. template, when set, replaces the
+-- default message template
+
+CREATE TABLE IF NOT EXISTS alert_targets (
+    id INT AUTO_INCREMENT,
+    url_id INT NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    template TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+    INDEX idx_alert_targets_url_id (url_id)
+);
@@ -0,0 +1,18 @@
+-- An incident opens after attemps_fails consecutive failures of a URL and
+-- is resolved after recovery_successes consecutive successes. A URL
+-- failing again soon after reopens its incident, flaps counts how often
+
+ALTER TABLE urls ADD COLUMN recovery_successes INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS incidents (
+    id INT AUTO_INCREMENT,
+    url_id INT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP NULL,
+    duration_seconds INT NULL,
+    cause VARCHAR(255),
+    flaps INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+    INDEX idx_incidents_url_id_started_at (url_id, started_at)
+);
@@ -0,0 +1,14 @@
+-- http checks send a single request timed by phase: DNS lookup, connect,
+-- TLS handshake, wait for the first byte and transfer of the body. The
+-- HEAD and GET times of the older checks are kept for the history.
+-- timeout_seconds 0 is the default timeout of the checker, redirects is
+-- follow, same-host or none, headers are "Name: value" lines
+
+ALTER TABLE urls ADD COLUMN timeout_seconds INT NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN redirects VARCHAR(16) NOT NULL DEFAULT 'follow';
+ALTER TABLE urls ADD COLUMN headers VARCHAR(4096) NOT NULL DEFAULT '';
+
+ALTER TABLE url_health_checks ADD COLUMN response_time_ms_dns INT;
+ALTER TABLE url_health_checks ADD COLUMN response_time_ms_connect INT;
+ALTER TABLE url_health_checks ADD COLUMN response_time_ms_tls INT;
+ALTER TABLE url_health_checks ADD COLUMN response_time_ms_transfer INT;
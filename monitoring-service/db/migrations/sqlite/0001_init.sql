@@ -0,0 +1,61 @@
+-- Schema of the monitor, the same tables as the MySQL one
+
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_username ON users (username);
+
+CREATE TRIGGER users_updated_at AFTER UPDATE ON users
+BEGIN
+    UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE TABLE urls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL UNIQUE,
+    frequency INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    attemps_fails INTEGER DEFAULT 0,
+    user_id INTEGER REFERENCES users(id)
+);
+
+CREATE INDEX idx_url ON urls (url);
+CREATE INDEX idx_frequency ON urls (frequency);
+
+CREATE TRIGGER urls_updated_at AFTER UPDATE ON urls
+BEGIN
+    UPDATE urls SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE TABLE url_health_checks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    status_code INTEGER,
+    response_time_ms_head INTEGER,
+    response_time_ms_ttfb INTEGER,
+    response_time_ms_get INTEGER,
+    is_alive BOOLEAN NOT NULL DEFAULT 0,
+    error_message TEXT
+);
+
+CREATE INDEX idx_health_checks_created_at ON url_health_checks (created_at);
+CREATE INDEX idx_status_code ON url_health_checks (status_code);
+CREATE INDEX idx_is_alive ON url_health_checks (is_alive);
+
+CREATE TABLE notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    message TEXT,
+    sent BOOLEAN NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_notifications_created_at ON notifications (created_at);
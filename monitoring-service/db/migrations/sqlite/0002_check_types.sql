@@ -0,0 +1,16 @@
+-- Check types: http, tcp, dns and tls, with their settings. Every check
+-- stores its duration in response_time_ms and why it failed in
+-- error_message, whatever its type. Databases created from data.txt
+-- already have response_time_ms, the columns found are not added again
+
+ALTER TABLE urls ADD COLUMN check_type TEXT NOT NULL DEFAULT 'http';
+ALTER TABLE urls ADD COLUMN expected_status_min INT NOT NULL DEFAULT 200;
+ALTER TABLE urls ADD COLUMN expected_status_max INT NOT NULL DEFAULT 399;
+ALTER TABLE urls ADD COLUMN keyword TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN keyword_regex BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN dns_expected TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN tls_warn_days INT NOT NULL DEFAULT 14;
+
+ALTER TABLE url_health_checks ADD COLUMN check_type TEXT NOT NULL DEFAULT 'http';
+ALTER TABLE url_health_checks ADD COLUMN response_time_ms INT;
+ALTER TABLE url_health_checks ADD COLUMN tls_expires_at TIMESTAMP NULL;
@@ -0,0 +1,14 @@
+-- Where the alerts of a URL go. channel is webhook, slack or smtp, target
+-- the webhook URL or the email address. template, when set, replaces the
+-- default message template
+
+CREATE TABLE alert_targets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL,
+    target TEXT NOT NULL,
+    template TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_alert_targets_url_id ON alert_targets (url_id);
@@ -0,0 +1,17 @@
+-- An incident opens after attemps_fails consecutive failures of a URL and
+-- is resolved after recovery_successes consecutive successes. A URL
+-- failing again soon after reopens its incident, flaps counts how often
+
+ALTER TABLE urls ADD COLUMN recovery_successes INT NOT NULL DEFAULT 1;
+
+CREATE TABLE incidents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP NULL,
+    duration_seconds INTEGER NULL,
+    cause TEXT,
+    flaps INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_incidents_url_id_started_at ON incidents (url_id, started_at);
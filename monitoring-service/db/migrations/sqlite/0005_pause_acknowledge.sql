@@ -0,0 +1,7 @@
+-- Paused URLs are not checked. Acknowledging an incident records who is
+-- taking care of it
+
+ALTER TABLE urls ADD COLUMN paused BOOLEAN NOT NULL DEFAULT 0;
+
+ALTER TABLE incidents ADD COLUMN acknowledged_at TIMESTAMP NULL;
+ALTER TABLE incidents ADD COLUMN acknowledged_by TEXT NULL;
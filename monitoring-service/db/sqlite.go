@@ -0,0 +1,32 @@
+package db
+
+import (
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite keeps the whole monitor in one file, or in memory with ":memory:"
+type SQLite struct {
+	sqlStore
+}
+
+// NewSQLite opens or creates the database file and applies the migrations
+// it misses
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	// the job checks the URLs concurrently, a single connection serializes
+	// the writes and keeps an in-memory database alive
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db, "sqlite"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLite{sqlStore{DB: db}}, nil
+}
@@ -0,0 +1,521 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *SQLite {
+	t.Helper()
+
+	store, err := NewSQLite(filepath.Join(t.TempDir(), "monitor.db"))
+	if err != nil {
+		t.Fatalf("Error opening the store: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitor.db")
+
+	// opening again must not apply the migrations twice
+	for i := 0; i < 2; i++ {
+		store, err := NewSQLite(path)
+		if err != nil {
+			t.Fatalf("Error opening the store: %v", err)
+		}
+
+		var count int
+		if err := store.DB.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		list, err := loadMigrations("sqlite")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != len(list) {
+			t.Errorf("expected %d migrations applied, got %d", len(list), count)
+		}
+		store.Close()
+	}
+
+	// both dialects ship the same versions
+	mysql, err := loadMigrations("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, _ := loadMigrations("sqlite")
+	if len(mysql) != len(sqlite) {
+		t.Fatalf("expected the same migrations, got %d for MySQL and %d for SQLite", len(mysql), len(sqlite))
+	}
+	for i := range mysql {
+		if mysql[i].version != sqlite[i].version {
+			t.Errorf("migration %d: version %d for MySQL, %d for SQLite", i, mysql[i].version, sqlite[i].version)
+		}
+	}
+}
+
+func TestMigrationsExistingColumns(t *testing.T) {
+	store := newTestStore(t)
+
+	// 0002 runs again on columns that exist, like response_time_ms in the
+	// databases created from data.txt
+	if _, err := store.DB.Exec("DELETE FROM schema_migrations WHERE version = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(store.DB, "sqlite"); err != nil {
+		t.Fatalf("Error migrating again: %v", err)
+	}
+
+	var count int
+	err := store.DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info('url_health_checks') WHERE name = 'response_time_ms'").Scan(&count)
+	if err != nil || count != 1 {
+		t.Errorf("expected response_time_ms once, got %d, %v", count, err)
+	}
+}
+
+func TestURLs(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.CreateURL("https://example.com", 5); err != nil {
+		t.Fatalf("Error creating the URL: %v", err)
+	}
+	if err := store.CreateURL("https://example.com", 5); err == nil {
+		t.Errorf("expected an error for a duplicate URL")
+	}
+	if err := store.UpdateURLFrequency("https://example.com", 10); err != nil {
+		t.Fatalf("Error updating the frequency: %v", err)
+	}
+
+	urls, err := store.GetURLs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 || urls[0].URL != "https://example.com" || urls[0].Frequency != 10 {
+		t.Errorf("unexpected URLs %+v", urls)
+	}
+	defaults := CheckConfig{CheckType: CheckHTTP, ExpectedStatusMin: 200, ExpectedStatusMax: 399, TLSWarnDays: 14,
+		Redirects: RedirectsFollow}
+	if urls[0].CheckConfig != defaults || urls[0].RecoverySuccesses != 1 {
+		t.Errorf("expected the default check %+v, got %+v", defaults, urls[0].CheckConfig)
+	}
+
+	if err := store.CreateURL("dns://example.com", 5); err != nil {
+		t.Fatal(err)
+	}
+	check := CheckConfig{CheckType: CheckDNS, ExpectedStatusMin: 200, ExpectedStatusMax: 299, Keyword: `ok\b`,
+		KeywordRegex: true, DNSExpected: "93.184.215.14", TLSWarnDays: 7, Timeout: 5, Redirects: RedirectsNone,
+		Headers: "Accept: text/plain"}
+	if err := store.UpdateURLCheck(2, check); err != nil {
+		t.Fatalf("Error updating the check: %v", err)
+	}
+	urls, _ = store.GetURLs()
+	if len(urls) != 2 || urls[1].CheckConfig != check {
+		t.Errorf("expected the check %+v, got %+v", check, urls)
+	}
+}
+
+func TestManageURLs(t *testing.T) {
+	store := newTestStore(t)
+
+	url := URL{URL: "tls://example.com", Frequency: 30, AttempsFails: 3, RecoverySuccesses: 2,
+		CheckConfig: CheckConfig{ExpectedStatusMin: 200, ExpectedStatusMax: 299, TLSWarnDays: 30}}
+	id, err := store.InsertURL(url)
+	if err != nil {
+		t.Fatalf("Error inserting the URL: %v", err)
+	}
+	if _, err := store.InsertURL(url); err == nil {
+		t.Errorf("expected an error for a duplicate URL")
+	}
+
+	got, err := store.GetURL(id)
+	if err != nil {
+		t.Fatalf("Error getting the URL: %v", err)
+	}
+	url.ID, url.CheckType, url.Redirects = id, CheckTLS, RedirectsFollow
+	if got != url {
+		t.Errorf("expected %+v, got %+v", url, got)
+	}
+	if _, err := store.GetURL(id + 1); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	url.URL, url.CheckType, url.Frequency = "tcp://example.com:22", CheckTCP, 5
+	url.Timeout, url.Redirects, url.Headers = 3, RedirectsSameHost, "X-Monitor: yes"
+	if err := store.UpdateURL(url); err != nil {
+		t.Fatalf("Error updating the URL: %v", err)
+	}
+	if err := store.SetURLPaused(id, true); err != nil {
+		t.Fatalf("Error pausing the URL: %v", err)
+	}
+	got, _ = store.GetURL(id)
+	url.Paused = true
+	if got != url {
+		t.Errorf("expected %+v, got %+v", url, got)
+	}
+
+	// the history of the URL goes with it
+	store.CreateHealthCheck(HealthCheck{URLID: id, CheckType: CheckTCP, IsAlive: true})
+	store.CreateNotifiction(id, "down")
+	store.CreateIncident(id, "refused", time.Now())
+	store.CreateAlertTarget(AlertTarget{URLID: id, Channel: "slack", Target: "https://hooks.example.com"})
+	if err := store.DeleteURL(id); err != nil {
+		t.Fatalf("Error deleting the URL: %v", err)
+	}
+	if _, err := store.GetURL(id); err != ErrNotFound {
+		t.Errorf("expected the URL deleted, got %v", err)
+	}
+	for _, table := range []string{"url_health_checks", "notifications", "incidents", "alert_targets"} {
+		var count int
+		store.DB.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
+		if count != 0 {
+			t.Errorf("expected the %s of the URL deleted, got %d", table, count)
+		}
+	}
+}
+
+func TestSaveURL(t *testing.T) {
+	store := newTestStore(t)
+
+	url := URL{URL: "https://example.com", Frequency: 30, CheckConfig: CheckConfig{Redirects: RedirectsFollow}}
+	targets := []AlertTarget{{Channel: "webhook", Target: "https://hooks.example.com"}}
+	id, err := store.SaveURL(url, targets)
+	if err != nil {
+		t.Fatalf("Error saving the URL: %v", err)
+	}
+	if got, _ := store.GetAlertTargets(id); len(got) != 1 || got[0].URLID != id {
+		t.Errorf("expected the target of the URL, got %+v", got)
+	}
+
+	// nil targets keep the ones of the URL
+	url.ID, url.Frequency = id, 60
+	if _, err := store.SaveURL(url, nil); err != nil {
+		t.Fatalf("Error saving the URL: %v", err)
+	}
+	if got, _ := store.GetAlertTargets(id); len(got) != 1 {
+		t.Errorf("expected the target kept, got %+v", got)
+	}
+
+	// the URL is not created or changed when its targets cannot be saved
+	_, err = store.DB.Exec(`CREATE TRIGGER no_targets BEFORE INSERT ON alert_targets
+		BEGIN SELECT RAISE(ABORT, 'no targets'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SaveURL(URL{URL: "https://example.org"}, targets); err == nil {
+		t.Error("expected an error saving the targets")
+	}
+	url.Frequency = 90
+	if _, err := store.SaveURL(url, targets); err == nil {
+		t.Error("expected an error saving the targets")
+	}
+
+	urls, _ := store.GetURLs()
+	if len(urls) != 1 || urls[0].Frequency != 60 {
+		t.Errorf("expected the URL unchanged, got %+v", urls)
+	}
+	if got, _ := store.GetAlertTargets(id); len(got) != 1 {
+		t.Errorf("expected the target kept, got %+v", got)
+	}
+}
+
+func TestLatestHealthChecks(t *testing.T) {
+	store := newTestStore(t)
+
+	store.CreateURL("https://example.com", 1)
+	store.CreateURL("https://example.org", 1)
+	store.CreateURL("https://example.net", 1)
+	store.CreateHealthCheck(HealthCheck{URLID: 1, CheckType: CheckHTTP, StatusCode: 200, ResponseTime: 10, IsAlive: true})
+	store.CreateHealthCheck(HealthCheck{URLID: 1, CheckType: CheckHTTP, StatusCode: 503, ResponseTime: 20, Message: "status 503"})
+	store.CreateHealthCheck(HealthCheck{URLID: 2, CheckType: CheckHTTP, StatusCode: 200, ResponseTime: 30,
+		ResponseTimeDNS: 1, ResponseTimeConnect: 2, ResponseTimeTLS: 3, ResponseTimeTTFB: 4, ResponseTimeTransfer: 5, IsAlive: true})
+
+	checks, err := store.GetLatestHealthChecks()
+	if err != nil {
+		t.Fatalf("Error getting the checks: %v", err)
+	}
+	if len(checks) != 2 {
+		t.Fatalf("expected a check for the 2 URLs checked, got %+v", checks)
+	}
+	if checks[0].URLID != 1 || checks[0].StatusCode != 503 || checks[0].IsAlive || checks[0].Message != "status 503" {
+		t.Errorf("expected the last check of the first URL, got %+v", checks[0])
+	}
+	if checks[1].URLID != 2 || checks[1].ResponseTime != 30 || checks[1].ResponseTimeDNS != 1 || checks[1].ResponseTimeConnect != 2 ||
+		checks[1].ResponseTimeTLS != 3 || checks[1].ResponseTimeTTFB != 4 || checks[1].ResponseTimeTransfer != 5 ||
+		checks[1].CheckedAt.IsZero() {
+		t.Errorf("unexpected check %+v", checks[1])
+	}
+}
+
+func TestCheckTypeFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com":    CheckHTTP,
+		"http://example.com":     CheckHTTP,
+		"tcp://example.com:5432": CheckTCP,
+		"dns://example.com":      CheckDNS,
+		"tls://example.com":      CheckTLS,
+		"ftp://example.com":      CheckHTTP,
+		"://missing-scheme":      CheckHTTP,
+	}
+	for url, expected := range tests {
+		if got := CheckTypeFromURL(url); got != expected {
+			t.Errorf("%s: expected %s, got %s", url, expected, got)
+		}
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	store := newTestStore(t)
+
+	store.CreateURL("https://example.com", 1)
+	store.CreateURL("https://example.org", 1)
+	store.DB.Exec("INSERT INTO users (username, email, password) VALUES ('admin', 'admin@example.com', 'secret')")
+	store.DB.Exec("UPDATE urls SET user_id = 1 WHERE id = 2")
+
+	if err := store.CreateNotifiction(1, "URL https://example.com is down"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateNotifiction(2, "URL https://example.org is down"); err != nil {
+		t.Fatal(err)
+	}
+
+	notifications, err := store.GetNotifications()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %+v", notifications)
+	}
+	if notifications[0].URLID != 1 || notifications[0].URL != "https://example.com" {
+		t.Errorf("unexpected URL in %+v", notifications[0])
+	}
+	if notifications[0].Email != "" || notifications[1].Email != "admin@example.com" {
+		t.Errorf("unexpected emails in %+v", notifications)
+	}
+
+	if err := store.UpdateNotificationSent(notifications[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	notifications, _ = store.GetNotifications()
+	if len(notifications) != 1 || notifications[0].ID != 2 {
+		t.Errorf("expected only the second notification left, got %+v", notifications)
+	}
+}
+
+func TestAlertTargets(t *testing.T) {
+	store := newTestStore(t)
+
+	store.CreateURL("https://example.com", 1)
+	store.CreateURL("https://example.org", 1)
+
+	targets := []AlertTarget{
+		{URLID: 1, Channel: "slack", Target: "https://hooks.slack.com/services/T000/B000/XXXX"},
+		{URLID: 1, Channel: "smtp", Target: "ops@example.com", Template: "{{.Message}}"},
+		{URLID: 2, Channel: "webhook", Target: "https://example.org/hook"},
+	}
+	for _, target := range targets {
+		if err := store.CreateAlertTarget(target); err != nil {
+			t.Fatalf("Error creating the alert target: %v", err)
+		}
+	}
+
+	got, err := store.GetAlertTargets(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 targets, got %+v", got)
+	}
+	for i := range got {
+		targets[i].ID = i + 1
+		if got[i] != targets[i] {
+			t.Errorf("expected %+v, got %+v", targets[i], got[i])
+		}
+	}
+
+	if err := store.DeleteAlertTarget(1); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = store.GetAlertTargets(1)
+	if len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("expected only the second target left, got %+v", got)
+	}
+
+	// the targets go with their URL
+	if _, err := store.DB.Exec("DELETE FROM urls WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	store.DB.QueryRow("SELECT COUNT(*) FROM alert_targets WHERE url_id = 2").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected the targets of a deleted URL to be deleted, got %d", count)
+	}
+}
+
+func TestIncidents(t *testing.T) {
+	store := newTestStore(t)
+
+	store.CreateURL("https://example.com", 1)
+	store.CreateURL("https://example.org", 1)
+
+	if incident, err := store.GetLastIncident(1); err != nil || incident != nil {
+		t.Fatalf("expected no incident, got %+v, %v", incident, err)
+	}
+
+	start := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	first, err := store.CreateIncident(1, "status 503", start)
+	if err != nil {
+		t.Fatalf("Error creating the incident: %v", err)
+	}
+	if err := store.ResolveIncident(first, start.Add(90*time.Minute), 90*time.Minute); err != nil {
+		t.Fatalf("Error resolving the incident: %v", err)
+	}
+	if err := store.ReopenIncident(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ResolveIncident(first, start.Add(25*time.Hour), 25*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := store.CreateIncident(1, "timeout", start.AddDate(0, 0, 5))
+	store.CreateIncident(2, "refused", start.AddDate(0, 1, 0))
+
+	incident, err := store.GetLastIncident(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incident.ID != second || incident.ResolvedAt != nil || incident.Cause != "timeout" || incident.URL != "https://example.com" {
+		t.Errorf("expected the open second incident, got %+v", incident)
+	}
+
+	// the first incident ends on October 2
+	incidents, err := store.GetIncidents(1, "2023-10-02", "2023-10-03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 1 || incidents[0].ID != first {
+		t.Fatalf("expected the first incident, got %+v", incidents)
+	}
+	resolvedAt := start.Add(25 * time.Hour)
+	if !incidents[0].StartedAt.Equal(start) || !incidents[0].ResolvedAt.Equal(resolvedAt) ||
+		incidents[0].Duration != 25*3600 || incidents[0].Flaps != 1 {
+		t.Errorf("unexpected incident %+v", incidents[0])
+	}
+
+	// the open incident lasts until now
+	incidents, _ = store.GetIncidents(-1, "2023-10-01", "2024-01-01")
+	if len(incidents) != 3 {
+		t.Errorf("expected all the incidents, got %+v", incidents)
+	}
+	incidents, _ = store.GetIncidents(1, "2024-01-01", "2024-01-31")
+	if len(incidents) != 1 || incidents[0].ID != second {
+		t.Errorf("expected the open incident, got %+v", incidents)
+	}
+
+	open, err := store.GetOpenIncidents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 || open[0].ID != second || open[0].AcknowledgedAt != nil {
+		t.Errorf("expected the 2 open incidents, got %+v", open)
+	}
+
+	ackAt := start.AddDate(0, 0, 6)
+	if err := store.AcknowledgeIncident(second, "alice", ackAt); err != nil {
+		t.Fatalf("Error acknowledging the incident: %v", err)
+	}
+	acknowledged, err := store.GetIncident(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acknowledged.AcknowledgedBy != "alice" || acknowledged.AcknowledgedAt == nil || !acknowledged.AcknowledgedAt.Equal(ackAt) {
+		t.Errorf("expected the incident acknowledged, got %+v", acknowledged)
+	}
+	if _, err := store.GetIncident(100); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestHistoricData(t *testing.T) {
+	store := newTestStore(t)
+
+	store.CreateURL("https://example.com", 1)
+	store.CreateURL("https://example.org", 1)
+	err := store.CreateHealthCheck(HealthCheck{URLID: 1, CheckType: CheckHTTP, StatusCode: 200, ResponseTime: 60,
+		ResponseTimeDNS: 5, ResponseTimeConnect: 10, ResponseTimeTLS: 15, ResponseTimeTTFB: 20, ResponseTimeTransfer: 10,
+		IsAlive: true})
+	if err != nil {
+		t.Fatalf("Error creating the health check: %v", err)
+	}
+	err = store.CreateHealthCheck(HealthCheck{URLID: 2, CheckType: CheckTLS, ResponseTime: 5, IsAlive: true,
+		Message: strings.Repeat("expiring ", 40), TLSExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Error creating the health check: %v", err)
+	}
+
+	// the phases of the http checks are averaged, the other checks have none
+	today := time.Now().UTC().Format(time.DateOnly)
+	data, err := store.GetHistoricDataByURLID(-1, today, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := data.Data["https://example.com"]
+	if len(day) != 1 || day[0].DNS != 5 || day[0].Connect != 10 || day[0].TLS != 15 || day[0].TTFB != 20 || day[0].Transfer != 10 {
+		t.Errorf("expected the phases of the check, got %+v", day)
+	}
+	if day := data.Data["https://example.org"]; len(day) != 1 || day[0].TTFB != 0 || day[0].ResponseTime != 5 {
+		t.Errorf("expected no phase for a tls check, got %+v", day)
+	}
+
+	checks := []struct {
+		urlID   int
+		date    string
+		get     int
+		isAlive int
+	}{
+		{1, "2023-10-01 01:00:00", 100, 1},
+		{1, "2023-10-01 02:00:00", 300, 0},
+		{1, "2023-10-02 01:00:00", 150, 1},
+		{2, "2023-10-01 01:00:00", 50, 1},
+		{2, "2023-11-01 01:00:00", 50, 1},
+	}
+	for _, c := range checks {
+		_, err := store.DB.Exec(`
+			INSERT INTO url_health_checks (url_id, created_at, status_code, response_time_ms_get, is_alive)
+			VALUES (?, ?, 200, ?, ?)`, c.urlID, c.date, c.get, c.isAlive)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err = store.GetHistoricDataByURLID(1, "2023-10-01", "2023-10-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	days := data.Data["https://example.com"]
+	if len(data.Data) != 1 || len(days) != 2 {
+		t.Fatalf("expected 2 days of one URL, got %+v", data.Data)
+	}
+	if days[0].Date != "2023-10-01" || days[0].ResponseTime != 200 || days[0].Uptime != 50 {
+		t.Errorf("unexpected first day %+v", days[0])
+	}
+
+	// response_time_ms is preferred to the GET time
+	store.DB.Exec(`
+		INSERT INTO url_health_checks (url_id, created_at, check_type, response_time_ms, is_alive)
+		VALUES (1, '2023-10-03 01:00:00', 'tcp', 40, 1)`)
+	data, _ = store.GetHistoricDataByURLID(1, "2023-10-03", "2023-10-03")
+	if days := data.Data["https://example.com"]; len(days) != 1 || days[0].ResponseTime != 40 {
+		t.Errorf("expected the tcp check time, got %+v", data.Data)
+	}
+
+	data, err = store.GetHistoricDataByURLID(-1, "2023-10-01", "2023-10-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Data) != 2 || len(data.Data["https://example.org"]) != 1 {
+		t.Errorf("expected both URLs in October, got %+v", data.Data)
+	}
+}
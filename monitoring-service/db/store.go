@@ -0,0 +1,688 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Store is the storage used by the monitor, the job, the alerts and the
+// server. Mysql and SQLite implement it
+type Store interface {
+	CreateURL(url string, frequency int) error
+	InsertURL(url URL) (int, error)
+	GetURL(id int) (URL, error)
+	GetURLs() ([]URL, error)
+	UpdateURL(url URL) error
+	SaveURL(url URL, targets []AlertTarget) (int, error)
+	UpdateURLFrequency(url string, frequency int) error
+	UpdateURLCheck(urlID int, check CheckConfig) error
+	SetURLPaused(id int, paused bool) error
+	DeleteURL(id int) error
+	CreateHealthCheck(check HealthCheck) error
+	GetLatestHealthChecks() ([]HealthCheck, error)
+	CreateNotifiction(urlID int, message string) error
+	GetNotifications() ([]Notification, error)
+	UpdateNotificationSent(id int) error
+	CreateAlertTarget(target AlertTarget) error
+	GetAlertTargets(urlID int) ([]AlertTarget, error)
+	DeleteAlertTarget(id int) error
+	ReplaceAlertTargets(urlID int, targets []AlertTarget) error
+	CreateIncident(urlID int, cause string, startedAt time.Time) (int, error)
+	ResolveIncident(id int, resolvedAt time.Time, duration time.Duration) error
+	ReopenIncident(id int) error
+	GetLastIncident(urlID int) (*Incident, error)
+	GetIncidents(urlID int, startDate string, endDate string) ([]Incident, error)
+	GetIncident(id int) (Incident, error)
+	GetOpenIncidents() ([]Incident, error)
+	AcknowledgeIncident(id int, by string, at time.Time) error
+	GetHistoricDataByURLID(urlID int, startDate string, endDate string) (ResponseData, error)
+	Close()
+}
+
+var (
+	_ Store = (*Mysql)(nil)
+	_ Store = (*SQLite)(nil)
+)
+
+var ErrNotFound = errors.New("not found")
+
+type URL struct {
+	ID                int    `json:"id"`
+	URL               string `json:"url"`
+	Frequency         int    `json:"frequency"`
+	CurrentFrequency  int    `json:"currentFrequency"`
+	AttempsFails      int    `json:"attempsFails"`
+	RecoverySuccesses int    `json:"recoverySuccesses"`
+	Paused            bool   `json:"paused"`
+	CertWarned        bool   `json:"-"`
+	CheckConfig
+}
+
+// The check types. The URL of a tcp check is tcp://host:port, of a dns
+// check dns://name and of a tls check tls://host[:port]
+const (
+	CheckHTTP = "http"
+	CheckTCP  = "tcp"
+	CheckDNS  = "dns"
+	CheckTLS  = "tls"
+)
+
+// The redirect policies of the http checks
+const (
+	RedirectsFollow   = "follow"
+	RedirectsSameHost = "same-host"
+	RedirectsNone     = "none"
+)
+
+// CheckConfig is how a URL is checked. The expected status range and the
+// keyword are for http checks, Keyword is a regular expression when
+// KeywordRegex is set. DNSExpected, when set, is an address or a CNAME one
+// of the answers must match. tls checks warn TLSWarnDays before the
+// certificate expires. Timeout is in seconds, 0 for the default of the
+// checker. Redirects and Headers are for http checks: a redirect policy,
+// follow when empty, and "Name: value" lines sent with the request
+type CheckConfig struct {
+	CheckType         string `json:"checkType"`
+	ExpectedStatusMin int    `json:"expectedStatusMin"`
+	ExpectedStatusMax int    `json:"expectedStatusMax"`
+	Keyword           string `json:"keyword"`
+	KeywordRegex      bool   `json:"keywordRegex"`
+	DNSExpected       string `json:"dnsExpected"`
+	TLSWarnDays       int    `json:"tlsWarnDays"`
+	Timeout           int    `json:"timeoutSeconds"`
+	Redirects         string `json:"redirects"`
+	Headers           string `json:"headers"`
+}
+
+// HealthCheck is the result of a check of any type. ResponseTime is the
+// whole check in milliseconds, the phases of the request are only set by
+// http checks: DNS lookup, connect, TLS handshake, wait for the first byte
+// and transfer of the body. Message says why the check failed, or warns of
+// a certificate about to expire. CheckedAt is set by the database
+type HealthCheck struct {
+	URLID                int
+	CheckType            string
+	StatusCode           int
+	ResponseTime         int
+	ResponseTimeDNS      int
+	ResponseTimeConnect  int
+	ResponseTimeTLS      int
+	ResponseTimeTTFB     int
+	ResponseTimeTransfer int
+	IsAlive              bool
+	Message              string
+	TLSExpiresAt         time.Time
+	CheckedAt            time.Time
+}
+
+// CheckTypeFromURL returns the check type of a URL from its scheme, http
+// for anything but tcp, dns and tls
+func CheckTypeFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return CheckHTTP
+	}
+
+	switch u.Scheme {
+	case CheckTCP, CheckDNS, CheckTLS:
+		return u.Scheme
+	default:
+		return CheckHTTP
+	}
+}
+
+// HistoricalData is a day of a URL, the averages of the phases are 0 for
+// the days without http checks timed by phase
+type HistoricalData struct {
+	Name         string  `json:"name"`
+	Date         string  `json:"date"`
+	ResponseTime float64 `json:"responseTime"`
+	Uptime       float64 `json:"uptime"`
+	DNS          float64 `json:"dns"`
+	Connect      float64 `json:"connect"`
+	TLS          float64 `json:"tls"`
+	TTFB         float64 `json:"ttfb"`
+	Transfer     float64 `json:"transfer"`
+}
+
+type Notification struct {
+	ID      int
+	URLID   int
+	URL     string
+	Message string
+	Sent    bool
+	Email   string
+}
+
+// AlertTarget routes the notifications of a URL to a channel: webhook,
+// slack or smtp. Target is the webhook URL or the email address. Template,
+// when set, replaces the default message template of the channel
+type AlertTarget struct {
+	ID       int    `json:"id"`
+	URLID    int    `json:"urlId"`
+	Channel  string `json:"channel"`
+	Target   string `json:"target"`
+	Template string `json:"template,omitempty"`
+}
+
+type ResponseData struct {
+	Data map[string][]HistoricalData `json:"data"`
+	URLs []URL                       `json:"urls"`
+}
+
+// OpenFromEnv opens the store selected by DB_DRIVER: "mysql", the default,
+// uses DB_HOST, DB_USER, DB_PASSWORD, DB_PORT and DB_NAME, "sqlite" uses
+// the file DB_PATH
+func OpenFromEnv() (Store, error) {
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "mysql":
+		return NewMysql(os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+	case "sqlite":
+		path := os.Getenv("DB_PATH")
+		if path == "" {
+			path = "monitor.db"
+		}
+		return NewSQLite(path)
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+}
+
+// sqlStore holds the queries both databases understand
+type sqlStore struct {
+	DB *sql.DB
+}
+
+func (s *sqlStore) CreateURL(url string, frequency int) error {
+	_, err := s.DB.Exec("INSERT INTO urls (url, frequency, check_type) VALUES (?, ?, ?)", url, frequency, CheckTypeFromURL(url))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// execer runs statements on the database or in a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// InsertURL creates a URL with its settings and returns its ID, the check
+// type is the one of the scheme and the redirects are followed when not set
+func (s *sqlStore) InsertURL(url URL) (int, error) {
+	return insertURL(s.DB, url)
+}
+
+func insertURL(db execer, url URL) (int, error) {
+	if url.CheckType == "" {
+		url.CheckType = CheckTypeFromURL(url.URL)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO urls (url, frequency, attemps_fails, recovery_successes, paused, check_type,
+			expected_status_min, expected_status_max, keyword, keyword_regex, dns_expected, tls_warn_days,
+			timeout_seconds, redirects, headers)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		url.URL, url.Frequency, url.AttempsFails, url.RecoverySuccesses, url.Paused, url.CheckType,
+		url.ExpectedStatusMin, url.ExpectedStatusMax, url.Keyword, url.KeywordRegex, url.DNSExpected, url.TLSWarnDays,
+		url.Timeout, redirects(url.Redirects), url.Headers)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+const selectURLs = `
+	SELECT id, url, frequency, COALESCE(attemps_fails, 0), recovery_successes, paused, check_type,
+		expected_status_min, expected_status_max, keyword, keyword_regex, dns_expected, tls_warn_days,
+		timeout_seconds, redirects, COALESCE(headers, '')
+	FROM urls`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanURL(row scanner) (URL, error) {
+	var url URL
+	err := row.Scan(&url.ID, &url.URL, &url.Frequency, &url.AttempsFails, &url.RecoverySuccesses, &url.Paused,
+		&url.CheckType, &url.ExpectedStatusMin, &url.ExpectedStatusMax, &url.Keyword, &url.KeywordRegex,
+		&url.DNSExpected, &url.TLSWarnDays, &url.Timeout, &url.Redirects, &url.Headers)
+	return url, err
+}
+
+func (s *sqlStore) GetURL(id int) (URL, error) {
+	url, err := scanURL(s.DB.QueryRow(selectURLs+" WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return url, ErrNotFound
+	}
+	return url, err
+}
+
+func (s *sqlStore) GetURLs() ([]URL, error) {
+	rows, err := s.DB.Query(selectURLs + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+// UpdateURL saves the settings of a URL
+func (s *sqlStore) UpdateURL(url URL) error {
+	return updateURL(s.DB, url)
+}
+
+func updateURL(db execer, url URL) error {
+	_, err := db.Exec(`
+		UPDATE urls SET url = ?, frequency = ?, attemps_fails = ?, recovery_successes = ?, paused = ?,
+			check_type = ?, expected_status_min = ?, expected_status_max = ?, keyword = ?, keyword_regex = ?,
+			dns_expected = ?, tls_warn_days = ?, timeout_seconds = ?, redirects = ?, headers = ?
+		WHERE id = ?`,
+		url.URL, url.Frequency, url.AttempsFails, url.RecoverySuccesses, url.Paused, url.CheckType,
+		url.ExpectedStatusMin, url.ExpectedStatusMax, url.Keyword, url.KeywordRegex, url.DNSExpected,
+		url.TLSWarnDays, url.Timeout, redirects(url.Redirects), url.Headers, url.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveURL creates the URL when its ID is 0 or updates it, and replaces its
+// alert targets unless targets is nil, in one transaction. It returns the
+// ID of the URL
+func (s *sqlStore) SaveURL(url URL, targets []AlertTarget) (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if url.ID == 0 {
+		url.ID, err = insertURL(tx, url)
+	} else {
+		err = updateURL(tx, url)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if targets != nil {
+		if err := replaceAlertTargets(tx, url.ID, targets); err != nil {
+			return 0, err
+		}
+	}
+
+	return url.ID, tx.Commit()
+}
+
+func (s *sqlStore) UpdateURLFrequency(url string, frequency int) error {
+	_, err := s.DB.Exec("UPDATE urls SET frequency = ? WHERE url = ?", frequency, url)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlStore) UpdateURLCheck(urlID int, check CheckConfig) error {
+	_, err := s.DB.Exec(`
+		UPDATE urls SET check_type = ?, expected_status_min = ?, expected_status_max = ?,
+			keyword = ?, keyword_regex = ?, dns_expected = ?, tls_warn_days = ?, timeout_seconds = ?,
+			redirects = ?, headers = ?
+		WHERE id = ?`,
+		check.CheckType, check.ExpectedStatusMin, check.ExpectedStatusMax, check.Keyword,
+		check.KeywordRegex, check.DNSExpected, check.TLSWarnDays, check.Timeout, redirects(check.Redirects),
+		check.Headers, urlID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlStore) SetURLPaused(id int, paused bool) error {
+	_, err := s.DB.Exec("UPDATE urls SET paused = ? WHERE id = ?", paused, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteURL deletes a URL with its checks, notifications, incidents and
+// alert targets
+func (s *sqlStore) DeleteURL(id int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"url_health_checks", "notifications", "incidents", "alert_targets"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE url_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM urls WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) CreateHealthCheck(check HealthCheck) error {
+	var expiresAt any
+	if !check.TLSExpiresAt.IsZero() {
+		expiresAt = formatTime(check.TLSExpiresAt)
+	}
+
+	var message any
+	if check.Message != "" {
+		message = truncate(check.Message)
+	}
+
+	// only the http checks are timed by phase
+	var dns, connect, tls, ttfb, transfer any
+	if check.CheckType == CheckHTTP {
+		dns, connect, tls = check.ResponseTimeDNS, check.ResponseTimeConnect, check.ResponseTimeTLS
+		ttfb, transfer = check.ResponseTimeTTFB, check.ResponseTimeTransfer
+	}
+
+	_, err := s.DB.Exec(`
+		INSERT INTO url_health_checks
+			(url_id, check_type, status_code, response_time_ms, response_time_ms_dns, response_time_ms_connect,
+				response_time_ms_tls, response_time_ms_ttfb, response_time_ms_transfer, is_alive, error_message,
+				tls_expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		check.URLID, check.CheckType, check.StatusCode, check.ResponseTime, dns, connect, tls, ttfb, transfer,
+		check.IsAlive, message, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetLatestHealthChecks returns the last check of every URL checked
+func (s *sqlStore) GetLatestHealthChecks() ([]HealthCheck, error) {
+	rows, err := s.DB.Query(`
+		SELECT h.url_id, h.check_type, COALESCE(h.status_code, 0), COALESCE(h.response_time_ms, h.response_time_ms_get, 0),
+			COALESCE(h.response_time_ms_dns, 0), COALESCE(h.response_time_ms_connect, 0), COALESCE(h.response_time_ms_tls, 0),
+			COALESCE(h.response_time_ms_ttfb, 0), COALESCE(h.response_time_ms_transfer, 0),
+			h.is_alive, COALESCE(h.error_message, ''), h.tls_expires_at, h.created_at
+		FROM url_health_checks h
+		JOIN (SELECT url_id, MAX(id) AS id FROM url_health_checks GROUP BY url_id) last ON last.id = h.id
+		ORDER BY h.url_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []HealthCheck{}
+	for rows.Next() {
+		var check HealthCheck
+		var expiresAt, checkedAt timestamp
+		err := rows.Scan(&check.URLID, &check.CheckType, &check.StatusCode, &check.ResponseTime,
+			&check.ResponseTimeDNS, &check.ResponseTimeConnect, &check.ResponseTimeTLS, &check.ResponseTimeTTFB,
+			&check.ResponseTimeTransfer, &check.IsAlive, &check.Message, &expiresAt, &checkedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		check.TLSExpiresAt = expiresAt.Time
+		check.CheckedAt = checkedAt.Time
+		checks = append(checks, check)
+	}
+
+	return checks, rows.Err()
+}
+
+func (s *sqlStore) CreateNotifiction(urlID int, message string) error {
+	_, err := s.DB.Exec("INSERT INTO notifications (url_id, message) VALUES (?, ?)", urlID, truncate(message))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetNotifications returns the notifications not sent yet, Email is empty
+// for the URLs without a user
+func (s *sqlStore) GetNotifications() ([]Notification, error) {
+	rows, err := s.DB.Query(`
+		SELECT n.id, n.url_id, urls.url, n.message, n.sent, COALESCE(users.email, '')
+		FROM notifications n
+		JOIN urls ON n.url_id = urls.id
+		LEFT JOIN users ON urls.user_id = users.id
+		WHERE n.sent = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(&notification.ID, &notification.URLID, &notification.URL, &notification.Message,
+			&notification.Sent, &notification.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *sqlStore) UpdateNotificationSent(id int) error {
+	_, err := s.DB.Exec("UPDATE notifications SET sent = 1 WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlStore) CreateAlertTarget(target AlertTarget) error {
+	var template any
+	if target.Template != "" {
+		template = target.Template
+	}
+
+	_, err := s.DB.Exec("INSERT INTO alert_targets (url_id, channel, target, template) VALUES (?, ?, ?, ?)",
+		target.URLID, target.Channel, target.Target, template)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlStore) GetAlertTargets(urlID int) ([]AlertTarget, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, url_id, channel, target, COALESCE(template, '')
+		FROM alert_targets
+		WHERE url_id = ?
+		ORDER BY id`, urlID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []AlertTarget{}
+	for rows.Next() {
+		var target AlertTarget
+		err := rows.Scan(&target.ID, &target.URLID, &target.Channel, &target.Target, &target.Template)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+func (s *sqlStore) DeleteAlertTarget(id int) error {
+	_, err := s.DB.Exec("DELETE FROM alert_targets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceAlertTargets replaces all the alert targets of a URL
+func (s *sqlStore) ReplaceAlertTargets(urlID int, targets []AlertTarget) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceAlertTargets(tx, urlID, targets); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceAlertTargets(tx execer, urlID int, targets []AlertTarget) error {
+	if _, err := tx.Exec("DELETE FROM alert_targets WHERE url_id = ?", urlID); err != nil {
+		return err
+	}
+	for _, target := range targets {
+		var template any
+		if target.Template != "" {
+			template = target.Template
+		}
+
+		_, err := tx.Exec("INSERT INTO alert_targets (url_id, channel, target, template) VALUES (?, ?, ?, ?)",
+			urlID, target.Channel, target.Target, template)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetHistoricDataByURLID returns the daily response time and uptime of a
+// URL, or of all of them when urlID is -1, with the average of each phase
+// of the http checks. The checks stored before the check types fall back
+// to their GET time
+func (s *sqlStore) GetHistoricDataByURLID(urlID int, startDate string, endDate string) (ResponseData, error) {
+	responseData := ResponseData{
+		Data: make(map[string][]HistoricalData),
+	}
+
+	var rows *sql.Rows
+	var err error
+
+	if urlID != -1 {
+		rows, err = s.DB.Query(`
+			SELECT
+				u.url AS name,
+				DATE(h.created_at) AS date,
+				COALESCE(AVG(COALESCE(h.response_time_ms, h.response_time_ms_get)), 0) AS responseTime,
+				AVG(h.is_alive) * 100 AS uptime,
+				COALESCE(AVG(h.response_time_ms_dns), 0) AS dns,
+				COALESCE(AVG(h.response_time_ms_connect), 0) AS connect,
+				COALESCE(AVG(h.response_time_ms_tls), 0) AS tls,
+				COALESCE(AVG(h.response_time_ms_ttfb), 0) AS ttfb,
+				COALESCE(AVG(h.response_time_ms_transfer), 0) AS transfer
+			FROM
+				url_health_checks h
+				JOIN urls u ON u.id = h.url_id
+			WHERE
+				h.url_id = ?
+				AND DATE(h.created_at) >= DATE(?)
+				AND DATE(h.created_at) <= DATE(?)
+			GROUP BY
+				u.url,
+				DATE(h.created_at)
+			ORDER BY
+				DATE(h.created_at)`, urlID, startDate, endDate)
+	} else {
+		rows, err = s.DB.Query(`
+			SELECT
+				u.url AS name,
+				DATE(h.created_at) AS date,
+				COALESCE(AVG(COALESCE(h.response_time_ms, h.response_time_ms_get)), 0) AS responseTime,
+				AVG(h.is_alive) * 100 AS uptime,
+				COALESCE(AVG(h.response_time_ms_dns), 0) AS dns,
+				COALESCE(AVG(h.response_time_ms_connect), 0) AS connect,
+				COALESCE(AVG(h.response_time_ms_tls), 0) AS tls,
+				COALESCE(AVG(h.response_time_ms_ttfb), 0) AS ttfb,
+				COALESCE(AVG(h.response_time_ms_transfer), 0) AS transfer
+			FROM
+				urls u
+				JOIN url_health_checks h ON u.id = h.url_id
+			WHERE
+				DATE(h.created_at) >= DATE(?)
+				AND DATE(h.created_at) <= DATE(?)
+			GROUP BY
+				u.url,
+				DATE(h.created_at)
+			ORDER BY
+				u.url,
+				DATE(h.created_at)`, startDate, endDate)
+	}
+
+	if err != nil {
+		return responseData, err
+	}
+
+	defer rows.Close()
+
+	// Process rows into grouped data
+	for rows.Next() {
+		var d HistoricalData
+		err := rows.Scan(&d.Name, &d.Date, &d.ResponseTime, &d.Uptime, &d.DNS, &d.Connect, &d.TLS, &d.TTFB, &d.Transfer)
+		if err != nil {
+			return responseData, err
+		}
+
+		responseData.Data[d.Name] = append(responseData.Data[d.Name], d)
+	}
+
+	return responseData, rows.Err()
+}
+
+func (s *sqlStore) Close() {
+	s.DB.Close()
+}
+
+// redirects returns the redirect policy stored for a policy, follow when
+// empty
+func redirects(policy string) string {
+	if policy == "" {
+		return RedirectsFollow
+	}
+	return policy
+}
+
+// truncate cuts a message to the VARCHAR(255) columns of MySQL
+func truncate(message string) string {
+	if len(message) <= 255 {
+		return message
+	}
+	return strings.ToValidUTF8(message[:255], "")
+}
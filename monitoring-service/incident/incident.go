@@ -0,0 +1,222 @@
+// Package incident turns the check results of the URLs into incidents,
+// opened after consecutive failures and resolved after consecutive
+// successes, with one notification each way
+package incident
+
+import (
+	"fmt"
+	"monitoring/db"
+	"sync"
+	"time"
+)
+
+// DefaultFlapWindow is how soon after its recovery a URL failing again
+// reopens its incident instead of opening a new one
+const DefaultFlapWindow = 10 * time.Minute
+
+// Tracker follows the consecutive failures and successes of the URLs. An
+// incident opens after AttempsFails failures, at least one, and is resolved
+// after RecoverySuccesses successes. A URL flapping, failing again within
+// FlapWindow of its recovery, reopens its incident: the first flap is
+// notified, the others are not, and the recovery is only notified once the
+// URL stayed up for FlapWindow
+type Tracker struct {
+	FlapWindow time.Duration
+	Now        func() time.Time
+
+	store  db.Store
+	mu     sync.Mutex
+	states map[int]*state
+}
+
+type state struct {
+	mu        sync.Mutex
+	loaded    bool
+	failures  int
+	successes int
+	// incident is the last incident of the URL, open while ResolvedAt is nil
+	incident        *db.Incident
+	recoveryPending bool
+}
+
+func NewTracker(store db.Store) *Tracker {
+	return &Tracker{
+		FlapWindow: DefaultFlapWindow,
+		Now:        time.Now,
+		store:      store,
+		states:     make(map[int]*state),
+	}
+}
+
+func (t *Tracker) state(urlID int) *state {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.states[urlID]
+	if !ok {
+		s = &state{}
+		t.states[urlID] = s
+	}
+	return s
+}
+
+// Forget drops the counters of a URL no longer monitored
+func (t *Tracker) Forget(urlID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.states, urlID)
+}
+
+// Observe records the result of a check of a URL, opening or resolving its
+// incident. The incident left open by a previous run is picked up
+func (t *Tracker) Observe(u db.URL, check db.HealthCheck) error {
+	s := t.state(u.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		incident, err := t.store.GetLastIncident(u.ID)
+		if err != nil {
+			return err
+		}
+		s.incident = incident
+		s.loaded = true
+	}
+
+	now := t.Now()
+	if check.IsAlive {
+		s.failures = 0
+		s.successes++
+		if s.isOpen() && s.successes >= max(1, u.RecoverySuccesses) {
+			return t.resolve(u, s, now)
+		}
+		if s.recoveryPending && now.Sub(*s.incident.ResolvedAt) >= t.FlapWindow {
+			s.recoveryPending = false
+			return t.notify(u, fmt.Sprintf("URL %s recovered after flapping %d times, down for %s",
+				u.URL, s.incident.Flaps, formatDuration(s.incident.Duration)))
+		}
+		return nil
+	}
+
+	s.successes = 0
+	s.failures++
+	if s.isOpen() || s.failures < max(1, u.AttempsFails) {
+		return nil
+	}
+	return t.open(u, s, check, now)
+}
+
+func (s *state) isOpen() bool {
+	return s.incident != nil && s.incident.ResolvedAt == nil
+}
+
+func (t *Tracker) open(u db.URL, s *state, check db.HealthCheck, now time.Time) error {
+	cause := check.Message
+	if cause == "" {
+		cause = "check failed"
+	}
+	s.recoveryPending = false
+
+	if s.incident != nil && now.Sub(*s.incident.ResolvedAt) < t.FlapWindow {
+		if err := t.store.ReopenIncident(s.incident.ID); err != nil {
+			return err
+		}
+		s.incident.ResolvedAt = nil
+		s.incident.Duration = 0
+		s.incident.Flaps++
+
+		if s.incident.Flaps > 1 {
+			return nil
+		}
+		return t.notify(u, fmt.Sprintf("URL %s is flapping, incident reopened: %s", u.URL, cause))
+	}
+
+	id, err := t.store.CreateIncident(u.ID, cause, now)
+	if err != nil {
+		return err
+	}
+	s.incident = &db.Incident{ID: id, URLID: u.ID, URL: u.URL, StartedAt: now, Cause: cause}
+
+	return t.notify(u, fmt.Sprintf("URL %s is down: %s", u.URL, cause))
+}
+
+func (t *Tracker) resolve(u db.URL, s *state, now time.Time) error {
+	duration := now.Sub(s.incident.StartedAt)
+	if err := t.store.ResolveIncident(s.incident.ID, now, duration); err != nil {
+		return err
+	}
+	s.incident.ResolvedAt = &now
+	s.incident.Duration = int(duration.Seconds())
+
+	if s.incident.Flaps > 0 {
+		s.recoveryPending = true
+		return nil
+	}
+	return t.notify(u, fmt.Sprintf("URL %s recovered, down for %s", u.URL, formatDuration(s.incident.Duration)))
+}
+
+func (t *Tracker) notify(u db.URL, message string) error {
+	fmt.Println(message)
+	return t.store.CreateNotifiction(u.ID, message)
+}
+
+func formatDuration(seconds int) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// SLA is the availability of a URL over a period, in percent
+type SLA struct {
+	URLID        int     `json:"urlId"`
+	URL          string  `json:"url"`
+	Incidents    int     `json:"incidents"`
+	Downtime     int     `json:"downtimeSeconds"`
+	Availability float64 `json:"availability"`
+}
+
+// Report returns the SLA of the URLs from the incidents between from and
+// to. The incidents are clipped to the period, the open ones last until
+// now, and the period ends now at the latest
+func Report(urls []db.URL, incidents []db.Incident, from, to, now time.Time) []SLA {
+	if to.After(now) {
+		to = now
+	}
+	period := to.Sub(from)
+
+	downtime := make(map[int]time.Duration)
+	count := make(map[int]int)
+	for _, incident := range incidents {
+		start, end := incident.StartedAt, now
+		if incident.ResolvedAt != nil {
+			end = *incident.ResolvedAt
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		downtime[incident.URLID] += end.Sub(start)
+		count[incident.URLID]++
+	}
+
+	report := make([]SLA, 0, len(urls))
+	for _, u := range urls {
+		sla := SLA{
+			URLID:        u.ID,
+			URL:          u.URL,
+			Incidents:    count[u.ID],
+			Downtime:     int(downtime[u.ID].Seconds()),
+			Availability: 100,
+		}
+		if period > 0 {
+			sla.Availability = 100 * (1 - float64(downtime[u.ID])/float64(period))
+		}
+		report = append(report, sla)
+	}
+	return report
+}
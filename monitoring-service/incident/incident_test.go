@@ -0,0 +1,217 @@
+package incident
+
+import (
+	"monitoring/db"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTracker struct {
+	*Tracker
+	t     *testing.T
+	store *db.SQLite
+	url   db.URL
+	now   time.Time
+	sent  int
+}
+
+func newTestTracker(t *testing.T) *testTracker {
+	t.Helper()
+
+	store, err := db.NewSQLite(filepath.Join(t.TempDir(), "monitor.db"))
+	if err != nil {
+		t.Fatalf("Error opening the store: %v", err)
+	}
+	t.Cleanup(store.Close)
+
+	if err := store.CreateURL("https://example.com", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := &testTracker{
+		t:     t,
+		store: store,
+		url:   db.URL{ID: 1, URL: "https://example.com", AttempsFails: 3, RecoverySuccesses: 2},
+		now:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	tt.Tracker = NewTracker(store)
+	tt.Now = func() time.Time { return tt.now }
+	return tt
+}
+
+// check observes n checks a minute apart
+func (tt *testTracker) check(alive bool, n int) {
+	tt.t.Helper()
+
+	for i := 0; i < n; i++ {
+		tt.now = tt.now.Add(time.Minute)
+		err := tt.Observe(tt.url, db.HealthCheck{URLID: tt.url.ID, IsAlive: alive, Message: "status 503, expected 200-399"})
+		if err != nil {
+			tt.t.Fatalf("Error observing the check: %v", err)
+		}
+	}
+}
+
+// expectNotifications checks the notifications created since the last call
+func (tt *testTracker) expectNotifications(prefixes ...string) {
+	tt.t.Helper()
+
+	notifications, err := tt.store.GetNotifications()
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	notifications = notifications[tt.sent:]
+	tt.sent += len(notifications)
+
+	if len(notifications) != len(prefixes) {
+		tt.t.Fatalf("expected %d notifications, got %+v", len(prefixes), notifications)
+	}
+	for i, prefix := range prefixes {
+		if !strings.HasPrefix(notifications[i].Message, prefix) {
+			tt.t.Errorf("expected a notification starting with %q, got %q", prefix, notifications[i].Message)
+		}
+	}
+}
+
+func (tt *testTracker) lastIncident() *db.Incident {
+	tt.t.Helper()
+
+	incident, err := tt.store.GetLastIncident(tt.url.ID)
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	return incident
+}
+
+func TestIncidentLifecycle(t *testing.T) {
+	tt := newTestTracker(t)
+
+	tt.check(false, 2)
+	tt.expectNotifications()
+	if tt.lastIncident() != nil {
+		t.Fatalf("expected no incident before 3 failures")
+	}
+
+	tt.check(false, 1)
+	tt.expectNotifications("URL https://example.com is down: status 503")
+	opened := tt.lastIncident()
+	if opened == nil || opened.ResolvedAt != nil || opened.Cause != "status 503, expected 200-399" {
+		t.Fatalf("expected an open incident, got %+v", opened)
+	}
+
+	// no new alert while the incident is open
+	tt.check(false, 10)
+	tt.check(true, 1)
+	tt.check(false, 5)
+	tt.expectNotifications()
+
+	tt.check(true, 2)
+	tt.expectNotifications("URL https://example.com recovered, down for 18m0s")
+	resolved := tt.lastIncident()
+	if resolved.ID != opened.ID || resolved.ResolvedAt == nil || resolved.Duration != 18*60 || resolved.Flaps != 0 {
+		t.Errorf("expected the incident resolved after 18 minutes, got %+v", resolved)
+	}
+
+	// failing again after the flap window opens a new incident
+	tt.check(true, 20)
+	tt.check(false, 3)
+	tt.expectNotifications("URL https://example.com is down")
+	if incident := tt.lastIncident(); incident.ID == opened.ID {
+		t.Errorf("expected a new incident")
+	}
+}
+
+func TestFlapping(t *testing.T) {
+	tt := newTestTracker(t)
+
+	tt.check(false, 3)
+	tt.check(true, 2)
+	tt.expectNotifications("URL https://example.com is down", "URL https://example.com recovered")
+	first := tt.lastIncident()
+
+	// failing within the flap window reopens the incident
+	tt.check(false, 3)
+	tt.expectNotifications("URL https://example.com is flapping, incident reopened")
+	incident := tt.lastIncident()
+	if incident.ID != first.ID || incident.ResolvedAt != nil || incident.Flaps != 1 {
+		t.Fatalf("expected the first incident reopened, got %+v", incident)
+	}
+
+	// the next flaps and their recoveries are silent
+	for i := 0; i < 3; i++ {
+		tt.check(true, 2)
+		tt.check(false, 3)
+	}
+	tt.check(true, 2)
+	tt.expectNotifications()
+	if incident := tt.lastIncident(); incident.ID != first.ID || incident.Flaps != 4 || incident.ResolvedAt == nil {
+		t.Fatalf("expected 4 flaps of the first incident, got %+v", incident)
+	}
+
+	// the recovery is notified once the URL stayed up for the window
+	tt.check(true, 9)
+	tt.expectNotifications()
+	tt.check(true, 1)
+	tt.expectNotifications("URL https://example.com recovered after flapping 4 times, down for 22m0s")
+	tt.check(true, 20)
+	tt.expectNotifications()
+}
+
+func TestFlapWindowDisabled(t *testing.T) {
+	tt := newTestTracker(t)
+	tt.FlapWindow = 0
+
+	tt.check(false, 3)
+	tt.check(true, 2)
+	tt.check(false, 3)
+	tt.expectNotifications("URL https://example.com is down", "URL https://example.com recovered", "URL https://example.com is down")
+}
+
+func TestTrackerRestart(t *testing.T) {
+	tt := newTestTracker(t)
+	tt.url.AttempsFails = 0
+
+	tt.check(false, 1)
+	tt.expectNotifications("URL https://example.com is down")
+
+	// a new tracker picks up the open incident
+	tt.Tracker = NewTracker(tt.store)
+	tt.Now = func() time.Time { return tt.now }
+	tt.check(false, 3)
+	tt.expectNotifications()
+	tt.check(true, 2)
+	tt.expectNotifications("URL https://example.com recovered, down for 5m0s")
+}
+
+func TestReport(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC) }
+	resolved := func(t time.Time) *time.Time { return &t }
+
+	urls := []db.URL{{ID: 1, URL: "https://example.com"}, {ID: 2, URL: "https://example.org"}, {ID: 3, URL: "https://example.net"}}
+	incidents := []db.Incident{
+		// clipped to the start of the period
+		{URLID: 1, StartedAt: day(1, 0), ResolvedAt: resolved(day(2, 6))},
+		{URLID: 1, StartedAt: day(3, 0), ResolvedAt: resolved(day(3, 6))},
+		// still open, clipped to now
+		{URLID: 2, StartedAt: day(5, 12)},
+		// out of the period
+		{URLID: 3, StartedAt: day(1, 0), ResolvedAt: resolved(day(1, 12))},
+	}
+
+	report := Report(urls, incidents, day(2, 0), day(7, 0), day(6, 0))
+	expected := []SLA{
+		{URLID: 1, URL: "https://example.com", Incidents: 2, Downtime: 12 * 3600, Availability: 87.5},
+		{URLID: 2, URL: "https://example.org", Incidents: 1, Downtime: 12 * 3600, Availability: 87.5},
+		{URLID: 3, URL: "https://example.net", Incidents: 0, Downtime: 0, Availability: 100},
+	}
+	if len(report) != len(expected) {
+		t.Fatalf("expected %d SLAs, got %+v", len(expected), report)
+	}
+	for i := range expected {
+		if report[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], report[i])
+		}
+	}
+}
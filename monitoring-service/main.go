@@ -144,7 +144,7 @@ func (m model) View() string {
 	) + "\n"
 }
 
-var myDB *db.Mysql
+var myDB db.Store
 
 func main() {
 	err := godotenv.Load()
@@ -152,14 +152,8 @@ func main() {
 		log.Fatalf("Error loading .env file")
 	}
 
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	port := os.Getenv("DB_PORT")
-	database := os.Getenv("DB_NAME")
-
 	var dbErr error
-	myDB, dbErr = db.NewMysql(host, user, password, port, database)
+	myDB, dbErr = db.OpenFromEnv()
 	if dbErr != nil {
 		panic(dbErr)
 	}
@@ -178,6 +172,19 @@ func main() {
 	// 	panic(err)
 	// }
 
+	defer myDB.Close()
+
+	if len(os.Args) > 1 {
+		if os.Args[1] != "serve" {
+			fmt.Fprintln(os.Stderr, "usage: monitor [serve]")
+			os.Exit(2)
+		}
+		if err := serve(myDB); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	p := tea.NewProgram(initialModel())
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monitoring/db"
+	"time"
+)
+
+const (
+	// DefaultDeliverInterval is how often Run looks for notifications to
+	// send
+	DefaultDeliverInterval = 5 * time.Second
+
+	// MaxDeliverAttempts is how many times a notification no target
+	// received is sent, about a minute at the default interval
+	MaxDeliverAttempts = 12
+)
+
+// Deliver sends the notifications not sent yet and marks them sent. A
+// notification nobody can receive is dropped, it would be stale by the
+// time a target is added. A notification is sent once at least one target
+// received it, sending it again would repeat it to that target. The
+// others are tried again next time, up to MaxDeliverAttempts times
+func (r *Router) Deliver(ctx context.Context, store db.Store) error {
+	notifications, err := store.GetNotifications()
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		targets, err := store.GetAlertTargets(notification.URLID)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		sent, err := r.Send(ctx, notification, targets)
+		if err != nil {
+			fmt.Println(err)
+			if sent == 0 && !errors.Is(err, ErrNoTarget) && r.retry(notification.ID) {
+				continue
+			}
+		}
+		delete(r.attempts, notification.ID)
+
+		err = store.UpdateNotificationSent(notification.ID)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return nil
+}
+
+// retry counts a failed delivery and reports whether the notification is
+// tried again
+func (r *Router) retry(id int) bool {
+	if r.attempts == nil {
+		r.attempts = make(map[int]int)
+	}
+	r.attempts[id]++
+	if r.attempts[id] < MaxDeliverAttempts {
+		return true
+	}
+
+	fmt.Printf("Dropping notification %d after %d attempts\n", id, MaxDeliverAttempts)
+	return false
+}
+
+// Run delivers the notifications every interval until the context is done
+func (r *Router) Run(ctx context.Context, store db.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Deliver(ctx, store); err != nil && ctx.Err() == nil {
+				fmt.Println("Error delivering the notifications:", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package notify sends the alerts of the monitor to webhooks, Slack
+// compatible incoming webhooks and email over SMTP
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monitoring/db"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+	ChannelSMTP    = "smtp"
+)
+
+// The templates are text/template templates of an Alert
+const (
+	DefaultSubject  = "Monitor system alert: {{.URL}}"
+	DefaultTemplate = `{{.Message}} ({{.Time.Format "2006-01-02 15:04:05 MST"}})`
+)
+
+var (
+	ErrUnknownChannel = errors.New("unknown channel")
+	ErrNoTarget       = errors.New("no alert target")
+)
+
+// Alert is the data the templates render
+type Alert struct {
+	URLID   int
+	URL     string
+	Message string
+	Time    time.Time
+}
+
+// Message is an alert rendered for a target
+type Message struct {
+	Subject string
+	Body    string
+	Alert   Alert
+}
+
+// Notifier sends a message to a target of its channel, a webhook URL or an
+// email address
+type Notifier interface {
+	Notify(ctx context.Context, target string, message Message) error
+}
+
+// Router sends the notifications to the alert targets of their URL, with
+// the notifier of each target channel
+type Router struct {
+	Notifiers map[string]Notifier
+	Now       func() time.Time
+
+	attempts map[int]int // failed deliveries of the notifications, by id
+}
+
+// FromEnv returns a router with the webhook and Slack notifiers, and the
+// SMTP notifier when SMTP_HOST is set. SMTP_PORT defaults to 25, SMTP_FROM
+// to monitor@localhost, SMTP_USERNAME and SMTP_PASSWORD are optional
+func FromEnv() *Router {
+	client := &http.Client{Timeout: 10 * time.Second}
+	router := &Router{
+		Notifiers: map[string]Notifier{
+			ChannelWebhook: &Webhook{Client: client},
+			ChannelSlack:   &Slack{Client: client},
+		},
+		Now: time.Now,
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "25"
+		}
+		from := os.Getenv("SMTP_FROM")
+		if from == "" {
+			from = "monitor@localhost"
+		}
+
+		router.Notifiers[ChannelSMTP] = &SMTP{
+			Addr:     host + ":" + port,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+
+	return router
+}
+
+// Send sends a notification to every target and returns how many were
+// sent. A URL without targets falls back to the email of its user. The
+// targets that failed are joined in the error, ErrNoTarget when there is
+// no notifier for any of them, like for the email without SMTP_HOST
+func (r *Router) Send(ctx context.Context, notification db.Notification, targets []db.AlertTarget) (int, error) {
+	if len(targets) == 0 && notification.Email != "" {
+		targets = []db.AlertTarget{{URLID: notification.URLID, Channel: ChannelSMTP, Target: notification.Email}}
+	}
+
+	usable := 0
+	for _, target := range targets {
+		if _, ok := r.Notifiers[target.Channel]; ok {
+			usable++
+		}
+	}
+	if len(targets) == 0 {
+		return 0, fmt.Errorf("%w for %s", ErrNoTarget, notification.URL)
+	}
+	if usable == 0 {
+		return 0, fmt.Errorf("%w for %s, no notifier for its channels", ErrNoTarget, notification.URL)
+	}
+
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+	alert := Alert{
+		URLID:   notification.URLID,
+		URL:     notification.URL,
+		Message: notification.Message,
+		Time:    now(),
+	}
+
+	sent := 0
+	var errs []error
+	for _, target := range targets {
+		if err := r.sendTo(ctx, target, alert); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", target.Channel, target.Target, err))
+			continue
+		}
+		sent++
+	}
+
+	return sent, errors.Join(errs...)
+}
+
+func (r *Router) sendTo(ctx context.Context, target db.AlertTarget, alert Alert) error {
+	notifier, ok := r.Notifiers[target.Channel]
+	if !ok {
+		return ErrUnknownChannel
+	}
+
+	text := target.Template
+	if text == "" {
+		text = DefaultTemplate
+	}
+	body, err := Render(text, alert)
+	if err != nil {
+		return err
+	}
+	subject, err := Render(DefaultSubject, alert)
+	if err != nil {
+		return err
+	}
+
+	return notifier.Notify(ctx, target.Target, Message{Subject: subject, Body: body, Alert: alert})
+}
+
+// Render executes a template of an alert
+func Render(text string, alert Alert) (string, error) {
+	tmpl, err := template.New("alert").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, alert); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,374 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"monitoring/db"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var alertTime = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+// hookServer records the bodies posted to it, by path
+type hookServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies map[string][]byte
+}
+
+func newHookServer(t *testing.T) *hookServer {
+	t.Helper()
+
+	s := &hookServer{bodies: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "no", http.StatusInternalServerError)
+			return
+		}
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies[r.URL.Path] = body
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *hookServer) body(path string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies[path]
+}
+
+// fakeSMTP is a minimal SMTP server keeping the last mail it received
+type fakeSMTP struct {
+	listener net.Listener
+	mu       sync.Mutex
+	from     string
+	to       []string
+	data     string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(strings.TrimSpace(line)[10:], "<>")
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.mu.Lock()
+			s.to = append(s.to, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) mail() (string, []string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.from, s.to, s.data
+}
+
+func newTestRouter(smtpAddr string) *Router {
+	return &Router{
+		Notifiers: map[string]Notifier{
+			ChannelWebhook: &Webhook{},
+			ChannelSlack:   &Slack{},
+			ChannelSMTP:    &SMTP{Addr: smtpAddr, From: "monitor@example.com"},
+		},
+		Now: func() time.Time { return alertTime },
+	}
+}
+
+var testNotification = db.Notification{ID: 1, URLID: 7, URL: "https://example.com", Message: "URL https://example.com is down"}
+
+func TestWebhook(t *testing.T) {
+	hooks := newHookServer(t)
+	router := newTestRouter("")
+
+	targets := []db.AlertTarget{{URLID: 7, Channel: ChannelWebhook, Target: hooks.URL + "/hook"}}
+	if _, err := router.Send(context.Background(), testNotification, targets); err != nil {
+		t.Fatalf("Error sending the webhook: %v", err)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(hooks.body("/hook"), &payload); err != nil {
+		t.Fatal(err)
+	}
+	expected := webhookPayload{
+		Subject: "Monitor system alert: https://example.com",
+		Text:    "URL https://example.com is down (2024-03-01 12:30:00 UTC)",
+		URLID:   7,
+		URL:     "https://example.com",
+		Message: "URL https://example.com is down",
+		Time:    alertTime,
+	}
+	if payload != expected {
+		t.Errorf("expected %+v, got %+v", expected, payload)
+	}
+
+	targets[0].Target = hooks.URL + "/fail"
+	_, err := router.Send(context.Background(), testNotification, targets)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("expected the failing webhook in the error, got %v", err)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	hooks := newHookServer(t)
+	router := newTestRouter("")
+
+	targets := []db.AlertTarget{{
+		URLID:    7,
+		Channel:  ChannelSlack,
+		Target:   hooks.URL + "/services/T000/B000/XXXX",
+		Template: ":rotating_light: <{{.URL}}> {{.Message}}",
+	}}
+	if _, err := router.Send(context.Background(), testNotification, targets); err != nil {
+		t.Fatalf("Error sending to Slack: %v", err)
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(hooks.body("/services/T000/B000/XXXX"), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["text"] != ":rotating_light: <https://example.com> URL https://example.com is down" || len(payload) != 1 {
+		t.Errorf("unexpected Slack payload %v", payload)
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	server := newFakeSMTP(t)
+	router := newTestRouter(server.listener.Addr().String())
+
+	targets := []db.AlertTarget{{URLID: 7, Channel: ChannelSMTP, Target: "ops@example.com"}}
+	if _, err := router.Send(context.Background(), testNotification, targets); err != nil {
+		t.Fatalf("Error sending the email: %v", err)
+	}
+
+	from, to, data := server.mail()
+	if from != "monitor@example.com" || len(to) != 1 || to[0] != "ops@example.com" {
+		t.Errorf("unexpected envelope from %s to %v", from, to)
+	}
+	for _, expected := range []string{
+		"To: ops@example.com\r\n",
+		"Subject: Monitor system alert: https://example.com\r\n",
+		"\r\n\r\nURL https://example.com is down (2024-03-01 12:30:00 UTC)\r\n",
+	} {
+		if !strings.Contains(data, expected) {
+			t.Errorf("expected %q in the email:\n%s", expected, data)
+		}
+	}
+}
+
+func TestFallbackEmail(t *testing.T) {
+	server := newFakeSMTP(t)
+	router := newTestRouter(server.listener.Addr().String())
+
+	notification := testNotification
+	notification.Email = "owner@example.com"
+	if _, err := router.Send(context.Background(), notification, nil); err != nil {
+		t.Fatalf("Error sending the email: %v", err)
+	}
+	if _, to, _ := server.mail(); len(to) != 1 || to[0] != "owner@example.com" {
+		t.Errorf("expected the email of the user, got %v", to)
+	}
+
+	_, err := router.Send(context.Background(), testNotification, nil)
+	if !errors.Is(err, ErrNoTarget) {
+		t.Errorf("expected ErrNoTarget, got %v", err)
+	}
+
+	// without SMTP_HOST nobody can receive the email
+	delete(router.Notifiers, ChannelSMTP)
+	if _, err := router.Send(context.Background(), notification, nil); !errors.Is(err, ErrNoTarget) {
+		t.Errorf("expected ErrNoTarget without SMTP, got %v", err)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	hooks := newHookServer(t)
+	router := newTestRouter("")
+
+	targets := []db.AlertTarget{
+		{Channel: "pager", Target: "123"},
+		{Channel: ChannelWebhook, Target: hooks.URL + "/bad-template", Template: "{{.Missing}}"},
+		{Channel: ChannelWebhook, Target: hooks.URL + "/hook"},
+	}
+	sent, err := router.Send(context.Background(), testNotification, targets)
+	if sent != 1 {
+		t.Errorf("expected 1 target sent, got %d", sent)
+	}
+	if !errors.Is(err, ErrUnknownChannel) || !strings.Contains(err.Error(), "Missing") {
+		t.Errorf("expected the unknown channel and the template errors, got %v", err)
+	}
+
+	// the valid target is sent anyway
+	if hooks.body("/hook") == nil {
+		t.Errorf("expected the valid webhook to be sent")
+	}
+	if hooks.body("/bad-template") != nil {
+		t.Errorf("expected no request for an invalid template")
+	}
+}
+
+func TestRender(t *testing.T) {
+	alert := Alert{URLID: 7, URL: "https://example.com", Message: "down", Time: alertTime}
+
+	tests := []struct {
+		template string
+		expected string
+		err      bool
+	}{
+		{DefaultTemplate, "down (2024-03-01 12:30:00 UTC)", false},
+		{"{{.URL}} #{{.URLID}}: {{.Message}}", "https://example.com #7: down", false},
+		{"{{.Message", "", true},
+		{"{{.Nope}}", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := Render(test.template, alert)
+		if (err != nil) != test.err || got != test.expected {
+			t.Errorf("%q: expected %q, got %q with error %v", test.template, test.expected, got, err)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	hooks := newHookServer(t)
+	router := newTestRouter("")
+
+	store, err := db.NewSQLite(filepath.Join(t.TempDir(), "monitor.db"))
+	if err != nil {
+		t.Fatalf("Error opening the store: %v", err)
+	}
+	defer store.Close()
+
+	store.CreateURL("https://example.com", 1)
+	store.CreateURL("https://example.org", 1)
+	store.CreateURL("https://example.net", 1)
+	store.CreateURL("https://example.edu", 1)
+	store.CreateURL("https://example.info", 1)
+	store.CreateAlertTarget(db.AlertTarget{URLID: 1, Channel: ChannelWebhook, Target: hooks.URL + "/hook"})
+	store.CreateAlertTarget(db.AlertTarget{URLID: 2, Channel: ChannelWebhook, Target: hooks.URL + "/fail"})
+	store.CreateAlertTarget(db.AlertTarget{URLID: 4, Channel: ChannelWebhook, Target: hooks.URL + "/other"})
+	store.CreateAlertTarget(db.AlertTarget{URLID: 4, Channel: ChannelWebhook, Target: hooks.URL + "/fail"})
+	store.CreateNotifiction(1, "URL https://example.com is down")
+	store.CreateNotifiction(2, "URL https://example.org is down")
+	store.CreateNotifiction(3, "URL https://example.net is down")
+	store.CreateNotifiction(4, "URL https://example.edu is down")
+	store.CreateNotifiction(5, "URL https://example.info is down")
+
+	// the email of the owner cannot be sent without SMTP
+	delete(router.Notifiers, ChannelSMTP)
+	if _, err := store.DB.Exec("INSERT INTO users (username, email, password) VALUES ('owner', 'owner@example.com', 'x')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DB.Exec("UPDATE urls SET user_id = 1 WHERE id = 5"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := router.Deliver(context.Background(), store); err != nil {
+		t.Fatalf("Error delivering the notifications: %v", err)
+	}
+	if hooks.body("/hook") == nil {
+		t.Errorf("expected the webhook to be called")
+	}
+
+	if hooks.body("/other") == nil {
+		t.Errorf("expected the webhook of the partly failing notification to be called")
+	}
+
+	// the failed one is left for the next time, the ones without target
+	// and the one received by a target are done
+	notifications, _ := store.GetNotifications()
+	if len(notifications) != 1 || notifications[0].URLID != 2 {
+		t.Errorf("expected only the failed notification left, got %+v", notifications)
+	}
+
+	// and dropped after MaxDeliverAttempts
+	for i := 1; i < MaxDeliverAttempts; i++ {
+		if err := router.Deliver(context.Background(), store); err != nil {
+			t.Fatalf("Error delivering the notifications: %v", err)
+		}
+	}
+	if notifications, _ := store.GetNotifications(); len(notifications) != 0 {
+		t.Errorf("expected the failed notification dropped, got %+v", notifications)
+	}
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook posts the alerts as JSON to any URL
+type Webhook struct {
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	Subject string    `json:"subject"`
+	Text    string    `json:"text"`
+	URLID   int       `json:"urlId"`
+	URL     string    `json:"url"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+func (w *Webhook) Notify(ctx context.Context, target string, message Message) error {
+	return postJSON(ctx, w.Client, target, webhookPayload{
+		Subject: message.Subject,
+		Text:    message.Body,
+		URLID:   message.Alert.URLID,
+		URL:     message.Alert.URL,
+		Message: message.Alert.Message,
+		Time:    message.Alert.Time,
+	})
+}
+
+// Slack posts the alerts to a Slack compatible incoming webhook, Mattermost
+// and Rocket.Chat understand the same payload
+type Slack struct {
+	Client *http.Client
+}
+
+func (s *Slack) Notify(ctx context.Context, target string, message Message) error {
+	return postJSON(ctx, s.Client, target, map[string]string{"text": message.Body})
+}
+
+func postJSON(ctx context.Context, client *http.Client, target string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package scheduler checks every URL at its frequency, reloading the URL
+// list so the URLs added, removed or changed are picked up while running
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"monitoring/check"
+	"monitoring/db"
+	"monitoring/incident"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultInterval       = 1 * time.Second
+	DefaultReloadInterval = 5 * time.Second
+)
+
+// Scheduler ticks every Interval, a URL skips Frequency ticks between two
+// checks so it is checked every Frequency+1 ticks. The URLs are read again from the store every ReloadInterval, or
+// when Reload is called. The paused URLs are left out
+type Scheduler struct {
+	Interval       time.Duration
+	ReloadInterval time.Duration
+	Checker        *check.Checker
+	Tracker        *incident.Tracker
+
+	store     db.Store
+	mu        sync.RWMutex
+	urls      map[int]db.URL
+	running   map[int]bool // URLs being checked, by id
+	checks    sync.WaitGroup
+	reloadNow chan struct{}
+}
+
+func New(store db.Store) *Scheduler {
+	return &Scheduler{
+		Interval:       DefaultInterval,
+		ReloadInterval: DefaultReloadInterval,
+		Checker:        check.New(),
+		Tracker:        incident.NewTracker(store),
+		store:          store,
+		urls:           make(map[int]db.URL),
+		running:        make(map[int]bool),
+		reloadNow:      make(chan struct{}, 1),
+	}
+}
+
+// Run checks the URLs until the context is done, it waits for the checks
+// running then. Only the first load of the URLs is fatal
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	reload := time.NewTicker(s.ReloadInterval)
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tick(ctx)
+		case <-reload.C:
+			if err := s.reload(); err != nil {
+				fmt.Println("Error reloading the URLs:", err)
+			}
+		case <-s.reloadNow:
+			if err := s.reload(); err != nil {
+				fmt.Println("Error reloading the URLs:", err)
+			}
+		case <-ctx.Done():
+			s.checks.Wait()
+			return nil
+		}
+	}
+}
+
+// Reload asks Run to read the URLs again without waiting for
+// ReloadInterval, it does not block
+func (s *Scheduler) Reload() {
+	select {
+	case s.reloadNow <- struct{}{}:
+	default:
+	}
+}
+
+// URLs returns the URLs scheduled, with their counters
+func (s *Scheduler) URLs() []db.URL {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urls := make([]db.URL, 0, len(s.urls))
+	for _, url := range s.urls {
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+// reload replaces the URLs by the ones of the store. The URLs kept keep
+// their counters, a new URL is checked on the next tick and a URL whose
+// frequency went below its counter too
+func (s *Scheduler) reload() error {
+	urls, err := s.store.GetURLs()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fresh := make(map[int]db.URL, len(urls))
+	for _, url := range urls {
+		if url.Paused {
+			continue
+		}
+
+		old, ok := s.urls[url.ID]
+		switch {
+		case !ok, old.CurrentFrequency > url.Frequency:
+			url.CurrentFrequency = url.Frequency
+		default:
+			url.CurrentFrequency = old.CurrentFrequency
+		}
+		url.CertWarned = old.CertWarned
+		fresh[url.ID] = url
+	}
+
+	for id := range s.urls {
+		if _, ok := fresh[id]; !ok {
+			s.Tracker.Forget(id)
+		}
+	}
+	s.urls = fresh
+	return nil
+}
+
+// tick starts the checks of the URLs due and counts down the others. It
+// does not wait for the checks, a slow URL delays neither the others nor
+// the reloads. A URL still being checked when due again is checked on the
+// tick after its check ends
+func (s *Scheduler) tick(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, url := range s.urls {
+		if url.CurrentFrequency < url.Frequency {
+			url.CurrentFrequency++
+			s.urls[id] = url
+			continue
+		}
+		if s.running[id] {
+			continue
+		}
+
+		url.CurrentFrequency = 0
+		s.urls[id] = url
+		s.running[id] = true
+
+		s.checks.Add(1)
+		go func(url db.URL) {
+			defer s.checks.Done()
+			s.checkURL(ctx, &url)
+
+			// a URL changed or removed by a reload during the check stays so
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.running, url.ID)
+			if current, ok := s.urls[url.ID]; ok {
+				current.CertWarned = url.CertWarned
+				s.urls[url.ID] = current
+			}
+		}(url)
+	}
+}
+
+func (s *Scheduler) checkURL(ctx context.Context, url *db.URL) {
+	result := s.Checker.Run(ctx, *url)
+
+	// a check cut by the shutdown says nothing about the URL
+	if ctx.Err() != nil {
+		return
+	}
+
+	if !result.IsAlive {
+		fmt.Println(url.URL, result.Message)
+	}
+	if err := s.Tracker.Observe(*url, result.HealthCheck); err != nil {
+		fmt.Println(err)
+	}
+
+	// warn once, not on every check until the certificate is renewed
+	if result.Warning && !url.CertWarned {
+		err := s.store.CreateNotifiction(url.ID, "URL "+url.URL+": "+result.Message)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	url.CertWarned = result.Warning
+
+	if err := s.store.CreateHealthCheck(result.HealthCheck); err != nil {
+		fmt.Println(err)
+	}
+}
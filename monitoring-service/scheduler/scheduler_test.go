@@ -0,0 +1,226 @@
+package scheduler
+
+import (
+	"context"
+	"monitoring/db"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hits counts the GET requests by path
+type hits struct {
+	mu    sync.Mutex
+	paths map[string]int
+}
+
+func (h *hits) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		h.mu.Lock()
+		h.paths[r.URL.Path]++
+		h.mu.Unlock()
+	}
+}
+
+func (h *hits) count(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.paths[path]
+}
+
+func newTestScheduler(t *testing.T) (*Scheduler, *db.SQLite, *hits, string) {
+	t.Helper()
+
+	store, err := db.NewSQLite(filepath.Join(t.TempDir(), "monitor.db"))
+	if err != nil {
+		t.Fatalf("Error opening the store: %v", err)
+	}
+	t.Cleanup(store.Close)
+
+	h := &hits{paths: make(map[string]int)}
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	return New(store), store, h, server.URL
+}
+
+// tick runs a tick of the scheduler and waits for the checks it started
+func tick(s *Scheduler, ctx context.Context) {
+	s.tick(ctx)
+	s.checks.Wait()
+}
+
+func TestReload(t *testing.T) {
+	s, store, h, base := newTestScheduler(t)
+	ctx := context.Background()
+
+	store.CreateURL(base+"/a", 0)
+	store.CreateURL(base+"/b", 2)
+	if err := s.reload(); err != nil {
+		t.Fatalf("Error loading the URLs: %v", err)
+	}
+
+	// the new URLs are checked on the first tick, then every frequency
+	for i := 0; i < 6; i++ {
+		tick(s, ctx)
+	}
+	if h.count("/a") != 6 || h.count("/b") != 2 {
+		t.Errorf("expected 6 checks of /a and 2 of /b, got %d and %d", h.count("/a"), h.count("/b"))
+	}
+
+	// a URL added while running is picked up
+	store.CreateURL(base+"/c", 5)
+	s.reload()
+	tick(s, ctx)
+	if h.count("/c") != 1 {
+		t.Errorf("expected the new URL checked, got %d checks", h.count("/c"))
+	}
+
+	// lowering the frequency under the ticks already counted checks on the
+	// next tick
+	store.UpdateURLFrequency(base+"/c", 10)
+	s.reload()
+	for i := 0; i < 3; i++ {
+		tick(s, ctx)
+	}
+	store.UpdateURLFrequency(base+"/c", 1)
+	s.reload()
+	tick(s, ctx)
+	if h.count("/c") != 2 {
+		t.Errorf("expected the new frequency of /c, got %d checks", h.count("/c"))
+	}
+
+	// a URL removed is not checked anymore
+	checked := h.count("/a")
+	store.DB.Exec("DELETE FROM url_health_checks WHERE url_id = 1")
+	if _, err := store.DB.Exec("DELETE FROM urls WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	s.reload()
+	tick(s, ctx)
+	if h.count("/a") != checked {
+		t.Errorf("expected no check of a removed URL, got %d more", h.count("/a")-checked)
+	}
+	if urls := s.URLs(); len(urls) != 2 {
+		t.Errorf("expected 2 URLs scheduled, got %+v", urls)
+	}
+
+	var checks int
+	store.DB.QueryRow("SELECT COUNT(*) FROM url_health_checks").Scan(&checks)
+	if checks != h.count("/b")+h.count("/c") {
+		t.Errorf("expected a health check stored by check, got %d", checks)
+	}
+}
+
+func TestIncidents(t *testing.T) {
+	s, store, _, base := newTestScheduler(t)
+	ctx := context.Background()
+
+	store.CreateURL(base+"/missing-keyword", 0)
+	store.UpdateURLCheck(1, db.CheckConfig{CheckType: db.CheckHTTP, Keyword: "ok"})
+	s.reload()
+	tick(s, ctx)
+	tick(s, ctx)
+
+	notifications, _ := store.GetNotifications()
+	if len(notifications) != 1 {
+		t.Errorf("expected one notification for the incident, got %+v", notifications)
+	}
+	incident, _ := store.GetLastIncident(1)
+	if incident == nil || incident.ResolvedAt != nil {
+		t.Errorf("expected an open incident, got %+v", incident)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, store, h, base := newTestScheduler(t)
+	s.Interval = 10 * time.Millisecond
+	s.ReloadInterval = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	store.CreateURL(base+"/late", 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for h.count("/late") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if h.count("/late") == 0 {
+		t.Errorf("expected the URL added while running to be checked")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Error running the scheduler: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the scheduler to stop")
+	}
+}
+
+func running(s *Scheduler, id int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.running[id]
+}
+
+func TestSlowCheck(t *testing.T) {
+	s, store, h, base := newTestScheduler(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+
+	store.CreateURL(slow.URL+"/slow", 0)
+	store.CreateURL(base+"/fast", 0)
+	s.reload()
+
+	// the ticks go on while /slow is checked, without checking it again
+	for i := 0; i < 3; i++ {
+		s.tick(ctx)
+		deadline := time.Now().Add(5 * time.Second)
+		for (h.count("/fast") != i+1 || running(s, 2)) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if h.count("/fast") != 3 || h.count("/slow") != 1 {
+		t.Errorf("expected 3 checks of /fast and 1 of /slow, got %d and %d", h.count("/fast"), h.count("/slow"))
+	}
+
+	close(release)
+	s.checks.Wait()
+	tick(s, ctx)
+	if h.count("/slow") != 2 {
+		t.Errorf("expected /slow checked again once done, got %d checks", h.count("/slow"))
+	}
+}
+
+func TestPause(t *testing.T) {
+	s, store, h, base := newTestScheduler(t)
+	ctx := context.Background()
+
+	store.CreateURL(base+"/paused", 0)
+	store.SetURLPaused(1, true)
+	s.reload()
+	tick(s, ctx)
+	if h.count("/paused") != 0 || len(s.URLs()) != 0 {
+		t.Errorf("expected a paused URL not to be checked")
+	}
+
+	store.SetURLPaused(1, false)
+	s.reload()
+	tick(s, ctx)
+	if h.count("/paused") != 1 {
+		t.Errorf("expected a resumed URL to be checked")
+	}
+}
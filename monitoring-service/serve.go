@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monitoring/db"
+	"monitoring/notify"
+	"monitoring/scheduler"
+	"monitoring/server"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+// serve runs the scheduler, the notifications and the dashboard together
+// until SIGINT or SIGTERM. The dashboard listens on PORT, 8080 by default,
+// and serves the files of PUBLIC_DIR, public by default
+func serve(myDB db.Store) error {
+	signals, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(signals)
+	defer cancel()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	publicDir := os.Getenv("PUBLIC_DIR")
+	if publicDir == "" {
+		publicDir = "public"
+	}
+
+	sched := scheduler.New(myDB)
+	dashboard := server.New(myDB, publicDir)
+	dashboard.Changed = sched.Reload
+
+	httpServer := &http.Server{Addr: ":" + port, Handler: dashboard}
+	router := notify.FromEnv()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		if err := sched.Run(ctx); err != nil {
+			errs <- fmt.Errorf("scheduler: %w", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		router.Run(ctx, myDB, notify.DefaultDeliverInterval)
+	}()
+	go func() {
+		defer wg.Done()
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("dashboard: %w", err)
+		}
+	}()
+
+	fmt.Printf("Monitor is running, dashboard on port %s\n", port)
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	fmt.Println("Shutting down")
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if shutdownErr := httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+		fmt.Println("Error stopping the dashboard:", shutdownErr)
+	}
+	wg.Wait()
+
+	// the last checks may have opened or resolved incidents
+	if deliverErr := router.Deliver(shutdownCtx, myDB); deliverErr != nil {
+		fmt.Println("Error delivering the notifications:", deliverErr)
+	}
+
+	return err
+}
@@ -0,0 +1,485 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"monitoring/db"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+const maxBodySize = 1 << 20
+
+// urlResource is a URL as the API returns it. Retries is how many
+// consecutive failures open an incident
+type urlResource struct {
+	ID                int    `json:"id"`
+	URL               string `json:"url"`
+	Frequency         int    `json:"frequency"`
+	Retries           int    `json:"retries"`
+	RecoverySuccesses int    `json:"recoverySuccesses"`
+	Paused            bool   `json:"paused"`
+	db.CheckConfig
+	AlertTargets []targetResource `json:"alertTargets"`
+}
+
+// urlInput is a URL as the API reads it, AlertTargets replaces the targets
+// of the URL when it is set
+type urlInput struct {
+	URL               string `json:"url"`
+	Frequency         int    `json:"frequency"`
+	Retries           int    `json:"retries"`
+	RecoverySuccesses int    `json:"recoverySuccesses"`
+	Paused            bool   `json:"paused"`
+	db.CheckConfig
+	AlertTargets *[]targetResource `json:"alertTargets"`
+}
+
+type targetResource struct {
+	Channel  string `json:"channel"`
+	Target   string `json:"target"`
+	Template string `json:"template,omitempty"`
+}
+
+// statusResource is the current state of a URL: paused, pending before its
+// first check, up, failing before an incident opens, or down
+type statusResource struct {
+	ID        int            `json:"id"`
+	URL       string         `json:"url"`
+	CheckType string         `json:"checkType"`
+	Status    string         `json:"status"`
+	LastCheck *checkResource `json:"lastCheck"`
+	Incident  *db.Incident   `json:"incident"`
+}
+
+type checkResource struct {
+	CheckedAt    time.Time  `json:"checkedAt"`
+	IsAlive      bool       `json:"isAlive"`
+	StatusCode   int        `json:"statusCode"`
+	ResponseTime int        `json:"responseTimeMs"`
+	Message      string     `json:"message,omitempty"`
+	TLSExpiresAt *time.Time `json:"tlsExpiresAt,omitempty"`
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+
+	s.mux.HandleFunc("GET /api/urls", s.listURLs)
+	s.mux.HandleFunc("POST /api/urls", s.createURL)
+	s.mux.HandleFunc("GET /api/urls/{id}", s.getURL)
+	s.mux.HandleFunc("PATCH /api/urls/{id}", s.updateURL)
+	s.mux.HandleFunc("DELETE /api/urls/{id}", s.deleteURL)
+	s.mux.HandleFunc("POST /api/urls/{id}/pause", s.pauseURL(true))
+	s.mux.HandleFunc("POST /api/urls/{id}/resume", s.pauseURL(false))
+	s.mux.HandleFunc("GET /api/status", s.status)
+	s.mux.HandleFunc("GET /api/incidents", s.listIncidents)
+	s.mux.HandleFunc("POST /api/incidents/{id}/acknowledge", s.acknowledgeIncident)
+
+	// not the dashboard
+	s.mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
+	})
+}
+
+func (s *Server) changed() {
+	if s.Changed != nil {
+		s.Changed()
+	}
+}
+
+func (s *Server) listURLs(w http.ResponseWriter, r *http.Request) {
+	urls, err := s.store.GetURLs()
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+
+	resources := make([]urlResource, 0, len(urls))
+	for _, u := range urls {
+		resource, err := s.resource(u)
+		if err != nil {
+			s.internalError(w, err)
+			return
+		}
+		resources = append(resources, resource)
+	}
+
+	writeJSON(w, http.StatusOK, resources)
+}
+
+func (s *Server) createURL(w http.ResponseWriter, r *http.Request) {
+	in := urlInput{
+		Frequency:         60,
+		Retries:           1,
+		RecoverySuccesses: 1,
+		CheckConfig: db.CheckConfig{
+			ExpectedStatusMin: 200,
+			ExpectedStatusMax: 399,
+			TLSWarnDays:       14,
+			Redirects:         db.RedirectsFollow,
+		},
+	}
+	if !s.readInput(w, r, &in) {
+		return
+	}
+	if !s.checkUnique(w, in.URL, 0) {
+		return
+	}
+
+	u := in.url(db.URL{})
+	id, err := s.store.SaveURL(u, in.targets(0))
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	s.changed()
+
+	u.ID = id
+	resource, err := s.resource(u)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/urls/%d", id))
+	writeJSON(w, http.StatusCreated, resource)
+}
+
+func (s *Server) getURL(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.findURL(w, r)
+	if !ok {
+		return
+	}
+
+	resource, err := s.resource(u)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// updateURL changes the fields of the body, the others keep their value
+func (s *Server) updateURL(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.findURL(w, r)
+	if !ok {
+		return
+	}
+
+	// the check type follows the URL unless the body sets it
+	config := u.CheckConfig
+	config.CheckType = ""
+	in := urlInput{
+		URL:               u.URL,
+		Frequency:         u.Frequency,
+		Retries:           u.AttempsFails,
+		RecoverySuccesses: u.RecoverySuccesses,
+		Paused:            u.Paused,
+		CheckConfig:       config,
+	}
+	if !s.readInput(w, r, &in) {
+		return
+	}
+	if !s.checkUnique(w, in.URL, u.ID) {
+		return
+	}
+
+	u = in.url(u)
+	if _, err := s.store.SaveURL(u, in.targets(u.ID)); err != nil {
+		s.internalError(w, err)
+		return
+	}
+	s.changed()
+
+	resource, err := s.resource(u)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resource)
+}
+
+func (s *Server) deleteURL(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.findURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteURL(u.ID); err != nil {
+		s.internalError(w, err)
+		return
+	}
+	s.changed()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) pauseURL(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := s.findURL(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.store.SetURLPaused(u.ID, paused); err != nil {
+			s.internalError(w, err)
+			return
+		}
+		s.changed()
+
+		u.Paused = paused
+		resource, err := s.resource(u)
+		if err != nil {
+			s.internalError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resource)
+	}
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	urls, err := s.store.GetURLs()
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	checks, err := s.store.GetLatestHealthChecks()
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	incidents, err := s.store.GetOpenIncidents()
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+
+	lastChecks := make(map[int]db.HealthCheck, len(checks))
+	for _, check := range checks {
+		lastChecks[check.URLID] = check
+	}
+	openIncidents := make(map[int]db.Incident, len(incidents))
+	for _, incident := range incidents {
+		openIncidents[incident.URLID] = incident
+	}
+
+	statuses := make([]statusResource, 0, len(urls))
+	for _, u := range urls {
+		status := statusResource{ID: u.ID, URL: u.URL, CheckType: u.CheckType}
+
+		if check, ok := lastChecks[u.ID]; ok {
+			status.LastCheck = &checkResource{
+				CheckedAt:    check.CheckedAt,
+				IsAlive:      check.IsAlive,
+				StatusCode:   check.StatusCode,
+				ResponseTime: check.ResponseTime,
+				Message:      check.Message,
+			}
+			if !check.TLSExpiresAt.IsZero() {
+				status.LastCheck.TLSExpiresAt = &check.TLSExpiresAt
+			}
+		}
+		if incident, ok := openIncidents[u.ID]; ok {
+			status.Incident = &incident
+		}
+
+		switch {
+		case u.Paused:
+			status.Status = "paused"
+		case status.Incident != nil:
+			status.Status = "down"
+		case status.LastCheck == nil:
+			status.Status = "pending"
+		case !status.LastCheck.IsAlive:
+			status.Status = "failing"
+		default:
+			status.Status = "up"
+		}
+		statuses = append(statuses, status)
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) listIncidents(w http.ResponseWriter, r *http.Request) {
+	incidents, err := s.store.GetOpenIncidents()
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, incidents)
+}
+
+// acknowledgeIncident records who takes care of an open incident, the body
+// {"by": "name"} is optional
+func (s *Server) acknowledgeIncident(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	var in struct {
+		By string `json:"by"`
+	}
+	if r.ContentLength != 0 && !s.readInput(w, r, &in) {
+		return
+	}
+	if len(in.By) > maxTextLength {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("by: is longer than %d characters", maxTextLength))
+		return
+	}
+
+	incident, err := s.store.GetIncident(id)
+	if errors.Is(err, db.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "incident not found")
+		return
+	}
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	if incident.ResolvedAt != nil {
+		writeError(w, http.StatusConflict, "incident already resolved")
+		return
+	}
+
+	if err := s.store.AcknowledgeIncident(id, in.By, time.Now()); err != nil {
+		s.internalError(w, err)
+		return
+	}
+
+	incident, err = s.store.GetIncident(id)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, incident)
+}
+
+// findURL returns the URL of the id in the path, or answers 400 or 404
+func (s *Server) findURL(w http.ResponseWriter, r *http.Request) (db.URL, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "id must be an integer")
+		return db.URL{}, false
+	}
+
+	u, err := s.store.GetURL(id)
+	if errors.Is(err, db.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "url not found")
+		return u, false
+	}
+	if err != nil {
+		s.internalError(w, err)
+		return u, false
+	}
+	return u, true
+}
+
+// checkUnique answers 409 when another URL than id has the same address
+func (s *Server) checkUnique(w http.ResponseWriter, address string, id int) bool {
+	urls, err := s.store.GetURLs()
+	if err != nil {
+		s.internalError(w, err)
+		return false
+	}
+
+	for _, u := range urls {
+		if u.URL == address && u.ID != id {
+			writeError(w, http.StatusConflict, "url already monitored")
+			return false
+		}
+	}
+	return true
+}
+
+// readInput decodes the body over the defaults of v and validates the URL
+// inputs, or answers 400
+func (s *Server) readInput(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+
+	if in, ok := v.(*urlInput); ok {
+		if err := validateURL(in); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) resource(u db.URL) (urlResource, error) {
+	targets, err := s.store.GetAlertTargets(u.ID)
+	if err != nil {
+		return urlResource{}, err
+	}
+
+	resource := urlResource{
+		ID:                u.ID,
+		URL:               u.URL,
+		Frequency:         u.Frequency,
+		Retries:           u.AttempsFails,
+		RecoverySuccesses: u.RecoverySuccesses,
+		Paused:            u.Paused,
+		CheckConfig:       u.CheckConfig,
+		AlertTargets:      make([]targetResource, 0, len(targets)),
+	}
+	for _, target := range targets {
+		resource.AlertTargets = append(resource.AlertTargets, targetResource{target.Channel, target.Target, target.Template})
+	}
+	return resource, nil
+}
+
+// url returns u with the fields of the input
+func (in urlInput) url(u db.URL) db.URL {
+	u.URL = in.URL
+	u.Frequency = in.Frequency
+	u.AttempsFails = in.Retries
+	u.RecoverySuccesses = in.RecoverySuccesses
+	u.Paused = in.Paused
+	u.CheckConfig = in.CheckConfig
+	return u
+}
+
+// targets returns the alert targets of the body, nil when it has none so
+// the targets of the URL are kept
+func (in urlInput) targets(urlID int) []db.AlertTarget {
+	if in.AlertTargets == nil {
+		return nil
+	}
+
+	targets := make([]db.AlertTarget, 0, len(*in.AlertTargets))
+	for _, target := range *in.AlertTargets {
+		targets = append(targets, db.AlertTarget{URLID: urlID, Channel: target.Channel, Target: target.Target, Template: target.Template})
+	}
+	return targets
+}
+
+func (s *Server) internalError(w http.ResponseWriter, err error) {
+	fmt.Println(err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
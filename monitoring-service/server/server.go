@@ -1,40 +1,37 @@
-package main
+// Package server serves the dashboard of the monitor and its data
+package server
 
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"monitoring/db"
+	"monitoring/incident"
 	"net/http"
-	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
-
-	"github.com/joho/godotenv"
+	"time"
 )
 
-func main() {
-
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Fatalf("Error loading .env file")
-	}
+// Server serves the dashboard and the REST API under /api. Changed, when
+// set, is called after the API changed the URLs
+type Server struct {
+	Changed func()
 
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	port := os.Getenv("DB_PORT")
-	database := os.Getenv("DB_NAME")
+	store db.Store
+	mux   *http.ServeMux
+}
 
-	myDB, err := db.NewMysql(host, user, password, port, database)
-	if err != nil {
-		panic(err)
-	}
+// New returns the server of a store, chart.html is read from publicDir
+func New(myDB db.Store, publicDir string) *Server {
+	s := &Server{store: myDB, mux: http.NewServeMux()}
+	mux := s.mux
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "../public/chart.html")
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(publicDir, "chart.html"))
 	})
 
-	http.HandleFunc("/historical-data", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/historical-data", func(w http.ResponseWriter, r *http.Request) {
 		// get id query parameter
 		id := r.URL.Query().Get("id")
 		if id == "" {
@@ -80,10 +77,54 @@ func main() {
 
 	})
 
-	port = "8080"
+	mux.HandleFunc("/sla", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "id parameter must be an integer", http.StatusBadRequest)
+			return
+		}
+
+		startDate := r.URL.Query().Get("start")
+		from, err := time.Parse(time.DateOnly, startDate)
+		if err != nil {
+			http.Error(w, "start parameter must be a date", http.StatusBadRequest)
+			return
+		}
+		endDate := r.URL.Query().Get("end")
+		to, err := time.Parse(time.DateOnly, endDate)
+		if err != nil {
+			http.Error(w, "end parameter must be a date", http.StatusBadRequest)
+			return
+		}
+
+		incidents, err := myDB.GetIncidents(id, startDate, endDate)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "error getting incidents", http.StatusInternalServerError)
+			return
+		}
+
+		urls, err := myDB.GetURLs()
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "error getting urls", http.StatusInternalServerError)
+			return
+		}
+		if id != -1 {
+			urls = slices.DeleteFunc(urls, func(u db.URL) bool { return u.ID != id })
+		}
+
+		// the end date is included
+		report := incident.Report(urls, incidents, from, to.AddDate(0, 0, 1), time.Now())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"sla": report, "incidents": incidents})
+	})
+
+	s.routes()
+	return s
+}
 
-	fmt.Printf("Server is running on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		fmt.Printf("Error starting server: %s\n", err)
-	}
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
 }
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"monitoring/db"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*Server, *db.SQLite) {
+	t.Helper()
+
+	store, err := db.NewSQLite(filepath.Join(t.TempDir(), "monitor.db"))
+	if err != nil {
+		t.Fatalf("Error opening the store: %v", err)
+	}
+	t.Cleanup(store.Close)
+
+	return New(store, t.TempDir()), store
+}
+
+// do sends a request to the server and decodes the JSON answer into v
+func do(t *testing.T, s *Server, method string, path string, body string, v any) int {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if v != nil && w.Body.Len() > 0 {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("Error decoding %s %s: %v", method, path, err)
+		}
+	}
+	return w.Code
+}
+
+func TestURLs(t *testing.T) {
+	s, _ := newTestServer(t)
+	var changes int
+	s.Changed = func() { changes++ }
+
+	var created urlResource
+	body := `{"url": "https://example.com", "frequency": 30, "keyword": "ok",
+		"alertTargets": [{"channel": "slack", "target": "https://hooks.example.com/x"}]}`
+	if code := do(t, s, "POST", "/api/urls", body, &created); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	expected := urlResource{ID: 1, URL: "https://example.com", Frequency: 30, Retries: 1, RecoverySuccesses: 1,
+		CheckConfig: db.CheckConfig{CheckType: db.CheckHTTP, ExpectedStatusMin: 200, ExpectedStatusMax: 399,
+			Keyword: "ok", TLSWarnDays: 14, Redirects: db.RedirectsFollow},
+		AlertTargets: []targetResource{{Channel: "slack", Target: "https://hooks.example.com/x"}}}
+	if !equal(created, expected) {
+		t.Errorf("expected %+v, got %+v", expected, created)
+	}
+
+	var conflict map[string]string
+	if code := do(t, s, "POST", "/api/urls", `{"url": "https://example.com"}`, &conflict); code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate URL, got %d", code)
+	}
+	if conflict["error"] == "" {
+		t.Errorf("expected an error message, got %+v", conflict)
+	}
+
+	// the omitted fields keep their value, the alert targets too
+	var updated urlResource
+	body = `{"frequency": 5, "retries": 3, "timeoutSeconds": 20, "redirects": "none", "headers": "Accept: text/html"}`
+	if code := do(t, s, "PATCH", "/api/urls/1", body, &updated); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	expected.Frequency, expected.Retries = 5, 3
+	expected.Timeout, expected.Redirects, expected.Headers = 20, db.RedirectsNone, "Accept: text/html"
+	if !equal(updated, expected) {
+		t.Errorf("expected %+v, got %+v", expected, updated)
+	}
+
+	// changing the scheme changes the check type
+	if code := do(t, s, "PATCH", "/api/urls/1", `{"url": "tls://example.com", "alertTargets": []}`, &updated); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if updated.CheckType != db.CheckTLS || len(updated.AlertTargets) != 0 {
+		t.Errorf("expected a tls check without alert targets, got %+v", updated)
+	}
+
+	var fetched urlResource
+	if code := do(t, s, "GET", "/api/urls/1", "", &fetched); code != http.StatusOK || !equal(fetched, updated) {
+		t.Errorf("expected %+v, got %d %+v", updated, code, fetched)
+	}
+	var list []urlResource
+	if code := do(t, s, "GET", "/api/urls", "", &list); code != http.StatusOK || len(list) != 1 {
+		t.Errorf("expected one URL, got %d %+v", code, list)
+	}
+
+	if code := do(t, s, "DELETE", "/api/urls/1", "", nil); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	for _, method := range []string{"GET", "DELETE"} {
+		if code := do(t, s, method, "/api/urls/1", "", nil); code != http.StatusNotFound {
+			t.Errorf("expected 404 for %s of a deleted URL, got %d", method, code)
+		}
+	}
+	if code := do(t, s, "GET", "/api/urls/x", "", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid id, got %d", code)
+	}
+	if code := do(t, s, "GET", "/api/unknown", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown route, got %d", code)
+	}
+	if code := do(t, s, "GET", "/api/urls", "", &list); code != http.StatusOK || len(list) != 0 {
+		t.Errorf("expected no URL, got %d %+v", code, list)
+	}
+
+	if changes != 4 {
+		t.Errorf("expected Changed called after the 4 changes, got %d", changes)
+	}
+}
+
+func equal(a, b urlResource) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+func TestValidation(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		body  string
+		field string
+	}{
+		{`{}`, "url"},
+		{`{"url": "example.com"}`, "url"},
+		{`{"url": "ftp://example.com"}`, "url"},
+		{`{"url": "tcp://example.com"}`, "url"},
+		{`{"url": "https://` + strings.Repeat("a", 255) + `.com"}`, "url"},
+		{`{"url": "https://example.com", "checkType": "dns"}`, "checkType"},
+		{`{"url": "https://example.com", "frequency": -1}`, "frequency"},
+		{`{"url": "https://example.com", "retries": 1000}`, "retries"},
+		{`{"url": "https://example.com", "recoverySuccesses": -1}`, "recoverySuccesses"},
+		{`{"url": "https://example.com", "expectedStatusMin": 400, "expectedStatusMax": 300}`, "expectedStatusMin"},
+		{`{"url": "https://example.com", "expectedStatusMax": 600}`, "expectedStatusMin"},
+		{`{"url": "https://example.com", "keyword": "(", "keywordRegex": true}`, "keyword"},
+		{`{"url": "tls://example.com", "tlsWarnDays": 400}`, "tlsWarnDays"},
+		{`{"url": "https://example.com", "timeoutSeconds": 121}`, "timeoutSeconds"},
+		{`{"url": "https://example.com", "redirects": "sometimes"}`, "redirects"},
+		{`{"url": "https://example.com", "headers": "Accept text/html"}`, "headers"},
+		{`{"url": "https://example.com", "headers": "X-Test: ` + strings.Repeat("a", 4096) + `"}`, "headers"},
+		{`{"url": "https://example.com", "alertTargets": [{"channel": "sms", "target": "123"}]}`, "alertTargets[0]"},
+		{`{"url": "https://example.com", "alertTargets": [{"channel": "webhook", "target": "example.com"}]}`, "alertTargets[0]"},
+		{`{"url": "https://example.com", "alertTargets": [{"channel": "smtp", "target": "Ops <ops@example.com>"}]}`, "alertTargets[0]"},
+		{`{"url": "https://example.com", "alertTargets": [{"channel": "smtp", "target": "ops@example.com", "template": "{{.Missing}}"}]}`, "alertTargets[0]"},
+		{`{"url": "https://example.com", "unknown": 1}`, "invalid JSON"},
+		{`{"url": `, "invalid JSON"},
+	}
+
+	for _, test := range tests {
+		var answer map[string]string
+		if code := do(t, s, "POST", "/api/urls", test.body, &answer); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", test.body, code)
+			continue
+		}
+		if !strings.HasPrefix(answer["error"], test.field) {
+			t.Errorf("%s: expected an error on %s, got %q", test.body, test.field, answer["error"])
+		}
+	}
+
+	var list []urlResource
+	do(t, s, "GET", "/api/urls", "", &list)
+	if len(list) != 0 {
+		t.Errorf("expected no URL created, got %+v", list)
+	}
+
+	// a PATCH is validated with the values it keeps
+	do(t, s, "POST", "/api/urls", `{"url": "https://example.com", "expectedStatusMax": 299}`, nil)
+	if code := do(t, s, "PATCH", "/api/urls/1", `{"expectedStatusMin": 300}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", code)
+	}
+}
+
+func TestPauseAndStatus(t *testing.T) {
+	s, store := newTestServer(t)
+	var changes int
+	s.Changed = func() { changes++ }
+
+	for _, u := range []string{"https://up.example.com", "https://failing.example.com", "https://down.example.com",
+		"https://pending.example.com", "https://paused.example.com"} {
+		do(t, s, "POST", "/api/urls", `{"url": "`+u+`"}`, nil)
+	}
+	store.CreateHealthCheck(db.HealthCheck{URLID: 1, CheckType: db.CheckHTTP, StatusCode: 200, ResponseTime: 12, IsAlive: true})
+	store.CreateHealthCheck(db.HealthCheck{URLID: 2, CheckType: db.CheckHTTP, StatusCode: 503, Message: "status 503"})
+	store.CreateHealthCheck(db.HealthCheck{URLID: 3, CheckType: db.CheckHTTP, StatusCode: 503, Message: "status 503"})
+	store.CreateIncident(3, "status 503", time.Now())
+
+	var paused urlResource
+	if code := do(t, s, "POST", "/api/urls/5/pause", "", &paused); code != http.StatusOK || !paused.Paused {
+		t.Errorf("expected the URL paused, got %d %+v", code, paused)
+	}
+	if code := do(t, s, "POST", "/api/urls/9/pause", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+
+	var statuses []statusResource
+	if code := do(t, s, "GET", "/api/status", "", &statuses); code != http.StatusOK || len(statuses) != 5 {
+		t.Fatalf("expected the status of the 5 URLs, got %d %+v", code, statuses)
+	}
+	for i, expected := range []string{"up", "failing", "down", "pending", "paused"} {
+		if statuses[i].Status != expected {
+			t.Errorf("expected %s to be %s, got %s", statuses[i].URL, expected, statuses[i].Status)
+		}
+	}
+	if statuses[0].LastCheck == nil || statuses[0].LastCheck.ResponseTime != 12 {
+		t.Errorf("expected the last check, got %+v", statuses[0].LastCheck)
+	}
+	if statuses[2].Incident == nil || statuses[2].Incident.Cause != "status 503" {
+		t.Errorf("expected the open incident, got %+v", statuses[2].Incident)
+	}
+
+	var resumed urlResource
+	if code := do(t, s, "POST", "/api/urls/5/resume", "", &resumed); code != http.StatusOK || resumed.Paused {
+		t.Errorf("expected the URL resumed, got %d %+v", code, resumed)
+	}
+	if u, _ := store.GetURL(5); u.Paused {
+		t.Errorf("expected the URL resumed in the store")
+	}
+
+	if changes != 7 {
+		t.Errorf("expected Changed called after the 7 changes, got %d", changes)
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	s, store := newTestServer(t)
+
+	store.CreateURL("https://example.com", 1)
+	open, _ := store.CreateIncident(1, "timeout", time.Now())
+	resolved, _ := store.CreateIncident(1, "refused", time.Now().Add(-time.Hour))
+	store.ResolveIncident(resolved, time.Now(), time.Hour)
+
+	var incidents []db.Incident
+	if code := do(t, s, "GET", "/api/incidents", "", &incidents); code != http.StatusOK || len(incidents) != 1 || incidents[0].ID != open {
+		t.Errorf("expected the open incident, got %d %+v", code, incidents)
+	}
+
+	var incident db.Incident
+	if code := do(t, s, "POST", "/api/incidents/1/acknowledge", `{"by": "alice"}`, &incident); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if incident.AcknowledgedBy != "alice" || incident.AcknowledgedAt == nil {
+		t.Errorf("expected the incident acknowledged, got %+v", incident)
+	}
+
+	// the body is optional
+	if code := do(t, s, "POST", "/api/incidents/1/acknowledge", "", &incident); code != http.StatusOK {
+		t.Errorf("expected 200 without a body, got %d", code)
+	}
+
+	tests := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/incidents/2/acknowledge", "", http.StatusConflict},
+		{"/api/incidents/3/acknowledge", "", http.StatusNotFound},
+		{"/api/incidents/x/acknowledge", "", http.StatusBadRequest},
+		{"/api/incidents/1/acknowledge", `{"who": "bob"}`, http.StatusBadRequest},
+		{"/api/incidents/1/acknowledge", `{"by": "` + strings.Repeat("a", 256) + `"}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if code := do(t, s, "POST", test.path, test.body, nil); code != test.code {
+			t.Errorf("%s %s: expected %d, got %d", test.path, test.body, test.code, code)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	var document struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if code := do(t, s, "GET", "/api/openapi.json", "", &document); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if document.OpenAPI == "" {
+		t.Errorf("expected an OpenAPI document")
+	}
+
+	// every route is documented
+	routes := map[string][]string{
+		"/api/urls":                       {"get", "post"},
+		"/api/urls/{id}":                  {"get", "patch", "delete"},
+		"/api/urls/{id}/pause":            {"post"},
+		"/api/urls/{id}/resume":           {"post"},
+		"/api/status":                     {"get"},
+		"/api/incidents":                  {"get"},
+		"/api/incidents/{id}/acknowledge": {"post"},
+		"/api/openapi.json":               {"get"},
+	}
+	for path, methods := range routes {
+		for _, method := range methods {
+			if _, ok := document.Paths[path][method]; !ok {
+				t.Errorf("expected %s %s documented", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"fmt"
+	"monitoring/check"
+	"monitoring/db"
+	"monitoring/notify"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const (
+	maxFrequency    = 86400
+	maxRetries      = 100
+	maxTLSWarnDays  = 365
+	maxTimeout      = 120
+	maxHeaders      = 4096
+	maxAlertTargets = 20
+	maxTextLength   = 255
+)
+
+// validationError is an invalid input, answered with a 400
+type validationError struct {
+	field   string
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.field + ": " + e.message
+}
+
+func invalid(field string, format string, args ...any) error {
+	return &validationError{field, fmt.Sprintf(format, args...)}
+}
+
+// validateURL checks a URL input and sets its check type from the scheme,
+// and its redirect policy to follow when empty
+func validateURL(in *urlInput) error {
+	if in.URL == "" {
+		return invalid("url", "is required")
+	}
+	if len(in.URL) > maxTextLength {
+		return invalid("url", "is longer than %d characters", maxTextLength)
+	}
+	u, err := url.Parse(in.URL)
+	if err != nil || u.Host == "" {
+		return invalid("url", "must be an absolute URL")
+	}
+
+	var checkType string
+	switch u.Scheme {
+	case "http", "https":
+		checkType = db.CheckHTTP
+	case db.CheckTCP, db.CheckDNS, db.CheckTLS:
+		checkType = u.Scheme
+	default:
+		return invalid("url", "scheme must be http, https, tcp, dns or tls")
+	}
+	if checkType == db.CheckTCP && u.Port() == "" {
+		return invalid("url", "tcp URLs need a port")
+	}
+	if in.CheckType != "" && in.CheckType != checkType {
+		return invalid("checkType", "is %s for a %s URL", checkType, u.Scheme)
+	}
+	in.CheckType = checkType
+
+	if in.Frequency < 0 || in.Frequency > maxFrequency {
+		return invalid("frequency", "must be between 0 and %d", maxFrequency)
+	}
+	if in.Retries < 0 || in.Retries > maxRetries {
+		return invalid("retries", "must be between 0 and %d", maxRetries)
+	}
+	if in.RecoverySuccesses < 0 || in.RecoverySuccesses > maxRetries {
+		return invalid("recoverySuccesses", "must be between 0 and %d", maxRetries)
+	}
+
+	if in.ExpectedStatusMin < 100 || in.ExpectedStatusMax > 599 || in.ExpectedStatusMin > in.ExpectedStatusMax {
+		return invalid("expectedStatusMin", "the expected status range must be within 100-599")
+	}
+	if len(in.Keyword) > maxTextLength {
+		return invalid("keyword", "is longer than %d characters", maxTextLength)
+	}
+	if in.KeywordRegex {
+		if _, err := regexp.Compile(in.Keyword); err != nil {
+			return invalid("keyword", "%v", err)
+		}
+	}
+	if len(in.DNSExpected) > maxTextLength {
+		return invalid("dnsExpected", "is longer than %d characters", maxTextLength)
+	}
+	if in.TLSWarnDays < 0 || in.TLSWarnDays > maxTLSWarnDays {
+		return invalid("tlsWarnDays", "must be between 0 and %d", maxTLSWarnDays)
+	}
+	if in.Timeout < 0 || in.Timeout > maxTimeout {
+		return invalid("timeoutSeconds", "must be between 0 and %d", maxTimeout)
+	}
+
+	switch in.Redirects {
+	case "":
+		in.Redirects = db.RedirectsFollow
+	case db.RedirectsFollow, db.RedirectsSameHost, db.RedirectsNone:
+	default:
+		return invalid("redirects", "must be follow, same-host or none")
+	}
+	if len(in.Headers) > maxHeaders {
+		return invalid("headers", "is longer than %d characters", maxHeaders)
+	}
+	if _, err := check.ParseHeaders(in.Headers); err != nil {
+		return invalid("headers", "%v", err)
+	}
+
+	if in.AlertTargets == nil {
+		return nil
+	}
+	if len(*in.AlertTargets) > maxAlertTargets {
+		return invalid("alertTargets", "at most %d targets", maxAlertTargets)
+	}
+	for i, target := range *in.AlertTargets {
+		if err := validateTarget(target); err != nil {
+			return invalid(fmt.Sprintf("alertTargets[%d]", i), "%v", err)
+		}
+	}
+	return nil
+}
+
+func validateTarget(target targetResource) error {
+	if len(target.Target) > maxTextLength {
+		return fmt.Errorf("target is longer than %d characters", maxTextLength)
+	}
+
+	switch target.Channel {
+	case notify.ChannelWebhook, notify.ChannelSlack:
+		u, err := url.Parse(target.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("target must be an http or https URL")
+		}
+	case notify.ChannelSMTP:
+		address, err := mail.ParseAddress(target.Target)
+		if err != nil || address.Address != target.Target {
+			return fmt.Errorf("target must be an email address")
+		}
+	default:
+		return fmt.Errorf("channel must be webhook, slack or smtp")
+	}
+
+	if target.Template != "" {
+		sample := notify.Alert{URLID: 1, URL: "https://example.com", Message: "down", Time: time.Now()}
+		if _, err := notify.Render(target.Template, sample); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
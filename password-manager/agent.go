@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const agentSocketEnv = "PASSWORD_MANAGER_AGENT_SOCK"
+
+type agentMessage struct {
+	Command string `json:"command,omitempty"`
+	Vault   string `json:"vault,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// agent keeps the key of a signed in vault in memory and hands it to the CLI
+// commands over a Unix socket, like ssh-agent. It locks after being idle for
+// timeout
+type agent struct {
+	vault      *Vault
+	socketPath string
+	timeout    time.Duration
+	listener   net.Listener
+	timer      *time.Timer
+	mu         sync.Mutex
+	locked     bool
+}
+
+func newAgent(vault *Vault, socketPath string, timeout time.Duration) (*agent, error) {
+	// a socket left behind by an agent that did not exit cleanly
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return nil, errors.New("an agent is already running on " + socketPath)
+	}
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New(socketPath + " exists and is not a socket")
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// the socket is created 0600, a chmod after Listen would leave other
+	// users a window to connect
+	mask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", socketPath)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &agent{vault: vault, socketPath: socketPath, timeout: timeout, listener: listener}
+	a.mu.Lock()
+	a.timer = time.AfterFunc(timeout, a.lock)
+	a.mu.Unlock()
+
+	return a, nil
+}
+
+// serve handles requests until the agent is locked
+func (a *agent) serve() error {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if a.isLocked() {
+				return nil
+			}
+			return err
+		}
+
+		go a.handle(conn)
+	}
+}
+
+func (a *agent) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := agentMessage{}
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		return
+	}
+
+	response := agentMessage{}
+	switch request.Command {
+	case "key":
+		a.mu.Lock()
+		if a.locked {
+			response.Error = "agent is locked"
+		} else if request.Vault != a.vault.name {
+			response.Error = "agent holds a different vault"
+		} else {
+			a.timer.Reset(a.timeout)
+			response.Vault = a.vault.name
+			response.Key = hex.EncodeToString(a.vault.secretKey)
+		}
+		a.mu.Unlock()
+	case "lock":
+		defer a.lock()
+	default:
+		response.Error = "unknown command"
+	}
+
+	json.NewEncoder(conn).Encode(response)
+}
+
+// lock zeroes the vault key and stops the agent
+func (a *agent) lock() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return
+	}
+
+	a.locked = true
+	a.timer.Stop()
+	a.vault.lock()
+	a.listener.Close()
+	os.Remove(a.socketPath)
+}
+
+func (a *agent) isLocked() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.locked
+}
+
+func agentRequest(socketPath string, request agentMessage) (agentMessage, error) {
+	response := agentMessage{}
+
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return response, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return response, err
+	}
+
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return response, err
+	}
+
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+
+	return response, nil
+}
+
+// unlockWithAgent signs in to the vault with the key held by a running agent
+func (v *Vault) unlockWithAgent(socketPath, name string) error {
+	response, err := agentRequest(socketPath, agentMessage{Command: "key", Vault: name})
+	if err != nil {
+		return err
+	}
+
+	key, err := hex.DecodeString(response.Key)
+	if err != nil {
+		return err
+	}
+
+	v.name = name
+	v.secretKey = key
+	return nil
+}
+
+func (v *Vault) agentSocketPath() string {
+	if path := os.Getenv(agentSocketEnv); path != "" {
+		return path
+	}
+
+	return filepath.Join(v.configFolderPath, "agent.sock")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAgent(t *testing.T) {
+	vault := newSignedInVault(t, "agentTest", "1111")
+	key := vault.secretKey
+	expectedKey := bytes.Clone(key)
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	a, err := newAgent(vault, socketPath, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error starting agent: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- a.serve()
+	}()
+
+	stat, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("Error getting socket info: %v", err)
+	}
+
+	if stat.Mode().Perm() != 0600 {
+		t.Errorf("expected socket permissions 0600, got %v", stat.Mode().Perm())
+	}
+
+	if _, err := newAgent(vault, socketPath, time.Minute); err == nil {
+		t.Error("Should return error when an agent is already running")
+	}
+
+	client, err := newVault()
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+
+	if err := client.unlockWithAgent(socketPath, "otherVault"); err == nil {
+		t.Error("Should return error when asking for a different vault")
+	}
+
+	// every request resets the idle timer
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := client.unlockWithAgent(socketPath, "agentTest"); err != nil {
+			t.Fatalf("Error unlocking with agent: %v", err)
+		}
+	}
+
+	if !bytes.Equal(client.secretKey, expectedKey) {
+		t.Error("agent returned a different key")
+	}
+
+	if err := client.addPassword("facebook", "myuser", "testpass"); err != nil {
+		t.Errorf("Error adding password: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error serving: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent did not lock after the idle timeout")
+	}
+
+	if !bytes.Equal(key, make([]byte, len(key))) || vault.secretKey != nil {
+		t.Error("key was not zeroed on lock")
+	}
+
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Error("socket was not removed on lock")
+	}
+
+	if err := client.unlockWithAgent(socketPath, "agentTest"); err == nil {
+		t.Error("Should return error when agent is locked")
+	}
+}
+
+func TestAgentSocketPathNotSocket(t *testing.T) {
+	vault := newSignedInVault(t, "agentPathTest", "1111")
+
+	// a file that is not a socket is never removed
+	socketPath := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(socketPath, []byte("my notes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newAgent(vault, socketPath, time.Minute); err == nil {
+		t.Error("Should return error when the path is not a socket")
+	}
+
+	if content, err := os.ReadFile(socketPath); err != nil || string(content) != "my notes" {
+		t.Errorf("expected the file untouched, got %q, %v", content, err)
+	}
+}
+
+func TestAgentLockCommand(t *testing.T) {
+	vault := newSignedInVault(t, "agentLockTest", "1111")
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	a, err := newAgent(vault, socketPath, time.Minute)
+	if err != nil {
+		t.Fatalf("Error starting agent: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- a.serve()
+	}()
+
+	if _, err := agentRequest(socketPath, agentMessage{Command: "lock"}); err != nil {
+		t.Fatalf("Error locking agent: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent did not stop after lock")
+	}
+
+	if vault.secretKey != nil {
+		t.Error("key was not zeroed on lock")
+	}
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+func runCommand(args []string) error {
+	switch args[0] {
+	case "generate":
+		return runGenerate(args[1:])
+	case "totp":
+		return runTOTP(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "export":
+		return runExport(args[1:])
+	case "restore":
+		return runRestore(args[1:])
+	case "add":
+		return runAdd(args[1:])
+	case "edit":
+		return runEdit(args[1:])
+	case "show":
+		return runShow(args[1:])
+	case "list":
+		return runList(args[1:])
+	case "search":
+		return runSearch(args[1:])
+	case "agent":
+		return runAgent(args[1:])
+	case "lock":
+		return runLock(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runGenerate(args []string) error {
+	policy := defaultPasswordPolicy()
+
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.IntVar(&policy.length, "length", policy.length, "password length")
+	noLower := fs.Bool("no-lower", false, "exclude lowercase letters")
+	noUpper := fs.Bool("no-upper", false, "exclude uppercase letters")
+	noDigits := fs.Bool("no-digits", false, "exclude digits")
+	noSymbols := fs.Bool("no-symbols", false, "exclude symbols")
+	allowAmbiguous := fs.Bool("allow-ambiguous", false, "allow look-alike characters such as l, 1, O and 0")
+	fs.IntVar(&policy.minLower, "min-lower", policy.minLower, "minimum number of lowercase letters")
+	fs.IntVar(&policy.minUpper, "min-upper", policy.minUpper, "minimum number of uppercase letters")
+	fs.IntVar(&policy.minDigits, "min-digits", policy.minDigits, "minimum number of digits")
+	fs.IntVar(&policy.minSymbols, "min-symbols", policy.minSymbols, "minimum number of symbols")
+	words := fs.Int("words", 0, "generate a diceware passphrase with this number of words")
+	separator := fs.String("separator", "-", "passphrase word separator")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *words > 0 {
+		passphrase, err := generatePassphrase(*words, *separator)
+		if err != nil {
+			return err
+		}
+		printGenerated(passphrase, passphraseEntropy(*words))
+		return nil
+	}
+
+	policy.lower = !*noLower
+	policy.upper = !*noUpper
+	policy.digits = !*noDigits
+	policy.symbols = !*noSymbols
+	policy.excludeAmbiguous = !*allowAmbiguous
+
+	password, err := generatePassword(policy)
+	if err != nil {
+		return err
+	}
+	printGenerated(password, policy.entropy())
+
+	return nil
+}
+
+func printGenerated(password string, entropy float64) {
+	fmt.Println(password)
+	fmt.Printf("Entropy: ~%.0f bits\n", entropy)
+}
+
+func runTOTP(args []string) error {
+	fs := flag.NewFlagSet("totp", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: totp -vault <vault> <name>")
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	config, err := vault.getTOTP(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	printTOTPCode(config)
+	return nil
+}
+
+// openVault signs in to the vault with the key of a running agent, or
+// prompts for the master password when there is none
+func openVault(name string) (*Vault, error) {
+	vault, err := newVault()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vault.unlockWithAgent(vault.agentSocketPath(), name); err == nil {
+		return vault, nil
+	}
+
+	password, err := readSecret("Enter the master password: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vault.signIn(name, password); err != nil {
+		return nil, err
+	}
+
+	return vault, nil
+}
+
+// readSecret prompts on stderr so stdout can be redirected to a file
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+func printTOTPCode(config totpConfig) {
+	code, remaining, err := config.code(time.Now())
+	if err != nil {
+		fmt.Println("Error generating TOTP code: ", err)
+		return
+	}
+
+	fmt.Println(code)
+	fmt.Printf("Valid for %d seconds\n", remaining)
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	format := fs.String("format", "", "export format: bitwarden, keepass, 1password or chrome")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: import -vault <vault> -format <format> <file>")
+	}
+
+	var parse func(io.Reader) ([]entry, error)
+	switch *format {
+	case "bitwarden":
+		parse = parseBitwardenJSON
+	case "keepass", "1password", "chrome", "csv":
+		parse = parseCSV
+	default:
+		return fmt.Errorf("unknown import format %q", *format)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := parse(file)
+	if err != nil {
+		return err
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	imported, err := vault.importEntries(entries)
+	fmt.Printf("Imported %d of %d entries\n", imported, len(entries))
+	return err
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	format := fs.String("format", "backup", "export format: backup or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: export -vault <vault> -format <format> <file>")
+	}
+
+	if *format != "backup" && *format != "csv" {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	passphrase := ""
+	if *format == "csv" {
+		fmt.Fprint(os.Stderr, "The CSV file will contain every password in plain text. Type 'yes' to continue: ")
+		var confirm string
+		fmt.Scanln(&confirm)
+		if confirm != "yes" {
+			return errors.New("export cancelled")
+		}
+	} else {
+		passphrase, err = readSecret("Enter the backup passphrase: ")
+		if err != nil {
+			return err
+		}
+
+		repeat, err := readSecret("Repeat the backup passphrase: ")
+		if err != nil {
+			return err
+		}
+
+		if passphrase == "" || passphrase != repeat {
+			return errors.New("passphrases are empty or do not match")
+		}
+	}
+
+	file, err := os.OpenFile(fs.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if *format == "csv" {
+		return vault.exportCSV(file)
+	}
+
+	return vault.exportBackup(file, passphrase)
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "name of the new vault")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: restore -vault <new vault> <file>")
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	passphrase, err := readSecret("Enter the backup passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	masterPassword, err := readSecret("Enter the master password for the new vault: ")
+	if err != nil {
+		return err
+	}
+
+	if masterPassword == "" {
+		return errors.New("master password cannot be empty")
+	}
+
+	vault, err := newVault()
+	if err != nil {
+		return err
+	}
+
+	restored, err := vault.restoreBackup(file, passphrase, *vaultName, masterPassword)
+	fmt.Printf("Restored %d entries\n", restored)
+	return err
+}
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type entryFlags struct {
+	username *string
+	urls     stringList
+	tags     stringList
+	notes    *string
+	fields   stringList
+	generate *bool
+}
+
+func addEntryFlags(fs *flag.FlagSet) *entryFlags {
+	f := &entryFlags{}
+	f.username = fs.String("username", "", "username")
+	fs.Var(&f.urls, "url", "URL, can be repeated")
+	fs.Var(&f.tags, "tag", "tag, can be repeated")
+	f.notes = fs.String("notes", "", "notes")
+	fs.Var(&f.fields, "field", "custom field as key=value, can be repeated")
+	f.generate = fs.Bool("generate", false, "generate a random password")
+	return f
+}
+
+// apply sets the entry values of the flags given on the command line
+func (f *entryFlags) apply(fs *flag.FlagSet, e *entry) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "username":
+			e.username = *f.username
+		case "url":
+			e.urls = f.urls
+		case "tag":
+			e.tags = f.tags
+		case "notes":
+			e.notes = *f.notes
+		case "field":
+			if e.fields == nil {
+				e.fields = map[string]string{}
+			}
+			for _, field := range f.fields {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok || key == "" {
+					err = fmt.Errorf("invalid field %q, expected key=value", field)
+					return
+				}
+				if value == "" {
+					delete(e.fields, key)
+					continue
+				}
+				e.fields[key] = value
+			}
+		}
+	})
+	return err
+}
+
+func (f *entryFlags) readPassword() (string, error) {
+	if *f.generate {
+		return generatePassword(defaultPasswordPolicy())
+	}
+
+	password, err := readSecret("Enter the password: ")
+	if err != nil {
+		return "", err
+	}
+
+	if password == "" {
+		return "", errors.New("password cannot be empty")
+	}
+
+	return password, nil
+}
+
+func runAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	flags := addEntryFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: add -vault <vault> [options] <name>")
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	e := entry{name: fs.Arg(0)}
+	if err := flags.apply(fs, &e); err != nil {
+		return err
+	}
+
+	e.password, err = flags.readPassword()
+	if err != nil {
+		return err
+	}
+
+	return vault.addEntry(e)
+}
+
+func runEdit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	changePassword := fs.Bool("password", false, "change the password")
+	flags := addEntryFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: edit -vault <vault> [options] <name>")
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	e, err := vault.getEntry(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := flags.apply(fs, &e); err != nil {
+		return err
+	}
+
+	if *changePassword || *flags.generate {
+		e.password, err = flags.readPassword()
+		if err != nil {
+			return err
+		}
+	}
+
+	return vault.updateEntry(e)
+}
+
+func runShow(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	d := delivery{}
+	fs.BoolVar(&d.show, "show", false, "print the password to stdout")
+	fs.BoolVar(&d.clipboard, "clip", false, "copy the password to the clipboard with an OSC 52 escape sequence")
+	fs.DurationVar(&d.clearAfter, "clear", 20*time.Second, "clear the clipboard after this long")
+	fs.StringVar(&d.pipe, "pipe", "", "write the password to this named pipe")
+	fs.IntVar(&d.fd, "fd", 0, "write the password to this pipe file descriptor, 3 or above")
+	fs.BoolVar(&d.reveal, "reveal", false, "show the password on the alternate screen until a key is pressed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: show -vault <vault> <name>")
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	e, err := vault.getEntry(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	printEntry(e)
+	if !d.enabled() {
+		fmt.Println("Password:  ******** (use -show, -clip, -reveal, -pipe or -fd)")
+		return nil
+	}
+
+	return d.deliver(e.password)
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	tag := fs.String("tag", "", "only list entries with this tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" {
+		return errors.New("usage: list -vault <vault> [-tag <tag>]")
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	entries, err := vault.listEntries(*tag)
+	if err != nil {
+		return err
+	}
+
+	printEntryList(entries)
+	return nil
+}
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" || fs.NArg() != 1 {
+		return errors.New("usage: search -vault <vault> <query>")
+	}
+
+	vault, err := openVault(*vaultName)
+	if err != nil {
+		return err
+	}
+
+	entries, err := vault.search(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	printEntryList(entries)
+	return nil
+}
+
+func printEntryList(entries []entry) {
+	for _, e := range entries {
+		line := e.name
+		if e.username != "" {
+			line += " (" + e.username + ")"
+		}
+		if len(e.urls) > 0 {
+			line += " " + e.urls[0]
+		}
+		if len(e.tags) > 0 {
+			line += " [" + strings.Join(e.tags, ", ") + "]"
+		}
+		fmt.Println(line)
+	}
+}
+
+func printEntry(e entry) {
+	fmt.Println("Name: ", e.name)
+	fmt.Println("Username: ", e.username)
+
+	for _, u := range e.urls {
+		fmt.Println("URL: ", u)
+	}
+
+	if len(e.tags) > 0 {
+		fmt.Println("Tags: ", strings.Join(e.tags, ", "))
+	}
+
+	if e.notes != "" {
+		fmt.Println("Notes: ", e.notes)
+	}
+
+	keys := []string{}
+	for key := range e.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%s:  %s\n", key, e.fields[key])
+	}
+
+	if len(e.history) > 0 {
+		fmt.Println("Previous passwords: ", len(e.history))
+	}
+
+	if !e.created.IsZero() {
+		fmt.Println("Created: ", e.created.Local().Format(time.DateTime))
+		fmt.Println("Updated: ", e.updated.Local().Format(time.DateTime))
+	}
+}
+
+func runAgent(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	vaultName := fs.String("vault", "", "vault name")
+	timeout := fs.Duration("timeout", 15*time.Minute, "lock after being idle for this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *vaultName == "" {
+		return errors.New("usage: agent -vault <vault> [-timeout <duration>]")
+	}
+
+	vault, err := newVault()
+	if err != nil {
+		return err
+	}
+
+	password, err := readSecret("Enter the master password: ")
+	if err != nil {
+		return err
+	}
+
+	if err := vault.signIn(*vaultName, password); err != nil {
+		return err
+	}
+
+	a, err := newAgent(vault, vault.agentSocketPath(), *timeout)
+	if err != nil {
+		vault.lock()
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		a.lock()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Agent listening on %s\n", a.socketPath)
+	fmt.Fprintf(os.Stderr, "export %s=%s\n", agentSocketEnv, a.socketPath)
+
+	if err := a.serve(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Vault locked")
+	return nil
+}
+
+func runLock(args []string) error {
+	vault, err := newVault()
+	if err != nil {
+		return err
+	}
+
+	_, err = agentRequest(vault.agentSocketPath(), agentMessage{Command: "lock"})
+	return err
+}
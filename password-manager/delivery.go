@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[H\x1b[2J"
+	leaveAltScreen = "\x1b[H\x1b[2J\x1b[?1049l"
+)
+
+// delivery says how a secret leaves the password manager. Only the show mode
+// prints it to stdout, where it stays in the terminal scrollback
+type delivery struct {
+	show       bool
+	clipboard  bool
+	clearAfter time.Duration
+	pipe       string
+	fd         int
+	reveal     bool
+}
+
+func (d delivery) enabled() bool {
+	return d.show || d.clipboard || d.pipe != "" || d.fd > 0 || d.reveal
+}
+
+func (d delivery) deliver(secret string) error {
+	if !d.enabled() {
+		return errors.New("no delivery mode selected")
+	}
+
+	if d.show {
+		fmt.Println("Password: ", secret)
+	}
+
+	if d.pipe != "" {
+		if err := writeSecretToFile(d.pipe, secret); err != nil {
+			return err
+		}
+	}
+
+	if d.fd > 0 {
+		if err := writeSecretToFd(d.fd, secret); err != nil {
+			return err
+		}
+	}
+
+	if d.reveal {
+		tty, err := openTTY()
+		if err != nil {
+			return err
+		}
+		defer tty.Close()
+
+		if err := revealSecret(tty, tty, secret); err != nil {
+			return err
+		}
+	}
+
+	if d.clipboard {
+		tty, err := openTTY()
+		if err != nil {
+			return err
+		}
+		defer tty.Close()
+
+		fmt.Fprintf(os.Stderr, "Password copied to the clipboard, it will be cleared in %s\n", d.clearAfter)
+		return copyOSC52(tty, secret, d.clearAfter)
+	}
+
+	return nil
+}
+
+func osc52Sequence(secret string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(secret)) + "\a"
+}
+
+// an empty payload replaces the clipboard content with nothing
+func osc52ClearSequence() string {
+	return "\x1b]52;c;\a"
+}
+
+// copyOSC52 asks the terminal to copy the secret to the system clipboard,
+// which also works over SSH, and clears it again after clearAfter
+func copyOSC52(w io.Writer, secret string, clearAfter time.Duration) error {
+	if _, err := io.WriteString(w, osc52Sequence(secret)); err != nil {
+		return err
+	}
+
+	if clearAfter <= 0 {
+		return nil
+	}
+
+	time.Sleep(clearAfter)
+	_, err := io.WriteString(w, osc52ClearSequence())
+	return err
+}
+
+// copyOSC52Background copies the secret and clears the clipboard from a
+// goroutine, so the interactive menu stays usable meanwhile
+func copyOSC52Background(secret string, clearAfter time.Duration) error {
+	tty, err := openTTY()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(tty, osc52Sequence(secret)); err != nil {
+		tty.Close()
+		return err
+	}
+
+	time.AfterFunc(clearAfter, func() {
+		io.WriteString(tty, osc52ClearSequence())
+		tty.Close()
+	})
+
+	fmt.Printf("Password copied to the clipboard, it will be cleared in %s\n", clearAfter)
+	return nil
+}
+
+// writeSecretToFile writes to a named pipe, opening it blocks until a
+// reader is connected. Anything else is refused so a regular file is not
+// overwritten with the secret, the opened file is checked again in case
+// the path was replaced meanwhile
+func writeSecretToFile(path, secret string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s is not a named pipe", path)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err = file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s is not a named pipe", path)
+	}
+
+	_, err = file.WriteString(secret)
+	return err
+}
+
+// writeSecretToFd writes to a pipe inherited from the shell, like
+// 3> >(command). The standard streams are refused, a terminal would show
+// the secret without -show, and the descriptor is left open as it is not
+// ours
+func writeSecretToFd(fd int, secret string) error {
+	if fd <= 2 {
+		return fmt.Errorf("file descriptor %d is a standard stream, use another one", fd)
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("invalid file descriptor %d: %w", fd, err)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFIFO {
+		return fmt.Errorf("file descriptor %d is not a pipe", fd)
+	}
+
+	for data := []byte(secret); len(data) > 0; {
+		n, err := syscall.Write(fd, data)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// revealSecret shows the secret on the alternate screen, which is not kept
+// in the scrollback, and wipes it when a key is pressed
+func revealSecret(in *os.File, out io.Writer, secret string) error {
+	if term.IsTerminal(int(in.Fd())) {
+		state, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(in.Fd()), state)
+	}
+
+	if _, err := io.WriteString(out, enterAltScreen+secret+"\r\n\r\nPress any key to hide it"); err != nil {
+		return err
+	}
+
+	key := make([]byte, 1)
+	_, err := in.Read(key)
+
+	if _, werr := io.WriteString(out, leaveAltScreen); werr != nil {
+		return werr
+	}
+
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func openTTY() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCopyOSC52(t *testing.T) {
+	var buf bytes.Buffer
+	err := copyOSC52(&buf, "hunter2", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error copying: %v", err)
+	}
+
+	expected := "\x1b]52;c;aHVudGVyMg==\a\x1b]52;c;\a"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestWriteSecretToFd(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	err = delivery{fd: int(w.Fd())}.deliver("hunter2")
+	if err != nil {
+		t.Fatalf("Error writing secret: %v", err)
+	}
+
+	// the descriptor is left open for its owner to close
+	if err := w.Close(); err != nil {
+		t.Fatalf("Error closing the pipe: %v", err)
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "hunter2" {
+		t.Errorf("expected hunter2, got %q", content)
+	}
+
+	for _, fd := range []int{1, 2} {
+		if err := writeSecretToFd(fd, "hunter2"); err == nil {
+			t.Errorf("Should return error for the standard stream %d", fd)
+		}
+	}
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := writeSecretToFd(int(file.Fd()), "hunter2"); err == nil {
+		t.Error("Should return error when the descriptor is not a pipe")
+	}
+}
+
+func TestWriteSecretToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	content := make(chan string)
+	go func() {
+		r, err := os.Open(path)
+		if err != nil {
+			content <- err.Error()
+			return
+		}
+		defer r.Close()
+
+		b, _ := io.ReadAll(r)
+		content <- string(b)
+	}()
+
+	err := delivery{pipe: path}.deliver("hunter2")
+	if err != nil {
+		t.Fatalf("Error writing secret: %v", err)
+	}
+
+	if got := <-content; got != "hunter2" {
+		t.Errorf("expected hunter2, got %q", got)
+	}
+
+	if err := (delivery{pipe: filepath.Join(t.TempDir(), "missing")}).deliver("hunter2"); err == nil {
+		t.Error("Should return error when the pipe does not exist")
+	}
+
+	// a regular file is left untouched
+	notes := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(notes, []byte("my notes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (delivery{pipe: notes}).deliver("hunter2"); err == nil {
+		t.Error("Should return error when the path is a regular file")
+	}
+	if b, _ := os.ReadFile(notes); string(b) != "my notes" {
+		t.Errorf("expected the regular file untouched, got %q", b)
+	}
+}
+
+func TestRevealSecret(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.Write([]byte("x"))
+	w.Close()
+
+	var out bytes.Buffer
+	if err := revealSecret(r, &out, "hunter2"); err != nil {
+		t.Fatalf("Error revealing secret: %v", err)
+	}
+
+	if !strings.HasPrefix(out.String(), enterAltScreen+"hunter2") || !strings.HasSuffix(out.String(), leaveAltScreen) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestDeliveryWithoutMode(t *testing.T) {
+	if err := (delivery{}).deliver("hunter2"); err == nil {
+		t.Error("Should return error when no delivery mode is selected")
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// number of previous passwords kept for every entry
+const passwordHistorySize = 5
+
+type entry struct {
+	name     string
+	username string
+	password string
+	totp     string
+	urls     []string
+	tags     []string
+	notes    string
+	fields   map[string]string
+	history  []passwordChange
+	created  time.Time
+	updated  time.Time
+}
+
+type passwordChange struct {
+	Password string    `json:"password"`
+	Changed  time.Time `json:"changed"`
+}
+
+// entryMeta holds what list and search need, it is encrypted apart from
+// entryDetails so searching never decrypts passwords or notes
+type entryMeta struct {
+	URLs    []string  `json:"urls,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+type entryDetails struct {
+	Notes   string            `json:"notes,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	History []passwordChange  `json:"history,omitempty"`
+}
+
+// storedEntry is a vault file line with its encrypted fields:
+// name:username:password:totp:meta:details
+type storedEntry struct {
+	name     string
+	username string
+	password string
+	totp     string
+	meta     string
+	details  string
+}
+
+func parseStoredEntry(line string) (storedEntry, error) {
+	split := strings.Split(line, ":")
+	if len(split) < 3 || len(split) > 6 {
+		return storedEntry{}, errors.New("invalid vault file")
+	}
+
+	// older vaults only have the first 3 or 4 fields
+	for len(split) < 6 {
+		split = append(split, "")
+	}
+
+	return storedEntry{
+		name:     split[0],
+		username: split[1],
+		password: split[2],
+		totp:     split[3],
+		meta:     split[4],
+		details:  split[5],
+	}, nil
+}
+
+func (s storedEntry) line() string {
+	return strings.Join([]string{s.name, s.username, s.password, s.totp, s.meta, s.details}, ":")
+}
+
+// readVault returns the header line with the master password hash and every
+// stored entry of the signed in vault
+func (v *Vault) readVault() (string, []storedEntry, error) {
+	content, err := os.ReadFile(filepath.Join(v.configFolderPath, v.name))
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	stored := []storedEntry{}
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+
+		s, err := parseStoredEntry(line)
+		if err != nil {
+			return "", nil, err
+		}
+		stored = append(stored, s)
+	}
+
+	return lines[0], stored, nil
+}
+
+func (v *Vault) writeVault(header string, stored []storedEntry) error {
+	var content strings.Builder
+	content.WriteString(header + "\n")
+	for _, s := range stored {
+		content.WriteString(s.line() + "\n")
+	}
+
+	return os.WriteFile(filepath.Join(v.configFolderPath, v.name), []byte(content.String()), 0644)
+}
+
+func (v *Vault) findStoredEntry(name string) (storedEntry, error) {
+	_, stored, err := v.readVault()
+	if err != nil {
+		return storedEntry{}, err
+	}
+
+	for _, s := range stored {
+		if s.name == name {
+			return s, nil
+		}
+	}
+
+	return storedEntry{}, errors.New("password not found")
+}
+
+func (v *Vault) encryptEntry(e entry) (storedEntry, error) {
+	if e.name == "" || strings.Contains(e.name, ":") || strings.Contains(e.username, ":") {
+		return storedEntry{}, errors.New("name and username cannot be empty or contain ':'")
+	}
+
+	s := storedEntry{name: e.name, username: e.username}
+
+	var err error
+	s.password, err = v.encrypt([]byte(e.password), v.secretKey)
+	if err != nil {
+		return s, err
+	}
+
+	if e.totp != "" {
+		s.totp, err = v.encrypt([]byte(e.totp), v.secretKey)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	meta, err := json.Marshal(entryMeta{URLs: e.urls, Tags: e.tags, Created: e.created, Updated: e.updated})
+	if err != nil {
+		return s, err
+	}
+
+	s.meta, err = v.encrypt(meta, v.secretKey)
+	if err != nil {
+		return s, err
+	}
+
+	details, err := json.Marshal(entryDetails{Notes: e.notes, Fields: e.fields, History: e.history})
+	if err != nil {
+		return s, err
+	}
+
+	s.details, err = v.encrypt(details, v.secretKey)
+	return s, err
+}
+
+// decryptMeta decrypts only the name, username, URLs, tags and timestamps
+func (v *Vault) decryptMeta(s storedEntry) (entry, error) {
+	e := entry{name: s.name, username: s.username}
+	if s.meta == "" {
+		return e, nil
+	}
+
+	meta, err := v.decrypt(s.meta, v.secretKey)
+	if err != nil {
+		return e, err
+	}
+
+	m := entryMeta{}
+	if err := json.Unmarshal([]byte(meta), &m); err != nil {
+		return e, err
+	}
+
+	e.urls = m.URLs
+	e.tags = m.Tags
+	e.created = m.Created
+	e.updated = m.Updated
+
+	return e, nil
+}
+
+func (v *Vault) decryptEntry(s storedEntry) (entry, error) {
+	e, err := v.decryptMeta(s)
+	if err != nil {
+		return e, err
+	}
+
+	e.password, err = v.decrypt(s.password, v.secretKey)
+	if err != nil {
+		return e, err
+	}
+
+	if s.totp != "" {
+		e.totp, err = v.decrypt(s.totp, v.secretKey)
+		if err != nil {
+			return e, err
+		}
+	}
+
+	if s.details == "" {
+		return e, nil
+	}
+
+	details, err := v.decrypt(s.details, v.secretKey)
+	if err != nil {
+		return e, err
+	}
+
+	d := entryDetails{}
+	if err := json.Unmarshal([]byte(details), &d); err != nil {
+		return e, err
+	}
+
+	e.notes = d.Notes
+	e.fields = d.Fields
+	e.history = d.History
+
+	return e, nil
+}
+
+func (v *Vault) addEntry(e entry) error {
+	_, stored, err := v.readVault()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stored {
+		if s.name == e.name {
+			return errors.New("name already exists")
+		}
+	}
+
+	now := time.Now().UTC()
+	e.created = now
+	e.updated = now
+
+	s, err := v.encryptEntry(e)
+	if err != nil {
+		return err
+	}
+
+	file, err := v.getFileVault(filepath.Join(v.configFolderPath, v.name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write([]byte(s.line() + "\n"))
+	return err
+}
+
+func (v *Vault) getEntry(name string) (entry, error) {
+	s, err := v.findStoredEntry(name)
+	if err != nil {
+		return entry{}, err
+	}
+
+	return v.decryptEntry(s)
+}
+
+// updateEntry replaces the entry with the same name, a changed password is
+// moved to the password history
+func (v *Vault) updateEntry(e entry) error {
+	header, stored, err := v.readVault()
+	if err != nil {
+		return err
+	}
+
+	for i, s := range stored {
+		if s.name != e.name {
+			continue
+		}
+
+		current, err := v.decryptEntry(s)
+		if err != nil {
+			return err
+		}
+
+		e.created = current.created
+		e.updated = time.Now().UTC()
+		e.history = current.history
+		if current.password != e.password {
+			e.history = append(e.history, passwordChange{Password: current.password, Changed: e.updated})
+			if len(e.history) > passwordHistorySize {
+				e.history = e.history[len(e.history)-passwordHistorySize:]
+			}
+		}
+
+		stored[i], err = v.encryptEntry(e)
+		if err != nil {
+			return err
+		}
+
+		return v.writeVault(header, stored)
+	}
+
+	return errors.New("password not found")
+}
+
+// listEntries returns the entries with the given tag, or every entry when
+// tag is empty. Passwords and details are not decrypted
+func (v *Vault) listEntries(tag string) ([]entry, error) {
+	_, stored, err := v.readVault()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []entry{}
+	for _, s := range stored {
+		e, err := v.decryptMeta(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if tag == "" || slices.Contains(e.tags, tag) {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// search fuzzy matches the query against names, URLs and tags and returns
+// the best matches first. Passwords and details are not decrypted
+func (v *Vault) search(query string) ([]entry, error) {
+	entries, err := v.listEntries("")
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		entry entry
+		score int
+	}
+
+	matches := []match{}
+	for _, e := range entries {
+		best := fuzzyScore(query, e.name)
+		for _, candidate := range append(slices.Clone(e.urls), e.tags...) {
+			best = max(best, fuzzyScore(query, candidate))
+		}
+
+		if best > 0 {
+			matches = append(matches, match{entry: e, score: best})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	result := []entry{}
+	for _, m := range matches {
+		result = append(result, m.entry)
+	}
+
+	return result, nil
+}
+
+// fuzzyScore returns 0 when the query characters do not appear in order in
+// the target. Substring matches score higher than scattered ones, and
+// consecutive characters score higher than gaps
+func fuzzyScore(query, target string) int {
+	query = strings.ToLower(query)
+	target = strings.ToLower(target)
+	if query == "" {
+		return 0
+	}
+
+	if target == query {
+		return 1000
+	}
+
+	if strings.HasPrefix(target, query) {
+		return 500 + len(query)
+	}
+
+	if strings.Contains(target, query) {
+		return 250 + len(query)
+	}
+
+	runes := []rune(target)
+	score := 0
+	consecutive := 0
+	t := 0
+	for _, q := range query {
+		found := false
+		for t < len(runes) {
+			ch := runes[t]
+			t++
+			if ch == q {
+				consecutive++
+				score += consecutive
+				found = true
+				break
+			}
+			consecutive = 0
+		}
+
+		if !found {
+			return 0
+		}
+	}
+
+	return score
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdateEntry(t *testing.T) {
+	vault := newSignedInVault(t, "updateEntryTest", "1111")
+
+	err := vault.addEntry(entry{
+		name:     "github",
+		username: "octocat",
+		password: "pass0",
+		urls:     []string{"https://github.com"},
+		tags:     []string{"work"},
+		notes:    "recovery codes in the safe",
+		fields:   map[string]string{"pin": "1234"},
+	})
+	if err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+
+	e, err := vault.getEntry("github")
+	if err != nil {
+		t.Fatalf("Error getting entry: %v", err)
+	}
+
+	if e.notes != "recovery codes in the safe" || e.fields["pin"] != "1234" || !reflect.DeepEqual(e.tags, []string{"work"}) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	if e.created.IsZero() || !e.created.Equal(e.updated) {
+		t.Errorf("unexpected timestamps created %v updated %v", e.created, e.updated)
+	}
+
+	for i := 1; i <= passwordHistorySize+2; i++ {
+		e.password = "pass" + string(rune('0'+i))
+		if err := vault.updateEntry(e); err != nil {
+			t.Fatalf("Error updating entry: %v", err)
+		}
+	}
+
+	updated, err := vault.getEntry("github")
+	if err != nil {
+		t.Fatalf("Error getting entry: %v", err)
+	}
+
+	if updated.password != "pass7" {
+		t.Errorf("expected pass7, got %s", updated.password)
+	}
+
+	if len(updated.history) != passwordHistorySize {
+		t.Fatalf("expected %d previous passwords, got %d", passwordHistorySize, len(updated.history))
+	}
+
+	if updated.history[0].Password != "pass2" || updated.history[passwordHistorySize-1].Password != "pass6" {
+		t.Errorf("unexpected password history %+v", updated.history)
+	}
+
+	if !updated.created.Equal(e.created) || !updated.updated.After(e.created) {
+		t.Errorf("unexpected timestamps created %v updated %v", updated.created, updated.updated)
+	}
+
+	if err := vault.updateEntry(entry{name: "missing", password: "x"}); err == nil {
+		t.Error("Should return error when entry does not exist")
+	}
+}
+
+func TestListAndSearch(t *testing.T) {
+	vault := newSignedInVault(t, "searchTest", "1111")
+
+	entries := []entry{
+		{name: "github", username: "octocat", password: "a", urls: []string{"https://github.com"}, tags: []string{"work", "dev"}},
+		{name: "gitlab", username: "tanuki", password: "b", urls: []string{"https://gitlab.example.com"}, tags: []string{"work"}},
+		{name: "bank", username: "me", password: "c", urls: []string{"https://mybank.example.com"}, tags: []string{"personal"}},
+		{name: "mail", username: "me", password: "d"},
+	}
+	for _, e := range entries {
+		if err := vault.addEntry(e); err != nil {
+			t.Fatalf("Error adding entry: %v", err)
+		}
+	}
+
+	work, err := vault.listEntries("work")
+	if err != nil {
+		t.Fatalf("Error listing entries: %v", err)
+	}
+
+	if names := entryNames(work); !reflect.DeepEqual(names, []string{"github", "gitlab"}) {
+		t.Errorf("expected github and gitlab, got %v", names)
+	}
+
+	all, err := vault.listEntries("")
+	if err != nil {
+		t.Fatalf("Error listing entries: %v", err)
+	}
+
+	if len(all) != 4 || all[0].password != "" {
+		t.Errorf("unexpected entries %+v", all)
+	}
+
+	// corrupt every password, search must keep working without decrypting them
+	header, stored, err := vault.readVault()
+	if err != nil {
+		t.Fatalf("Error reading vault: %v", err)
+	}
+	for i := range stored {
+		stored[i].password = "00"
+	}
+	if err := vault.writeVault(header, stored); err != nil {
+		t.Fatalf("Error writing vault: %v", err)
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"github", []string{"github"}},
+		{"git", []string{"github", "gitlab"}},
+		{"mybank", []string{"bank"}},
+		{"personal", []string{"bank"}},
+		{"gthb", []string{"github"}},
+		{"zzz", []string{}},
+	}
+
+	for _, tt := range tests {
+		result, err := vault.search(tt.query)
+		if err != nil {
+			t.Fatalf("Error searching %q: %v", tt.query, err)
+		}
+
+		if names := entryNames(result); !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("search %q: expected %v, got %v", tt.query, tt.expected, names)
+		}
+	}
+}
+
+func TestLegacyEntries(t *testing.T) {
+	vault := newSignedInVault(t, "legacyEntryTest", "1111")
+
+	encrypted, err := vault.encrypt([]byte("oldpass"), vault.secretKey)
+	if err != nil {
+		t.Fatalf("Error encrypting: %v", err)
+	}
+
+	filePath := filepath.Join(vault.configFolderPath, "legacyEntryTest")
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Error opening vault: %v", err)
+	}
+	file.Write([]byte("old:olduser:" + encrypted + "\n"))
+	file.Close()
+
+	e, err := vault.getEntry("old")
+	if err != nil {
+		t.Fatalf("Error getting legacy entry: %v", err)
+	}
+
+	if e.username != "olduser" || e.password != "oldpass" {
+		t.Errorf("unexpected legacy entry %+v", e)
+	}
+
+	e.tags = []string{"migrated"}
+	if err := vault.updateEntry(e); err != nil {
+		t.Fatalf("Error updating legacy entry: %v", err)
+	}
+
+	content, _ := os.ReadFile(filePath)
+	if strings.Count(strings.Split(string(content), "\n")[1], ":") != 5 {
+		t.Error("expected updated entry to use the current format")
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	if fuzzyScore("GitHub", "github") <= fuzzyScore("git", "github") {
+		t.Error("exact match should score higher than prefix match")
+	}
+
+	if fuzzyScore("hub", "github") <= fuzzyScore("gthb", "github") {
+		t.Error("substring match should score higher than scattered match")
+	}
+
+	if fuzzyScore("bhg", "github") != 0 {
+		t.Error("out of order characters should not match")
+	}
+}
+
+func entryNames(entries []entry) []string {
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	return names
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const (
+	lowerChars     = "abcdefghijklmnopqrstuvwxyz"
+	upperChars     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars     = "0123456789"
+	symbolChars    = "!@#$%^&*()-_=+[]{};:,.<>/?~"
+	ambiguousChars = "Il1O0o|`'\""
+)
+
+// EFF large wordlist, one "<dice roll>\t<word>" pair per line
+//
+//go:embed wordlist.txt
+var wordlistData string
+
+var wordlist = loadWordlist(wordlistData)
+
+type passwordPolicy struct {
+	length           int
+	lower            bool
+	upper            bool
+	digits           bool
+	symbols          bool
+	excludeAmbiguous bool
+	minLower         int
+	minUpper         int
+	minDigits        int
+	minSymbols       int
+}
+
+func defaultPasswordPolicy() passwordPolicy {
+	return passwordPolicy{
+		length:           20,
+		lower:            true,
+		upper:            true,
+		digits:           true,
+		symbols:          true,
+		excludeAmbiguous: true,
+		minLower:         1,
+		minUpper:         1,
+		minDigits:        1,
+		minSymbols:       1,
+	}
+}
+
+type charClass struct {
+	chars string
+	min   int
+}
+
+func (p passwordPolicy) classes() []charClass {
+	classes := []charClass{}
+	add := func(enabled bool, chars string, min int) {
+		if !enabled {
+			return
+		}
+		if p.excludeAmbiguous {
+			chars = removeChars(chars, ambiguousChars)
+		}
+		classes = append(classes, charClass{chars: chars, min: min})
+	}
+
+	add(p.lower, lowerChars, p.minLower)
+	add(p.upper, upperChars, p.minUpper)
+	add(p.digits, digitChars, p.minDigits)
+	add(p.symbols, symbolChars, p.minSymbols)
+
+	return classes
+}
+
+func (p passwordPolicy) validate() error {
+	classes := p.classes()
+	if len(classes) == 0 {
+		return errors.New("at least one character class must be enabled")
+	}
+
+	if p.length <= 0 {
+		return errors.New("password length must be greater than 0")
+	}
+
+	required := 0
+	for _, c := range classes {
+		if c.min < 0 {
+			return errors.New("required character counts cannot be negative")
+		}
+		required += c.min
+	}
+
+	if required > p.length {
+		return errors.New("required character counts exceed password length")
+	}
+
+	return nil
+}
+
+func (p passwordPolicy) pool() string {
+	var pool strings.Builder
+	for _, c := range p.classes() {
+		pool.WriteString(c.chars)
+	}
+	return pool.String()
+}
+
+// entropy returns an estimate in bits, assuming every character is picked
+// uniformly from the whole pool
+func (p passwordPolicy) entropy() float64 {
+	return float64(p.length) * math.Log2(float64(len(p.pool())))
+}
+
+func generatePassword(p passwordPolicy) (string, error) {
+	if err := p.validate(); err != nil {
+		return "", err
+	}
+
+	password := make([]byte, 0, p.length)
+	for _, c := range p.classes() {
+		for i := 0; i < c.min; i++ {
+			ch, err := randomChar(c.chars)
+			if err != nil {
+				return "", err
+			}
+			password = append(password, ch)
+		}
+	}
+
+	pool := p.pool()
+	for len(password) < p.length {
+		ch, err := randomChar(pool)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, ch)
+	}
+
+	// required characters were added first, shuffle so they are not predictable
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+func generatePassphrase(words int, separator string) (string, error) {
+	if words <= 0 {
+		return "", errors.New("number of words must be greater than 0")
+	}
+
+	selected := make([]string, words)
+	for i := range selected {
+		n, err := randomInt(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		selected[i] = wordlist[n]
+	}
+
+	return strings.Join(selected, separator), nil
+}
+
+func passphraseEntropy(words int) float64 {
+	return float64(words) * math.Log2(float64(len(wordlist)))
+}
+
+func randomChar(chars string) (byte, error) {
+	n, err := randomInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[n], nil
+}
+
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
+
+func removeChars(chars, exclude string) string {
+	var result strings.Builder
+	for _, ch := range chars {
+		if !strings.ContainsRune(exclude, ch) {
+			result.WriteRune(ch)
+		}
+	}
+	return result.String()
+}
+
+func loadWordlist(data string) []string {
+	words := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		words = append(words, fields[1])
+	}
+	return words
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	policy := defaultPasswordPolicy()
+	policy.length = 32
+	policy.minDigits = 4
+	policy.minSymbols = 3
+
+	for i := 0; i < 50; i++ {
+		password, err := generatePassword(policy)
+		if err != nil {
+			t.Fatalf("Error generating password: %v", err)
+		}
+
+		if len(password) != policy.length {
+			t.Errorf("expected length %d, got %d", policy.length, len(password))
+		}
+
+		if strings.ContainsAny(password, ambiguousChars) {
+			t.Errorf("password %q contains ambiguous characters", password)
+		}
+
+		if countChars(password, digitChars) < policy.minDigits {
+			t.Errorf("password %q has less than %d digits", password, policy.minDigits)
+		}
+
+		if countChars(password, symbolChars) < policy.minSymbols {
+			t.Errorf("password %q has less than %d symbols", password, policy.minSymbols)
+		}
+	}
+}
+
+func TestGeneratePasswordClasses(t *testing.T) {
+	policy := passwordPolicy{length: 16, digits: true}
+	password, err := generatePassword(policy)
+	if err != nil {
+		t.Fatalf("Error generating password: %v", err)
+	}
+
+	if countChars(password, digitChars) != len(password) {
+		t.Errorf("expected only digits, got %q", password)
+	}
+}
+
+func TestGeneratePasswordInvalidPolicy(t *testing.T) {
+	tests := []passwordPolicy{
+		{length: 10},
+		{length: 0, lower: true},
+		{length: 2, lower: true, upper: true, minLower: 2, minUpper: 1},
+	}
+
+	for _, policy := range tests {
+		if _, err := generatePassword(policy); err == nil {
+			t.Errorf("expected error for policy %+v", policy)
+		}
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	if len(wordlist) != 7776 {
+		t.Fatalf("expected 7776 words in wordlist, got %d", len(wordlist))
+	}
+
+	passphrase, err := generatePassphrase(6, " ")
+	if err != nil {
+		t.Fatalf("Error generating passphrase: %v", err)
+	}
+
+	words := strings.Split(passphrase, " ")
+	if len(words) != 6 {
+		t.Errorf("expected 6 words, got %q", passphrase)
+	}
+
+	if _, err := generatePassphrase(0, " "); err == nil {
+		t.Error("Should return error when number of words is 0")
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	policy := passwordPolicy{length: 10, digits: true}
+	if got := int(policy.entropy()); got != 33 {
+		t.Errorf("expected 33 bits, got %d", got)
+	}
+
+	if got := int(passphraseEntropy(6)); got != 77 {
+		t.Errorf("expected 77 bits, got %d", got)
+	}
+}
+
+func countChars(s, chars string) int {
+	count := 0
+	for _, ch := range s {
+		if strings.ContainsRune(chars, ch) {
+			count++
+		}
+	}
+	return count
+}
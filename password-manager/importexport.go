@@ -0,0 +1,381 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const backupVersion = 1
+
+// Limits of the scrypt parameters read from a backup, so a crafted file
+// cannot make the import use gigabytes of memory or run for hours. The
+// backups written use N=32768, r=8 and p=1
+const (
+	maxScryptN      = 1 << 20
+	maxScryptMemory = 1 << 30 // 128 * N * r bytes
+	maxScryptWork   = 1 << 24 // N * r * p
+)
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Items     []struct {
+		Type  int    `json:"type"`
+		Name  string `json:"name"`
+		Notes string `json:"notes"`
+		Login *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Totp     string `json:"totp"`
+			Uris     []struct {
+				Uri string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+	} `json:"items"`
+}
+
+// parseBitwardenJSON reads an unencrypted Bitwarden JSON export, only login
+// items are imported
+func parseBitwardenJSON(r io.Reader) ([]entry, error) {
+	export := bitwardenExport{}
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+
+	if export.Encrypted {
+		return nil, errors.New("encrypted Bitwarden exports are not supported")
+	}
+
+	entries := []entry{}
+	for _, item := range export.Items {
+		if item.Type != 1 || item.Login == nil {
+			continue
+		}
+
+		e := entry{
+			name:     item.Name,
+			username: item.Login.Username,
+			password: item.Login.Password,
+			totp:     item.Login.Totp,
+			notes:    item.Notes,
+		}
+		for _, uri := range item.Login.Uris {
+			e.urls = append(e.urls, uri.Uri)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+var csvColumns = map[string][]string{
+	"name":     {"name", "title", "account"},
+	"username": {"username", "user name", "login name", "login", "login_username"},
+	"password": {"password", "login_password"},
+	"url":      {"url", "web site", "website", "login_uri"},
+	"totp":     {"totp", "otpauth", "login_totp"},
+	"notes":    {"notes", "note", "comments"},
+	"tags":     {"tags"},
+}
+
+// parseCSV reads KeePass, KeePassXC, 1Password and Chrome CSV exports. The
+// columns are found by their header names, which differ between managers
+func parseCSV(r io.Reader) ([]entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for field, names := range csvColumns {
+		for i, h := range header {
+			h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+			if slices.Contains(names, h) {
+				columns[field] = i
+				break
+			}
+		}
+	}
+
+	if _, ok := columns["password"]; !ok {
+		return nil, errors.New("CSV file has no password column")
+	}
+
+	get := func(record []string, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	entries := []entry{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		e := entry{
+			name:     get(record, "name"),
+			username: get(record, "username"),
+			password: get(record, "password"),
+			totp:     get(record, "totp"),
+			notes:    get(record, "notes"),
+			tags:     splitList(get(record, "tags")),
+			urls:     splitList(get(record, "url")),
+		}
+
+		// Chrome leaves the name empty for some sites
+		if e.name == "" && len(e.urls) > 0 {
+			if u, err := url.Parse(e.urls[0]); err == nil {
+				e.name = u.Hostname()
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// importEntries adds the entries to the vault, names that already exist get
+// a numeric suffix. It returns the number of imported entries
+func (v *Vault) importEntries(entries []entry) (int, error) {
+	imported := 0
+	for _, e := range entries {
+		if e.name == "" || e.password == "" {
+			continue
+		}
+
+		// ":" is the field separator of the vault file
+		name := strings.ReplaceAll(e.name, ":", "-")
+		e.username = strings.ReplaceAll(e.username, ":", "-")
+
+		if e.totp != "" {
+			config, err := parseTOTP(e.totp)
+			if err != nil {
+				return imported, fmt.Errorf("%s: %v", name, err)
+			}
+			e.totp = config.uri()
+		}
+
+		e.name = name
+		for i := 2; ; i++ {
+			err := v.addEntry(e)
+			if err == nil {
+				break
+			}
+			if err.Error() != "name already exists" {
+				return imported, err
+			}
+			e.name = fmt.Sprintf("%s-%d", name, i)
+		}
+
+		imported++
+	}
+
+	return imported, nil
+}
+
+func (v *Vault) exportCSV(w io.Writer) error {
+	entries, err := v.entries()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"name", "username", "password", "url", "totp", "notes", "tags"})
+	for _, e := range entries {
+		writer.Write([]string{e.name, e.username, e.password, strings.Join(e.urls, ","), e.totp, e.notes, strings.Join(e.tags, ",")})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+type backup struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    string `json:"salt"`
+	Data    string `json:"data"`
+}
+
+type backupEntry struct {
+	Name     string            `json:"name"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	Totp     string            `json:"totp,omitempty"`
+	URLs     []string          `json:"urls,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	History  []passwordChange  `json:"history,omitempty"`
+}
+
+// exportBackup writes every entry encrypted with a key derived from the
+// passphrase, so the file can be restored without the vault master password
+func (v *Vault) exportBackup(w io.Writer, passphrase string) error {
+	entries, err := v.entries()
+	if err != nil {
+		return err
+	}
+
+	backupEntries := []backupEntry{}
+	for _, e := range entries {
+		backupEntries = append(backupEntries, backupEntry{
+			Name:     e.name,
+			Username: e.username,
+			Password: e.password,
+			Totp:     e.totp,
+			URLs:     e.urls,
+			Tags:     e.tags,
+			Notes:    e.notes,
+			Fields:   e.fields,
+			History:  e.history,
+		})
+	}
+
+	plaintext, err := json.Marshal(backupEntries)
+	if err != nil {
+		return err
+	}
+
+	b := backup{Version: backupVersion, KDF: "scrypt", N: 32768, R: 8, P: 1}
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	b.Salt = hex.EncodeToString(salt)
+
+	key, err := scrypt.Key([]byte(passphrase), salt, b.N, b.R, b.P, 32)
+	if err != nil {
+		return err
+	}
+
+	b.Data, err = v.encrypt(plaintext, key)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+func readBackup(r io.Reader, passphrase string) ([]entry, error) {
+	b := backup{}
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, err
+	}
+
+	if b.Version != backupVersion || b.KDF != "scrypt" {
+		return nil, errors.New("unsupported backup format")
+	}
+
+	if err := checkScryptParams(b.N, b.R, b.P); err != nil {
+		return nil, err
+	}
+
+	salt, err := hex.DecodeString(b.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, b.N, b.R, b.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	v := Vault{}
+	plaintext, err := v.decrypt(b.Data, key)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted backup")
+	}
+
+	backupEntries := []backupEntry{}
+	if err := json.Unmarshal([]byte(plaintext), &backupEntries); err != nil {
+		return nil, err
+	}
+
+	entries := []entry{}
+	for _, e := range backupEntries {
+		entries = append(entries, entry{
+			name:     e.Name,
+			username: e.Username,
+			password: e.Password,
+			totp:     e.Totp,
+			urls:     e.URLs,
+			tags:     e.Tags,
+			notes:    e.Notes,
+			fields:   e.Fields,
+			history:  e.History,
+		})
+	}
+
+	return entries, nil
+}
+
+// restoreBackup creates a new vault and fills it with the backup entries
+func (v *Vault) restoreBackup(r io.Reader, passphrase, name, masterPassword string) (int, error) {
+	entries, err := readBackup(r, passphrase)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := v.createVault(name, masterPassword); err != nil {
+		return 0, err
+	}
+
+	if err := v.signIn(name, masterPassword); err != nil {
+		return 0, err
+	}
+
+	return v.importEntries(entries)
+}
+
+// splitList splits a comma separated CSV cell
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+// checkScryptParams rejects the parameters scrypt refuses and the ones
+// beyond the limits, each bound is checked before the products so they
+// cannot overflow
+func checkScryptParams(n, r, p int) error {
+	if n <= 1 || n&(n-1) != 0 || n > maxScryptN {
+		return fmt.Errorf("invalid backup scrypt N %d, must be a power of 2 up to %d", n, maxScryptN)
+	}
+	if r <= 0 || p <= 0 || r > maxScryptMemory/128/n || p > maxScryptWork/(n*r) {
+		return fmt.Errorf("invalid backup scrypt parameters N=%d r=%d p=%d", n, r, p)
+	}
+	return nil
+}
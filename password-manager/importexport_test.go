@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBitwardenJSON(t *testing.T) {
+	data := `{
+  "encrypted": false,
+  "items": [
+    {
+      "type": 1,
+      "name": "github",
+      "login": {
+        "username": "octocat",
+        "password": "hunter2",
+        "totp": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+        "uris": [{"match": null, "uri": "https://github.com"}]
+      }
+    },
+    {
+      "type": 2,
+      "name": "secure note",
+      "notes": "not a login"
+    }
+  ]
+}`
+
+	entries, err := parseBitwardenJSON(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error parsing export: %v", err)
+	}
+
+	expected := []entry{{
+		name:     "github",
+		username: "octocat",
+		password: "hunter2",
+		urls:     []string{"https://github.com"},
+		totp:     "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+	}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	_, err = parseBitwardenJSON(strings.NewReader(`{"encrypted": true, "items": []}`))
+	if err == nil {
+		t.Error("Should return error for encrypted exports")
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected entry
+	}{
+		{
+			name:     "KeePassXC",
+			data:     "\"Group\",\"Title\",\"Username\",\"Password\",\"URL\",\"Notes\",\"TOTP\"\n\"Root\",\"mail\",\"alice\",\"s3cret\",\"https://mail.example.com\",\"\",\"\"\n",
+			expected: entry{name: "mail", username: "alice", password: "s3cret", urls: []string{"https://mail.example.com"}},
+		},
+		{
+			name:     "KeePass 1.x",
+			data:     "\"Account\",\"Login Name\",\"Password\",\"Web Site\",\"Comments\"\n\"bank\",\"bob\",\"p,a\"\"ss\",\"https://bank.example.com\",\"\"\n",
+			expected: entry{name: "bank", username: "bob", password: "p,a\"ss", urls: []string{"https://bank.example.com"}},
+		},
+		{
+			name:     "1Password",
+			data:     "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\nshop,https://shop.example.com,carol,pw123,otpauth://totp/shop?secret=GEZDGNBV,false,false,\"work,shop\",\n",
+			expected: entry{name: "shop", username: "carol", password: "pw123", urls: []string{"https://shop.example.com"}, totp: "otpauth://totp/shop?secret=GEZDGNBV", tags: []string{"work", "shop"}},
+		},
+		{
+			name:     "Chrome",
+			data:     "name,url,username,password,note\n,https://accounts.example.com/login,dave,letmein,\n",
+			expected: entry{name: "accounts.example.com", username: "dave", password: "letmein", urls: []string{"https://accounts.example.com/login"}},
+		},
+	}
+
+	for _, tt := range tests {
+		entries, err := parseCSV(strings.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: error parsing CSV: %v", tt.name, err)
+		}
+
+		if len(entries) != 1 || !reflect.DeepEqual(entries[0], tt.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, entries)
+		}
+	}
+
+	_, err := parseCSV(strings.NewReader("name,username\nfoo,bar\n"))
+	if err == nil {
+		t.Error("Should return error when there is no password column")
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	vault := newSignedInVault(t, "importTest", "1111")
+
+	entries := []entry{
+		{name: "github", username: "octocat", password: "hunter2", totp: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+		{name: "github", username: "other", password: "second"},
+		{name: "https://site:8080", username: "user:name", password: "pass:word"},
+		{name: "", username: "nobody", password: "skipped"},
+	}
+
+	imported, err := vault.importEntries(entries)
+	if err != nil {
+		t.Fatalf("Error importing entries: %v", err)
+	}
+
+	if imported != 3 {
+		t.Errorf("expected 3 imported entries, got %d", imported)
+	}
+
+	user, pass, err := vault.getPassword("github-2")
+	if err != nil || user != "other" || pass != "second" {
+		t.Error("Error getting renamed duplicate entry")
+	}
+
+	user, pass, err = vault.getPassword("https-//site-8080")
+	if err != nil || user != "user-name" || pass != "pass:word" {
+		t.Error("Error getting entry with separator characters")
+	}
+
+	var csvBuf bytes.Buffer
+	if err := vault.exportCSV(&csvBuf); err != nil {
+		t.Fatalf("Error exporting CSV: %v", err)
+	}
+
+	exported, err := parseCSV(&csvBuf)
+	if err != nil {
+		t.Fatalf("Error parsing exported CSV: %v", err)
+	}
+
+	if len(exported) != 3 || exported[0].password != "hunter2" || exported[0].totp == "" {
+		t.Errorf("unexpected exported entries %+v", exported)
+	}
+
+	var backupBuf bytes.Buffer
+	if err := vault.exportBackup(&backupBuf, "backup passphrase"); err != nil {
+		t.Fatalf("Error exporting backup: %v", err)
+	}
+
+	if strings.Contains(backupBuf.String(), "hunter2") {
+		t.Error("backup contains a plain text password")
+	}
+
+	if _, err := readBackup(bytes.NewReader(backupBuf.Bytes()), "wrong passphrase"); err == nil {
+		t.Error("Should return error when backup passphrase is wrong")
+	}
+
+	// the key derivation parameters of a crafted backup are bounded
+	for _, params := range [][3]int{{1 << 21, 8, 1}, {32768, 1 << 20, 1}, {32768, 8, 1 << 29}, {1000, 8, 1}, {32768, 0, 1}} {
+		b := backup{}
+		json.Unmarshal(backupBuf.Bytes(), &b)
+		b.N, b.R, b.P = params[0], params[1], params[2]
+		crafted, _ := json.Marshal(b)
+
+		if _, err := readBackup(bytes.NewReader(crafted), "backup passphrase"); err == nil || !strings.Contains(err.Error(), "scrypt") {
+			t.Errorf("expected N=%d r=%d p=%d to be rejected, got %v", params[0], params[1], params[2], err)
+		}
+	}
+
+	restoredName := "restoreTest"
+	restored, err := newVault()
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	os.Remove(filepath.Join(restored.configFolderPath, restoredName))
+
+	count, err := restored.restoreBackup(&backupBuf, "backup passphrase", restoredName, "2222")
+	if err != nil {
+		t.Fatalf("Error restoring backup: %v", err)
+	}
+
+	if count != 3 {
+		t.Errorf("expected 3 restored entries, got %d", count)
+	}
+
+	user, pass, err = restored.getPassword("github")
+	if err != nil || user != "octocat" || pass != "hunter2" {
+		t.Error("Error getting restored password")
+	}
+
+	if _, err := restored.getTOTP("github"); err != nil {
+		t.Errorf("Error getting restored TOTP secret: %v", err)
+	}
+}
+
+func newSignedInVault(t *testing.T, name, password string) *Vault {
+	vault, err := newVault()
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+
+	os.Remove(filepath.Join(vault.configFolderPath, name))
+
+	if err := vault.createVault(name, password); err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+
+	if err := vault.signIn(name, password); err != nil {
+		t.Fatalf("Error signing in: %v", err)
+	}
+
+	return vault
+}
@@ -13,7 +13,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/term"
@@ -86,8 +86,6 @@ func (v *Vault) signIn(name string, password string) error {
 	}
 	defer file.Close()
 
-	fmt.Println(file)
-
 	scanner := bufio.NewScanner(file)
 	var namePassword string
 	if scanner.Scan() {
@@ -112,78 +110,78 @@ func (v *Vault) signIn(name string, password string) error {
 	return nil
 }
 
+// lock zeroes the key so it does not stay in memory after signing out
+func (v *Vault) lock() {
+	for i := range v.secretKey {
+		v.secretKey[i] = 0
+	}
+	v.secretKey = nil
+	v.name = ""
+}
+
 func (v *Vault) addPassword(name, username, password string) error {
-	fileData := filepath.Join(v.configFolderPath, v.name)
-	file, err := v.getFileVault(fileData)
+	return v.addEntry(entry{name: name, username: username, password: password})
+}
+
+func (v *Vault) getPassword(name string) (string, string, error) {
+	e, err := v.getEntry(name)
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	defer file.Close()
 
-	encryptedPassword, err := v.encrypt([]byte(password), []byte(v.secretKey))
+	return e.username, e.password, nil
+}
+
+func (v *Vault) setTOTP(name, secret string) error {
+	config, err := parseTOTP(secret)
 	if err != nil {
 		return err
 	}
 
-	scanner := bufio.NewScanner(file)
-	scanner.Scan()
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		split := strings.Split(line, ":")
-
-		if len(split) != 3 {
-			return errors.New("invalid vault file")
-		}
-
-		if split[0] == name {
-			return errors.New("name already exists")
-		}
+	e, err := v.getEntry(name)
+	if err != nil {
+		return err
 	}
 
-	file.Write([]byte(name + ":" + username + ":" + encryptedPassword + "\n"))
-
-	return nil
+	e.totp = config.uri()
+	return v.updateEntry(e)
 }
 
-func (v *Vault) getPassword(name string) (string, string, error) {
-	fileData := filepath.Join(v.configFolderPath, v.name)
-	file, err := v.createFileVault(fileData)
+func (v *Vault) getTOTP(name string) (totpConfig, error) {
+	s, err := v.findStoredEntry(name)
 	if err != nil {
-		return "", "", err
+		return totpConfig{}, err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	scanner.Scan()
+	if s.totp == "" {
+		return totpConfig{}, errors.New("no TOTP secret stored for " + name)
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
+	uri, err := v.decrypt(s.totp, v.secretKey)
+	if err != nil {
+		return totpConfig{}, err
+	}
 
-		split := strings.Split(line, ":")
+	return parseTOTP(uri)
+}
 
-		if len(split) != 3 {
-			return "", "", errors.New("invalid vault file")
-		}
+// entries returns every entry of the signed in vault fully decrypted
+func (v *Vault) entries() ([]entry, error) {
+	_, stored, err := v.readVault()
+	if err != nil {
+		return nil, err
+	}
 
-		if split[0] == name {
-			decryptedPassword, err := v.decrypt(split[2], v.secretKey)
-			if err != nil {
-				return "", "", err
-			}
-			return split[1], decryptedPassword, nil
+	entries := []entry{}
+	for _, s := range stored {
+		e, err := v.decryptEntry(s)
+		if err != nil {
+			return nil, err
 		}
+		entries = append(entries, e)
 	}
 
-	return "", "", errors.New("password not found")
-
+	return entries, nil
 }
 
 func (v *Vault) createFileVault(filePath string) (*os.File, error) {
@@ -278,6 +276,14 @@ func (v *Vault) decrypt(ciphertext string, key []byte) (string, error) {
 // save username - password pairs in a file enctrypted
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	vault, err := newVault()
 	if err != nil {
 		panic(err)
@@ -292,6 +298,11 @@ func main() {
 		fmt.Println("2. Sign In")
 		fmt.Println("3. Add Password")
 		fmt.Println("4. Get Password")
+		fmt.Println("5. Generate Password")
+		fmt.Println("6. Set TOTP Secret")
+		fmt.Println("7. Get TOTP Code")
+		fmt.Println("8. Search")
+		fmt.Println("9. Sign Out")
 		fmt.Println("Quit (q)")
 
 		fmt.Scanln(&userInput)
@@ -338,17 +349,116 @@ func main() {
 			var name string
 			fmt.Scanln(&name)
 
-			username, password, err := vault.getPassword(name)
+			e, err := vault.getEntry(name)
 			if err != nil {
 				fmt.Println("Error getting password: ", err)
 				continue
 			}
 
-			fmt.Println("Username: ", username)
-			fmt.Println("Password: ", password)
+			printEntry(e)
+
+			fmt.Println("Password: (c) copy to clipboard, (r) reveal, (s) show, enter to skip")
+			var mode string
+			fmt.Scanln(&mode)
+
+			switch mode {
+			case "c":
+				err = copyOSC52Background(e.password, 20*time.Second)
+			case "r":
+				err = delivery{reveal: true}.deliver(e.password)
+			case "s":
+				err = delivery{show: true}.deliver(e.password)
+			}
+
+			if err != nil {
+				fmt.Println("Error delivering password: ", err)
+			}
 			fmt.Println()
 
+		case "5":
+			fmt.Print("Number of passphrase words (empty for a random password): ")
+			var words int
+			fmt.Scanln(&words)
+
+			if words > 0 {
+				passphrase, err := generatePassphrase(words, "-")
+				if err != nil {
+					fmt.Println("Error generating passphrase: ", err)
+					continue
+				}
+				printGenerated(passphrase, passphraseEntropy(words))
+				fmt.Println()
+				continue
+			}
+
+			policy := defaultPasswordPolicy()
+			fmt.Printf("Password length (default %d): ", policy.length)
+			var length int
+			fmt.Scanln(&length)
+			if length > 0 {
+				policy.length = length
+			}
+
+			password, err := generatePassword(policy)
+			if err != nil {
+				fmt.Println("Error generating password: ", err)
+				continue
+			}
+			printGenerated(password, policy.entropy())
+			fmt.Println()
+
+		case "6":
+			fmt.Println("Enter the name of the password to add the TOTP secret to")
+			var name string
+			fmt.Scanln(&name)
+
+			fmt.Print("Enter the base32 secret or otpauth:// URI: ")
+			secretBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			if err != nil {
+				fmt.Println("Error reading secret: ", err)
+				continue
+			}
+
+			err = vault.setTOTP(name, string(secretBytes))
+			if err != nil {
+				fmt.Println("Error setting TOTP secret: ", err)
+			}
+
+		case "7":
+			fmt.Println("Enter the name of the password you want the TOTP code for")
+			var name string
+			fmt.Scanln(&name)
+
+			config, err := vault.getTOTP(name)
+			if err != nil {
+				fmt.Println("Error getting TOTP secret: ", err)
+				continue
+			}
+
+			printTOTPCode(config)
+			fmt.Println()
+
+		case "8":
+			fmt.Println("Enter the search text")
+			var query string
+			fmt.Scanln(&query)
+
+			entries, err := vault.search(query)
+			if err != nil {
+				fmt.Println("Error searching: ", err)
+				continue
+			}
+
+			printEntryList(entries)
+			fmt.Println()
+
+		case "9":
+			vault.lock()
+			fmt.Println("Signed out")
+
 		case "q":
+			vault.lock()
 			fmt.Println("Goodbye!")
 			os.Exit(0)
 		}
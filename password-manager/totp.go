@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type totpConfig struct {
+	secret    []byte
+	algorithm string
+	digits    int
+	period    int
+}
+
+// parseTOTP accepts either a base32 secret or an otpauth://totp/ URI
+func parseTOTP(input string) (totpConfig, error) {
+	config := totpConfig{algorithm: "SHA1", digits: 6, period: 30}
+
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "otpauth://") {
+		secret, err := decodeBase32Secret(input)
+		if err != nil {
+			return config, err
+		}
+		config.secret = secret
+		return config, nil
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return config, err
+	}
+
+	if u.Host != "totp" {
+		return config, fmt.Errorf("unsupported otpauth type %q", u.Host)
+	}
+
+	query := u.Query()
+	secret, err := decodeBase32Secret(query.Get("secret"))
+	if err != nil {
+		return config, err
+	}
+	config.secret = secret
+
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		config.algorithm = strings.ToUpper(algorithm)
+	}
+
+	if digits := query.Get("digits"); digits != "" {
+		config.digits, err = strconv.Atoi(digits)
+		if err != nil {
+			return config, fmt.Errorf("invalid digits %q", digits)
+		}
+	}
+
+	if period := query.Get("period"); period != "" {
+		config.period, err = strconv.Atoi(period)
+		if err != nil {
+			return config, fmt.Errorf("invalid period %q", period)
+		}
+	}
+
+	return config, config.validate()
+}
+
+func (c totpConfig) validate() error {
+	if _, err := c.hashFunc(); err != nil {
+		return err
+	}
+
+	if c.digits != 6 && c.digits != 8 {
+		return fmt.Errorf("unsupported number of digits %d", c.digits)
+	}
+
+	if c.period <= 0 {
+		return errors.New("period must be greater than 0")
+	}
+
+	return nil
+}
+
+func (c totpConfig) hashFunc() (func() hash.Hash, error) {
+	switch c.algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", c.algorithm)
+	}
+}
+
+// uri serializes the config so it can be stored encrypted in the vault
+func (c totpConfig) uri() string {
+	query := url.Values{}
+	query.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(c.secret))
+	query.Set("algorithm", c.algorithm)
+	query.Set("digits", strconv.Itoa(c.digits))
+	query.Set("period", strconv.Itoa(c.period))
+
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/", RawQuery: query.Encode()}
+	return u.String()
+}
+
+// code returns the TOTP code for the given time and the seconds it stays valid
+func (c totpConfig) code(t time.Time) (string, int, error) {
+	if err := c.validate(); err != nil {
+		return "", 0, err
+	}
+
+	hashFunc, _ := c.hashFunc()
+	unix := t.Unix()
+	counter := uint64(unix / int64(c.period))
+	remaining := c.period - int(unix%int64(c.period))
+
+	return hotp(hashFunc, c.secret, counter, c.digits), remaining, nil
+}
+
+// hotp implements the RFC 4226 HMAC-based one-time password
+func hotp(hashFunc func() hash.Hash, secret []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(hashFunc, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func decodeBase32Secret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	if secret == "" {
+		return nil, errors.New("empty TOTP secret")
+	}
+
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base32 secret: %v", err)
+	}
+
+	return decoded, nil
+}
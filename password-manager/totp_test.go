@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B
+func TestTOTPCode(t *testing.T) {
+	secrets := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	tests := []struct {
+		time      int64
+		algorithm string
+		expected  string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tt := range tests {
+		config := totpConfig{secret: secrets[tt.algorithm], algorithm: tt.algorithm, digits: 8, period: 30}
+		code, remaining, err := config.code(time.Unix(tt.time, 0))
+		if err != nil {
+			t.Fatalf("Error generating code: %v", err)
+		}
+
+		if code != tt.expected {
+			t.Errorf("%s at %d: expected %s, got %s", tt.algorithm, tt.time, tt.expected, code)
+		}
+
+		if expected := 30 - int(tt.time%30); remaining != expected {
+			t.Errorf("%s at %d: expected %d seconds remaining, got %d", tt.algorithm, tt.time, expected, remaining)
+		}
+	}
+}
+
+func TestParseTOTP(t *testing.T) {
+	// base32 of "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	config, err := parseTOTP(secret)
+	if err != nil {
+		t.Fatalf("Error parsing secret: %v", err)
+	}
+
+	code, _, err := config.code(time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("Error generating code: %v", err)
+	}
+
+	if code != "287082" {
+		t.Errorf("expected 287082, got %s", code)
+	}
+
+	config, err = parseTOTP("otpauth://totp/Example:alice@example.com?secret=" + secret + "&issuer=Example&algorithm=SHA256&digits=8&period=60")
+	if err != nil {
+		t.Fatalf("Error parsing URI: %v", err)
+	}
+
+	if config.algorithm != "SHA256" || config.digits != 8 || config.period != 60 {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	roundTrip, err := parseTOTP(config.uri())
+	if err != nil {
+		t.Fatalf("Error parsing URI: %v", err)
+	}
+
+	if string(roundTrip.secret) != string(config.secret) || roundTrip.algorithm != config.algorithm ||
+		roundTrip.digits != config.digits || roundTrip.period != config.period {
+		t.Errorf("expected %+v, got %+v", config, roundTrip)
+	}
+
+	invalid := []string{
+		"",
+		"not base32!",
+		"otpauth://hotp/Example?secret=" + secret,
+		"otpauth://totp/Example?secret=" + secret + "&algorithm=MD5",
+		"otpauth://totp/Example?secret=" + secret + "&digits=7",
+	}
+	for _, input := range invalid {
+		if _, err := parseTOTP(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestSetTOTP(t *testing.T) {
+	vault, err := newVault()
+	if err != nil {
+		t.Errorf("Error creating vault: %v", err)
+	}
+
+	name := "totpTest"
+	password := "1111"
+
+	filePath := filepath.Join(vault.configFolderPath, name)
+	os.Remove(filePath)
+
+	err = vault.createVault(name, password)
+	if err != nil {
+		t.Errorf("Error creating vault: %v", err)
+	}
+
+	err = vault.signIn(name, password)
+	if err != nil {
+		t.Errorf("Error signing in: %v", err)
+	}
+
+	err = vault.addPassword("github", "myuser", "testpass")
+	if err != nil {
+		t.Errorf("Error adding password: %v", err)
+	}
+
+	_, err = vault.getTOTP("github")
+	if err == nil {
+		t.Error("Should return error when no TOTP secret is stored")
+	}
+
+	err = vault.setTOTP("github", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Errorf("Error setting TOTP secret: %v", err)
+	}
+
+	config, err := vault.getTOTP("github")
+	if err != nil {
+		t.Errorf("Error getting TOTP secret: %v", err)
+	}
+
+	if string(config.secret) != "12345678901234567890" {
+		t.Errorf("unexpected TOTP secret %q", config.secret)
+	}
+
+	user, pass, err := vault.getPassword("github")
+	if err != nil || user != "myuser" || pass != "testpass" {
+		t.Error("Error getting password after setting TOTP secret")
+	}
+
+	err = vault.setTOTP("missing", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err == nil {
+		t.Error("Should return error when password not found")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Compare reports to out the differences between the members and the files
+// below path, it returns how many members differ
+func (t *Tar) Compare(path string, out io.Writer) (int, error) {
+	if path == "" {
+		path = "."
+	}
+
+	decompressor, err := newDecompressor(t.file, t.Compression)
+	if err != nil {
+		return 0, err
+	}
+	defer decompressor.Close()
+
+	members := newMemberPatterns(t.Members)
+	tarReader := NewReader(decompressor)
+	differ := 0
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return differ, err
+		}
+
+		if !members.match(header.Name) {
+			continue
+		}
+
+		if t.Verbose {
+			fmt.Fprintln(out, header.Name)
+		}
+
+		// names are checked like on extraction, so no file outside of path
+		// is read
+		name, err := memberName(header.Name, 0)
+		if err != nil {
+			return differ, err
+		}
+
+		target := filepath.Join(path, filepath.FromSlash(name))
+		reason, err := compareMember(header, target, path, tarReader)
+		if err != nil {
+			return differ, err
+		}
+
+		if reason != "" {
+			fmt.Fprintf(out, "%s: %s\n", header.Name, reason)
+			differ++
+		}
+	}
+
+	return differ, members.missing()
+}
+
+// compareMember returns why the file differs from the member, or an empty
+// string when they are the same
+func compareMember(h *Header, target, root string, r io.Reader) (string, error) {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return "Warning: Cannot stat: No such file or directory", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if h.Typeflag == TypeLink {
+		linkname, err := memberName(h.Linkname, 0)
+		if err != nil {
+			return "", err
+		}
+
+		linked, err := os.Lstat(filepath.Join(root, filepath.FromSlash(linkname)))
+		if err != nil || !os.SameFile(info, linked) {
+			return "Not linked to " + h.Linkname, nil
+		}
+		return "", nil
+	}
+
+	if fileType(info.Mode()) != normalizedType(h.Typeflag) {
+		return "File type differs", nil
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(target)
+		if err != nil {
+			return "", err
+		}
+		if link != h.Linkname {
+			return "Symlink differs", nil
+		}
+		return "", nil
+	}
+
+	if info.Mode().Perm() != os.FileMode(h.Mode).Perm() {
+		return "Mode differs", nil
+	}
+
+	if stat, ok := statFile(info); ok {
+		if stat.uid != h.Uid {
+			return "Uid differs", nil
+		}
+		if stat.gid != h.Gid {
+			return "Gid differs", nil
+		}
+	}
+
+	if info.ModTime().Unix() != h.ModTime.Unix() {
+		return "Mod time differs", nil
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	if info.Size() != h.Size {
+		return "Size differs", nil
+	}
+
+	same, err := sameContent(target, r)
+	if err != nil || same {
+		return "", err
+	}
+	return "Contents differ", nil
+}
+
+func sameContent(path string, r io.Reader) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	fileBuf := make([]byte, 32*1024)
+	memberBuf := make([]byte, 32*1024)
+	for {
+		n, fileErr := io.ReadFull(file, fileBuf)
+		m, memberErr := io.ReadFull(r, memberBuf)
+		if !bytes.Equal(fileBuf[:n], memberBuf[:m]) {
+			return false, nil
+		}
+
+		fileDone := fileErr == io.EOF || fileErr == io.ErrUnexpectedEOF
+		memberDone := memberErr == io.EOF || memberErr == io.ErrUnexpectedEOF
+		if fileErr != nil && !fileDone {
+			return false, fileErr
+		}
+		if memberErr != nil && !memberDone {
+			return false, memberErr
+		}
+
+		if fileDone || memberDone {
+			return fileDone == memberDone, nil
+		}
+	}
+}
+
+// fileType returns the type flag matching the file mode
+func fileType(mode os.FileMode) byte {
+	switch {
+	case mode.IsRegular():
+		return TypeReg
+	case mode.IsDir():
+		return TypeDir
+	case mode&os.ModeSymlink != 0:
+		return TypeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		return TypeFifo
+	case mode&os.ModeCharDevice != 0:
+		return TypeChar
+	case mode&os.ModeDevice != 0:
+		return TypeBlock
+	}
+	return 0xff
+}
+
+func normalizedType(typeflag byte) byte {
+	if typeflag == TypeRegA || typeflag == TypeCont {
+		return TypeReg
+	}
+	return typeflag
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	dsbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionBzip2
+	CompressionXz
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionBzip2:
+		return "bzip2"
+	case CompressionXz:
+		return "xz"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return "none"
+}
+
+var compressionMagics = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionBzip2, []byte("BZh")},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// detectCompression looks at the first bytes of the stream without
+// consuming them
+func detectCompression(r *bufio.Reader) Compression {
+	// a short read means a tiny or empty stream, Peek returns what it has
+	start, _ := r.Peek(6)
+	for _, m := range compressionMagics {
+		if bytes.HasPrefix(start, m.magic) {
+			return m.compression
+		}
+	}
+	return CompressionNone
+}
+
+// newDecompressor returns a reader of the uncompressed archive. The
+// compression is detected from the magic bytes when c is CompressionNone
+func newDecompressor(r io.Reader, c Compression) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	detected := detectCompression(br)
+	if c == CompressionNone {
+		c = detected
+	} else if c != detected {
+		return nil, fmt.Errorf("archive is not %s compressed", c)
+	}
+
+	switch c {
+	case CompressionGzip:
+		return gzip.NewReader(br)
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	case CompressionXz:
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// newCompressor returns a writer that compresses to w, closing it flushes
+// the compressed stream but does not close w
+func newCompressor(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionBzip2:
+		return dsbzip2.NewWriter(w, nil)
+	case CompressionXz:
+		return xz.NewWriter(w)
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var compressionTools = map[Compression]string{
+	CompressionGzip:  "gzip",
+	CompressionBzip2: "bzip2",
+	CompressionXz:    "xz",
+	CompressionZstd:  "zstd",
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionBzip2, CompressionXz, CompressionZstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			chdir(t, dir)
+
+			if err := os.MkdirAll("src/sub", 0755); err != nil {
+				t.Fatal(err)
+			}
+			content := bytes.Repeat([]byte("compressed content\n"), 1000)
+			if err := os.WriteFile("src/sub/file.txt", content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			tar, err := NewTar("archive", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tar.Compression = compression
+			if err := tar.CreateTar([]string{"src"}); err != nil {
+				t.Fatalf("Error creating tar: %v", err)
+			}
+
+			file, err := os.Open("archive")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			// read through a pipe so nothing can seek
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				io.Copy(w, file)
+				w.Close()
+			}()
+
+			extracted := &Tar{file: r}
+			defer extracted.Close()
+			if err := extracted.ExtractFiles("out"); err != nil {
+				t.Fatalf("Error extracting: %v", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join("out", "src/sub/file.txt"))
+			if err != nil || !bytes.Equal(got, content) {
+				t.Errorf("unexpected content after round trip: %v", err)
+			}
+
+			tool, ok := compressionTools[compression]
+			if !ok {
+				return
+			}
+			if _, err := exec.LookPath(tool); err != nil {
+				t.Skipf("%s not installed", tool)
+			}
+			if out, err := exec.Command(tool, "-t", "archive").CombinedOutput(); err != nil {
+				t.Errorf("%s rejects the archive: %v\n%s", tool, err, out)
+			}
+		})
+	}
+}
+
+func TestDetectCompressionMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	tw := NewWriter(&buf)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newDecompressor(bytes.NewReader(buf.Bytes()), CompressionGzip); err == nil {
+		t.Errorf("expected an error reading a plain archive as gzip")
+	}
+
+	r, err := newDecompressor(bytes.NewReader(nil), CompressionNone)
+	if err != nil {
+		t.Fatalf("Error reading empty input: %v", err)
+	}
+	if _, err := NewReader(r).Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	modeSetuid = 04000
+	modeSetgid = 02000
+	modeSticky = 01000
+)
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// archiver walks the files given on the command line and writes them to
+// the archive
+type archiver struct {
+	tw       *Writer
+	excludes []string
+	archive  os.FileInfo // the archive being written, never added to itself
+	links    map[fileID]string
+	users    map[int]string
+	groups   map[int]string
+	skip     func(*Header) bool // leaves out files, used when updating
+	verbose  io.Writer          // receives the names of the added files
+
+	// reproducible strips what depends on the machine or the time the
+	// files were created, every member gets epoch as its mtime
+	reproducible bool
+	epoch        time.Time
+}
+
+func newArchiver(tw *Writer, excludes []string, archive os.FileInfo) *archiver {
+	return &archiver{
+		tw:       tw,
+		excludes: excludes,
+		archive:  archive,
+		links:    map[fileID]string{},
+		users:    map[int]string{},
+		groups:   map[int]string{},
+	}
+}
+
+// addAll archives the roots in order, sorted by name when reproducible as
+// the walk only sorts the contents of directories
+func (a *archiver) addAll(roots []string) error {
+	if a.reproducible {
+		roots = append([]string(nil), roots...)
+		sort.Strings(roots)
+	}
+
+	for _, root := range roots {
+		if err := a.add(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add archives root, and everything below it when it is a directory
+func (a *archiver) add(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if a.excluded(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if a.archive != nil && os.SameFile(info, a.archive) {
+			fmt.Fprintf(os.Stderr, "tar: %s: file is the archive; not dumped\n", path)
+			return nil
+		}
+
+		return a.addFile(path, info)
+	})
+}
+
+func (a *archiver) addFile(path string, info os.FileInfo) error {
+	header, err := a.header(path, info)
+	if err != nil {
+		return err
+	}
+
+	if header == nil {
+		fmt.Fprintf(os.Stderr, "tar: %s: socket ignored\n", path)
+		return nil
+	}
+
+	if a.reproducible {
+		a.normalize(header)
+	}
+
+	if a.skip != nil && a.skip(header) {
+		return nil
+	}
+
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if a.verbose != nil {
+		fmt.Fprintln(a.verbose, header.Name)
+	}
+
+	if header.Typeflag != TypeReg || header.Size == 0 {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(a.tw, file, header.Size)
+	return err
+}
+
+// header returns nil for files that cannot be archived
+func (a *archiver) header(path string, info os.FileInfo) (*Header, error) {
+	header := &Header{
+		Name:    archiveName(path, info.IsDir()),
+		Mode:    int64(info.Mode().Perm()),
+		ModTime: info.ModTime(),
+	}
+
+	if info.Mode()&os.ModeSetuid != 0 {
+		header.Mode |= modeSetuid
+	}
+	if info.Mode()&os.ModeSetgid != 0 {
+		header.Mode |= modeSetgid
+	}
+	if info.Mode()&os.ModeSticky != 0 {
+		header.Mode |= modeSticky
+	}
+
+	stat, ok := statFile(info)
+	if ok {
+		header.Uid = stat.uid
+		header.Gid = stat.gid
+		header.Uname = a.lookupUser(stat.uid)
+		header.Gname = a.lookupGroup(stat.gid)
+		header.AccessTime = stat.atime
+		header.ChangeTime = stat.ctime
+	}
+
+	mode := info.Mode()
+	switch {
+	case mode.IsRegular():
+		header.Typeflag = TypeReg
+		header.Size = info.Size()
+
+		if ok && stat.nlink > 1 {
+			id := fileID{dev: stat.dev, ino: stat.ino}
+			if target, seen := a.links[id]; seen {
+				header.Typeflag = TypeLink
+				header.Linkname = target
+				header.Size = 0
+			} else {
+				a.links[id] = header.Name
+			}
+		}
+	case mode.IsDir():
+		header.Typeflag = TypeDir
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		header.Typeflag = TypeSymlink
+		header.Linkname = target
+	case mode&os.ModeNamedPipe != 0:
+		header.Typeflag = TypeFifo
+	case mode&os.ModeDevice != 0:
+		header.Typeflag = TypeBlock
+		if mode&os.ModeCharDevice != 0 {
+			header.Typeflag = TypeChar
+		}
+		if ok {
+			header.Devmajor = stat.devmajor
+			header.Devminor = stat.devminor
+		}
+	default:
+		return nil, nil
+	}
+
+	if header.Typeflag == TypeSymlink {
+		return header, nil
+	}
+
+	xattrs, err := readXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range xattrs {
+		if header.PAXRecords == nil {
+			header.PAXRecords = map[string]string{}
+		}
+		header.PAXRecords["SCHILY.xattr."+name] = value
+	}
+
+	return header, nil
+}
+
+// normalize makes the header independent of who created the files and
+// when
+func (a *archiver) normalize(header *Header) {
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+	header.ModTime = a.epoch
+	header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+	header.PAXRecords = nil
+
+	switch {
+	case header.Typeflag == TypeSymlink:
+		header.Mode = 0777
+	case header.Typeflag == TypeDir || header.Mode&0100 != 0:
+		header.Mode = 0755
+	default:
+		header.Mode = 0644
+	}
+}
+
+// sourceDateEpoch returns the time in SOURCE_DATE_EPOCH, the Unix epoch
+// when it is not set
+func sourceDateEpoch() (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Unix(0, 0), nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", value)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// excluded matches the patterns against the whole path and against its
+// base name, like GNU tar does for patterns without a slash
+func (a *archiver) excluded(path string) bool {
+	clean := filepath.ToSlash(filepath.Clean(path))
+	for _, pattern := range a.excludes {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if ok, _ := filepath.Match(pattern, clean); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(clean)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *archiver) lookupUser(uid int) string {
+	if name, ok := a.users[uid]; ok {
+		return name
+	}
+
+	name := ""
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	a.users[uid] = name
+	return name
+}
+
+func (a *archiver) lookupGroup(gid int) string {
+	if name, ok := a.groups[gid]; ok {
+		return name
+	}
+
+	name := ""
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		name = g.Name
+	}
+	a.groups[gid] = name
+	return name
+}
+
+// archiveName converts the path to the member name: slash separated,
+// without leading slashes and with a trailing slash for directories
+func archiveName(path string, isDir bool) string {
+	name := filepath.ToSlash(filepath.Clean(path))
+	name = strings.TrimLeft(name, "/")
+	if name == "" {
+		name = "."
+	}
+
+	if isDir && !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	return name
+}
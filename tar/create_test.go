@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// chdir moves to dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(old) })
+}
+
+func TestCreateRecursive(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	files := map[string]string{
+		"tree/a.txt":        "a\n",
+		"tree/sub/b.txt":    "b\n",
+		"tree/sub/skip.log": "log\n",
+		"tree/logs/c.txt":   "c\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("a.txt", "tree/link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link("tree/a.txt", "tree/sub/hard"); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo("tree/fifo", 0600); err != nil {
+		t.Fatal(err)
+	}
+	hasXattr := syscall.Setxattr("tree/sub/b.txt", "user.comment", []byte("hi"), 0) == nil
+
+	tar, err := NewTar("tree/out.tar", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tar.Exclude = []string{"*.log", "tree/logs"}
+
+	if err := tar.CreateTar([]string{"tree"}); err != nil {
+		t.Fatalf("Error creating tar: %v", err)
+	}
+
+	data, err := os.ReadFile("tree/out.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]*Header{}
+	contents := map[string]string{}
+	tr := NewReader(bytes.NewReader(data))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error reading tar: %v", err)
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[h.Name] = h
+		contents[h.Name] = string(content)
+	}
+
+	expected := map[string]byte{
+		"tree/":          TypeDir,
+		"tree/a.txt":     TypeReg,
+		"tree/sub/":      TypeDir,
+		"tree/sub/b.txt": TypeReg,
+		"tree/sub/hard":  TypeLink,
+		"tree/link":      TypeSymlink,
+		"tree/fifo":      TypeFifo,
+	}
+	if len(headers) != len(expected) {
+		t.Errorf("expected %d members, got %d: %v", len(expected), len(headers), headers)
+	}
+	for name, typeflag := range expected {
+		h, ok := headers[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if h.Typeflag != typeflag {
+			t.Errorf("%s: expected type %c, got %c", name, typeflag, h.Typeflag)
+		}
+	}
+
+	if h := headers["tree/link"]; h != nil && h.Linkname != "a.txt" {
+		t.Errorf("expected symlink to a.txt, got %q", h.Linkname)
+	}
+	if h := headers["tree/sub/hard"]; h != nil && h.Linkname != "tree/a.txt" {
+		t.Errorf("expected hardlink to tree/a.txt, got %q", h.Linkname)
+	}
+	if contents["tree/sub/b.txt"] != "b\n" {
+		t.Errorf("unexpected content %q", contents["tree/sub/b.txt"])
+	}
+	if h := headers["tree/a.txt"]; h != nil && (h.Uid != os.Getuid() || h.AccessTime.IsZero()) {
+		t.Errorf("expected owner and access time, got uid %d atime %v", h.Uid, h.AccessTime)
+	}
+	if h := headers["tree/sub/b.txt"]; hasXattr && h != nil && h.PAXRecords["SCHILY.xattr.user.comment"] != "hi" {
+		t.Errorf("expected xattr, got %v", h.PAXRecords)
+	}
+}
+
+func TestCreateReproducible(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	// the same tree, created in a different order, with other times and
+	// permissions that normalize to the same ones
+	build := func(mtime time.Time, perm os.FileMode, reverse bool) [32]byte {
+		dir := t.TempDir()
+		chdir(t, dir)
+
+		names := []string{"tree/a.txt", "tree/sub/b.txt", "tree/sub/c.txt", "tree/z.txt"}
+		if reverse {
+			for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+				names[i], names[j] = names[j], names[i]
+			}
+		}
+		for _, name := range names {
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(name, []byte(name), perm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Symlink("a.txt", "tree/link"); err != nil {
+			t.Fatal(err)
+		}
+
+		tar, err := NewTar("out.tar", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the operands are sorted too
+		args := []string{"tree/z.txt", "tree"}
+		if reverse {
+			args[0], args[1] = args[1], args[0]
+		}
+		tar.Reproducible = true
+		if err := tar.CreateTar(args); err != nil {
+			t.Fatalf("Error creating tar: %v", err)
+		}
+
+		data, err := os.ReadFile("out.tar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sha256.Sum256(data)
+	}
+
+	first := build(time.Unix(1600000000, 0), 0644, false)
+	second := build(time.Now(), 0600, true)
+	if first != second {
+		t.Errorf("expected the same hash, got %x and %x", first, second)
+	}
+
+	file, err := os.Open("out.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tr := NewReader(file)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.ModTime.Unix() != 1700000000 || h.Uid != 0 || h.Gid != 0 || h.Uname != "" || h.Gname != "" {
+			t.Errorf("%s: expected normalized owner and mtime, got %+v", h.Name, h)
+		}
+		if !h.AccessTime.IsZero() || !h.ChangeTime.IsZero() || h.PAXRecords != nil {
+			t.Errorf("%s: expected no atime, ctime or pax records, got %+v", h.Name, h)
+		}
+		if h.Typeflag == TypeReg && h.Mode != 0644 {
+			t.Errorf("%s: expected mode 0644, got %o", h.Name, h.Mode)
+		}
+	}
+}
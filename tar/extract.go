@@ -0,0 +1,475 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInsecurePath = errors.New("tar: insecure file path")
+	ErrNotFound     = errors.New("tar: not found in archive")
+)
+
+// extractor writes the members of an archive below dir, it never creates
+// or follows anything outside of it
+type extractor struct {
+	dir             string
+	stripComponents int
+	members         *memberPatterns
+	sameOwner       bool
+	dirs            []dirAttrs
+	uids            map[string]int
+	gids            map[string]int
+	verbose         io.Writer // receives the names of the extracted members
+}
+
+// dirAttrs keeps the mode and modification time of a directory, they are
+// restored once the directory contents have been extracted. info is the
+// directory created, to check the path still leads to it
+type dirAttrs struct {
+	path    string
+	info    os.FileInfo
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func newExtractor(dir string, stripComponents int, members []string) *extractor {
+	if dir == "" {
+		dir = "."
+	}
+
+	return &extractor{
+		dir:             dir,
+		stripComponents: stripComponents,
+		members:         newMemberPatterns(members),
+		sameOwner:       os.Geteuid() == 0,
+		uids:            map[string]int{},
+		gids:            map[string]int{},
+	}
+}
+
+// extract reads every member of the archive and restores the directory
+// times at the end
+func (e *extractor) extract(tr *Reader) error {
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		return err
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !e.members.match(header.Name) {
+			continue
+		}
+
+		if err := e.extractMember(header, tr); err != nil {
+			return err
+		}
+
+		if e.verbose != nil {
+			fmt.Fprintln(e.verbose, header.Name)
+		}
+	}
+
+	if err := e.restoreDirs(); err != nil {
+		return err
+	}
+	return e.members.missing()
+}
+
+// restoreDirs sets the mode and time of the directories extracted. Chmod
+// and Chtimes follow symlinks, so a path that is no longer the directory
+// created is skipped rather than changing whatever it points to
+func (e *extractor) restoreDirs() error {
+	for i := len(e.dirs) - 1; i >= 0; i-- {
+		d := e.dirs[i]
+
+		info, err := os.Lstat(d.path)
+		if err != nil || !info.IsDir() || !os.SameFile(info, d.info) {
+			continue
+		}
+
+		if err := os.Chmod(d.path, d.mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberPatterns selects members with glob patterns, it keeps which
+// patterns matched to report the ones not found in the archive
+type memberPatterns struct {
+	patterns []string
+	matched  map[string]bool
+}
+
+func newMemberPatterns(patterns []string) *memberPatterns {
+	return &memberPatterns{patterns: patterns, matched: map[string]bool{}}
+}
+
+// match reports whether the member matches one of the patterns, every
+// member matches when there are none. A pattern that matches a directory
+// selects everything below it, patterns without a slash are matched
+// against the base name too
+func (m *memberPatterns) match(name string) bool {
+	if len(m.patterns) == 0 {
+		return true
+	}
+
+	name = strings.TrimSuffix(name, "/")
+	for _, pattern := range m.patterns {
+		trimmed := strings.TrimSuffix(pattern, "/")
+		for prefix := name; prefix != "." && prefix != "/" && prefix != ""; prefix = path.Dir(prefix) {
+			ok, _ := path.Match(trimmed, prefix)
+			if !ok && !strings.Contains(trimmed, "/") {
+				ok, _ = path.Match(trimmed, path.Base(prefix))
+			}
+
+			if ok {
+				m.matched[pattern] = true
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// missing returns an error for the first pattern that matched nothing
+func (m *memberPatterns) missing() error {
+	for _, pattern := range m.patterns {
+		if !m.matched[pattern] {
+			return fmt.Errorf("%s: %w", pattern, ErrNotFound)
+		}
+	}
+	return nil
+}
+
+func (e *extractor) extractMember(h *Header, r io.Reader) error {
+	name, err := memberName(h.Name, e.stripComponents)
+	if err != nil || name == "" {
+		return err
+	}
+
+	target := filepath.Join(e.dir, filepath.FromSlash(name))
+	if err := e.prepare(name, h.Typeflag); err != nil {
+		return err
+	}
+
+	switch h.Typeflag {
+	case TypeReg, TypeRegA, TypeCont:
+		if err := writeFile(target, r); err != nil {
+			return err
+		}
+	case TypeDir:
+		if err := os.Mkdir(target, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case TypeSymlink:
+		if !e.safeLinkTarget(name, h.Linkname) {
+			return fmt.Errorf("%s: %w: symlink to %s", h.Name, ErrInsecurePath, h.Linkname)
+		}
+		if err := os.Symlink(h.Linkname, target); err != nil {
+			return err
+		}
+		return e.restoreOwner(target, h)
+	case TypeLink:
+		linkname, err := memberName(h.Linkname, e.stripComponents)
+		if err != nil {
+			return err
+		}
+		if linkname == "" {
+			return fmt.Errorf("%s: %w: hard link to %s", h.Name, ErrInsecurePath, h.Linkname)
+		}
+		if err := e.checkParents(linkname); err != nil {
+			return err
+		}
+		return os.Link(filepath.Join(e.dir, filepath.FromSlash(linkname)), target)
+	case TypeFifo:
+		if err := makeFifo(target); err != nil {
+			return err
+		}
+	case TypeChar, TypeBlock:
+		if err := makeDevice(target, h); err != nil {
+			fmt.Fprintf(os.Stderr, "tar: %s: cannot create device: %v\n", h.Name, err)
+			return nil
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "tar: %s: unknown file type %q, skipped\n", h.Name, h.Typeflag)
+		return nil
+	}
+
+	return e.restore(target, h)
+}
+
+// memberName validates the member name and removes stripComponents leading
+// components, asked with --strip-components. It returns an empty name for
+// the members that are stripped entirely
+func memberName(name string, stripComponents int) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%s: %w", name, ErrInsecurePath)
+	}
+
+	parts := []string{}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%s: %w", name, ErrInsecurePath)
+		}
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) <= stripComponents {
+		return "", nil
+	}
+	return strings.Join(parts[stripComponents:], "/"), nil
+}
+
+// prepare creates the parent directories of the member and removes what
+// is in the way, so files are never written through an existing symlink.
+// A directory is never replaced by a symlink, which would redirect the
+// members below it and the restore of its mode
+func (e *extractor) prepare(name string, typeflag byte) error {
+	if err := e.checkParents(name); err != nil {
+		return err
+	}
+
+	target := filepath.Join(e.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		switch typeflag {
+		case TypeDir:
+			return nil
+		case TypeSymlink:
+			return fmt.Errorf("%s: %w: cannot replace a directory by a symlink", name, ErrInsecurePath)
+		}
+	}
+	// only empty directories are replaced by files
+	return os.Remove(target)
+}
+
+// checkParents fails when one of the parent directories of the member is
+// a symlink, which could point outside the extraction directory
+func (e *extractor) checkParents(name string) error {
+	current := e.dir
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: %w: %s is a symlink", name, ErrInsecurePath, current)
+		}
+	}
+	return nil
+}
+
+// restore sets the ownership, mode and modification time of the member,
+// directories are done at the end so read-only ones can still be filled
+func (e *extractor) restore(target string, h *Header) error {
+	if err := e.restoreOwner(target, h); err != nil {
+		return err
+	}
+
+	if h.Typeflag == TypeDir {
+		info, err := os.Lstat(target)
+		if err != nil {
+			return err
+		}
+		e.dirs = append(e.dirs, dirAttrs{path: target, info: info, mode: e.fileMode(h), modTime: h.ModTime})
+		return nil
+	}
+
+	if err := os.Chmod(target, e.fileMode(h)); err != nil {
+		return err
+	}
+	return os.Chtimes(target, h.ModTime, h.ModTime)
+}
+
+// restoreOwner changes the owner when running as root, names are preferred
+// over numeric ids like GNU tar does
+func (e *extractor) restoreOwner(target string, h *Header) error {
+	if !e.sameOwner {
+		return nil
+	}
+
+	return os.Lchown(target, e.lookupUid(h), e.lookupGid(h))
+}
+
+func (e *extractor) fileMode(h *Header) os.FileMode {
+	mode := os.FileMode(h.Mode).Perm()
+	if !e.sameOwner {
+		return mode
+	}
+
+	if h.Mode&modeSetuid != 0 {
+		mode |= os.ModeSetuid
+	}
+	if h.Mode&modeSetgid != 0 {
+		mode |= os.ModeSetgid
+	}
+	if h.Mode&modeSticky != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+func (e *extractor) lookupUid(h *Header) int {
+	if h.Uname == "" {
+		return h.Uid
+	}
+
+	if uid, ok := e.uids[h.Uname]; ok {
+		return uid
+	}
+
+	uid := h.Uid
+	if u, err := user.Lookup(h.Uname); err == nil {
+		if id, err := strconv.Atoi(u.Uid); err == nil {
+			uid = id
+		}
+	}
+	e.uids[h.Uname] = uid
+	return uid
+}
+
+func (e *extractor) lookupGid(h *Header) int {
+	if h.Gname == "" {
+		return h.Gid
+	}
+
+	if gid, ok := e.gids[h.Gname]; ok {
+		return gid
+	}
+
+	gid := h.Gid
+	if g, err := user.LookupGroup(h.Gname); err == nil {
+		if id, err := strconv.Atoi(g.Gid); err == nil {
+			gid = id
+		}
+	}
+	e.gids[h.Gname] = gid
+	return gid
+}
+
+// maxLinks is how many symlinks are followed resolving a link target,
+// like the ELOOP limit of Linux
+const maxLinks = 40
+
+// safeLinkTarget reports whether a symlink created at name and pointing to
+// target stays inside the extraction directory. The target is resolved
+// through the symlinks already on disk, a chain of links each staying
+// inside could lead out otherwise
+func (e *extractor) safeLinkTarget(name, target string) bool {
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) {
+		return false
+	}
+
+	links := 0
+	_, ok := e.resolve(path.Dir(name), target, &links)
+	return ok
+}
+
+// resolve walks target from dir, both relative to the extraction
+// directory, following the symlinks found. It returns the path reached and
+// false when the walk leaves the extraction directory, meets an absolute
+// symlink or too many links
+func (e *extractor) resolve(dir, target string, links *int) (string, bool) {
+	parts := []string{}
+	if dir != "." {
+		parts = strings.Split(dir, "/")
+	}
+
+	for _, part := range strings.Split(target, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(parts) == 0 {
+				return "", false
+			}
+			parts = parts[:len(parts)-1]
+			continue
+		}
+
+		current := path.Join(append(parts, part)...)
+		full := filepath.Join(e.dir, filepath.FromSlash(current))
+		info, err := os.Lstat(full)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			parts = append(parts, part)
+			continue
+		}
+
+		*links++
+		if *links > maxLinks {
+			return "", false
+		}
+		link, err := os.Readlink(full)
+		if err != nil || link == "" || path.IsAbs(link) || filepath.IsAbs(link) {
+			return "", false
+		}
+
+		resolved, ok := e.resolve(path.Join(parts...), link, links)
+		if !ok {
+			return "", false
+		}
+		parts = parts[:0]
+		if resolved != "." {
+			parts = strings.Split(resolved, "/")
+		}
+	}
+
+	if len(parts) == 0 {
+		return ".", true
+	}
+	return path.Join(parts...), true
+}
+
+// writeFile creates a new file, closing it before the next member is read
+func writeFile(target string, r io.Reader) error {
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
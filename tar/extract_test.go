@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testMember struct {
+	header  Header
+	content string
+}
+
+// writeArchive writes the members to a new archive and opens it
+func writeArchive(t *testing.T, members []testMember) *Tar {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "test.tar")
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tw := NewWriter(file)
+	for _, m := range members {
+		h := m.header
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+		h.Size = int64(len(m.content))
+		if err := tw.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(m.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tar, err := NewTar(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tar.Close() })
+	return tar
+}
+
+func TestExtractTree(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	tar := writeArchive(t, []testMember{
+		{header: Header{Typeflag: TypeDir, Name: "dir/", Mode: 0750, ModTime: mtime}},
+		{header: Header{Typeflag: TypeReg, Name: "dir/file.txt", Mode: 0640, ModTime: mtime}, content: "hello\n"},
+		{header: Header{Typeflag: TypeReg, Name: "other/nested/file.txt"}, content: "nested\n"},
+		{header: Header{Typeflag: TypeSymlink, Name: "dir/link", Linkname: "file.txt"}},
+		{header: Header{Typeflag: TypeLink, Name: "dir/hard", Linkname: "dir/file.txt"}},
+		{header: Header{Typeflag: TypeFifo, Name: "dir/fifo"}},
+	})
+
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := tar.ExtractFiles(dir); err != nil {
+		t.Fatalf("Error extracting: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "dir/link"))
+	if err != nil || string(content) != "hello\n" {
+		t.Errorf("expected content through symlink, got %q, %v", content, err)
+	}
+
+	content, err = os.ReadFile(filepath.Join(dir, "other/nested/file.txt"))
+	if err != nil || string(content) != "nested\n" {
+		t.Errorf("expected nested content, got %q, %v", content, err)
+	}
+
+	file, _ := os.Stat(filepath.Join(dir, "dir/file.txt"))
+	hard, _ := os.Stat(filepath.Join(dir, "dir/hard"))
+	if file == nil || hard == nil || !os.SameFile(file, hard) {
+		t.Errorf("expected dir/hard to be a hard link of dir/file.txt")
+	}
+	if file != nil && (file.Mode().Perm() != 0640 || !file.ModTime().Equal(mtime)) {
+		t.Errorf("expected mode 0640 and mtime %v, got %v %v", mtime, file.Mode(), file.ModTime())
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "dir"))
+	if err != nil || info.Mode().Perm() != 0750 || !info.ModTime().Equal(mtime) {
+		t.Errorf("expected directory mode and mtime restored, got %v", info)
+	}
+
+	info, err = os.Lstat(filepath.Join(dir, "dir/fifo"))
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("expected a fifo, got %v, %v", info, err)
+	}
+}
+
+func TestExtractInsecure(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []testMember
+	}{
+		{"parent", []testMember{{header: Header{Typeflag: TypeReg, Name: "../evil"}, content: "x"}}},
+		{"nested parent", []testMember{{header: Header{Typeflag: TypeReg, Name: "a/../../evil"}, content: "x"}}},
+		{"absolute", []testMember{{header: Header{Typeflag: TypeReg, Name: "/tmp/evil"}, content: "x"}}},
+		{"absolute symlink", []testMember{{header: Header{Typeflag: TypeSymlink, Name: "link", Linkname: "/etc"}}}},
+		{"escaping symlink", []testMember{{header: Header{Typeflag: TypeSymlink, Name: "a/link", Linkname: "../../evil"}}}},
+		{"hard link outside", []testMember{{header: Header{Typeflag: TypeLink, Name: "hard", Linkname: "../evil"}}}},
+		{"write through symlink", []testMember{
+			{header: Header{Typeflag: TypeDir, Name: "sub/"}},
+			{header: Header{Typeflag: TypeSymlink, Name: "up", Linkname: "sub"}},
+			{header: Header{Typeflag: TypeReg, Name: "up/evil"}, content: "x"},
+		}},
+		{"symlink chain", []testMember{
+			{header: Header{Typeflag: TypeDir, Name: "c/"}},
+			{header: Header{Typeflag: TypeSymlink, Name: "c/b", Linkname: ".."}},
+			{header: Header{Typeflag: TypeSymlink, Name: "evil", Linkname: "c/b/.."}},
+		}},
+		{"symlink over directory", []testMember{
+			{header: Header{Typeflag: TypeDir, Name: "sub/"}},
+			{header: Header{Typeflag: TypeSymlink, Name: "sub", Linkname: "."}},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tar := writeArchive(t, test.members)
+			root := t.TempDir()
+			dir := filepath.Join(root, "a", "b")
+
+			err := tar.ExtractFiles(dir)
+			if !errors.Is(err, ErrInsecurePath) {
+				t.Errorf("expected ErrInsecurePath, got %v", err)
+			}
+
+			if _, err := os.Lstat(filepath.Join(root, "a", "evil")); err == nil {
+				t.Errorf("file created outside of the extraction directory")
+			}
+		})
+	}
+}
+
+func TestExtractDirectoryRestoreOutside(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	tar := writeArchive(t, []testMember{
+		{header: Header{Typeflag: TypeDir, Name: "a/", Mode: 0777, ModTime: mtime}},
+		{header: Header{Typeflag: TypeDir, Name: "c/"}},
+		{header: Header{Typeflag: TypeSymlink, Name: "c/b", Linkname: ".."}},
+		{header: Header{Typeflag: TypeSymlink, Name: "a", Linkname: "c/b/.."}},
+	})
+
+	victim := filepath.Join(t.TempDir(), "victimparent")
+	if err := os.Mkdir(victim, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := tar.ExtractFiles(filepath.Join(victim, "out"))
+	if !errors.Is(err, ErrInsecurePath) {
+		t.Errorf("expected ErrInsecurePath, got %v", err)
+	}
+
+	after, err := os.Stat(victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode().Perm() != 0700 || after.ModTime().Equal(mtime) {
+		t.Errorf("expected %s unchanged, got %v %v", victim, after.Mode(), after.ModTime())
+	}
+}
+
+func TestRestoreDirsReplaced(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	target := filepath.Join(dir, "out", "a")
+	for _, d := range []string{victim, target} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Lstat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &extractor{dirs: []dirAttrs{{path: target, info: info, mode: 0777, modTime: time.Unix(0, 0)}}}
+
+	// the directory recorded is replaced by a symlink before the restore
+	if err := os.Remove(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, target); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.restoreDirs(); err != nil {
+		t.Fatalf("Error restoring directories: %v", err)
+	}
+
+	after, err := os.Stat(victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode().Perm() != 0700 || after.ModTime().Equal(time.Unix(0, 0)) {
+		t.Errorf("expected %s unchanged, got %v %v", victim, after.Mode(), after.ModTime())
+	}
+}
+
+func TestExtractSelection(t *testing.T) {
+	members := []testMember{
+		{header: Header{Typeflag: TypeDir, Name: "project-1.0/"}},
+		{header: Header{Typeflag: TypeReg, Name: "project-1.0/README"}, content: "readme"},
+		{header: Header{Typeflag: TypeReg, Name: "project-1.0/src/main.go"}, content: "main"},
+		{header: Header{Typeflag: TypeReg, Name: "project-1.0/src/util.go"}, content: "util"},
+		{header: Header{Typeflag: TypeReg, Name: "project-1.0/docs/guide.md"}, content: "guide"},
+	}
+
+	tar := writeArchive(t, members)
+	tar.StripComponents = 1
+	tar.Members = []string{"project-1.0/src", "*.md"}
+
+	dir := t.TempDir()
+	if err := tar.ExtractFiles(dir); err != nil {
+		t.Fatalf("Error extracting: %v", err)
+	}
+
+	for name, exists := range map[string]bool{
+		"src/main.go":   true,
+		"src/util.go":   true,
+		"docs/guide.md": true,
+		"README":        false,
+		"project-1.0":   false,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists && err != nil {
+			t.Errorf("expected %s to be extracted: %v", name, err)
+		}
+		if !exists && err == nil {
+			t.Errorf("expected %s to be skipped", name)
+		}
+	}
+
+	tar = writeArchive(t, members)
+	tar.Members = []string{"missing"}
+	if err := tar.ExtractFiles(t.TempDir()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
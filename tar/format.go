@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const blockSize = 512
+
+// GNU tar writes archives in records of 20 blocks
+const recordSize = 20 * blockSize
+
+const (
+	TypeReg           byte = '0'
+	TypeRegA          byte = '\x00'
+	TypeLink          byte = '1'
+	TypeSymlink       byte = '2'
+	TypeChar          byte = '3'
+	TypeBlock         byte = '4'
+	TypeDir           byte = '5'
+	TypeFifo          byte = '6'
+	TypeCont          byte = '7'
+	TypeXHeader       byte = 'x'
+	TypeXGlobalHeader byte = 'g'
+	TypeGNULongName   byte = 'L'
+	TypeGNULongLink   byte = 'K'
+	TypeGNUSparse     byte = 'S'
+)
+
+const (
+	magicUSTAR   = "ustar\x00"
+	versionUSTAR = "00"
+	magicGNU     = "ustar "
+	versionGNU   = " \x00"
+)
+
+// header field offsets and lengths of the ustar format
+const (
+	offName     = 0
+	lenName     = 100
+	offMode     = 100
+	offUid      = 108
+	offGid      = 116
+	offSize     = 124
+	offMtime    = 136
+	offChksum   = 148
+	offTypeflag = 156
+	offLinkname = 157
+	offMagic    = 257
+	offVersion  = 263
+	offUname    = 265
+	lenUname    = 32
+	offGname    = 297
+	offDevmajor = 329
+	offDevminor = 337
+	offPrefix   = 345
+	lenPrefix   = 155
+	offAtime    = 345 // GNU format only
+	offCtime    = 357 // GNU format only
+)
+
+var (
+	ErrHeader        = errors.New("tar: invalid header")
+	ErrChecksum      = errors.New("tar: header checksum mismatch")
+	ErrWriteTooLong  = errors.New("tar: write too long")
+	ErrMissingData   = errors.New("tar: missing file data")
+	ErrFieldTooLong  = errors.New("tar: header field too long")
+	ErrUnsupported   = errors.New("tar: unsupported header type")
+	ErrWriteAfterEnd = errors.New("tar: write after close")
+)
+
+// Format selects how the writer stores values that do not fit in a ustar
+// header
+type Format int
+
+const (
+	// FormatPAX uses POSIX pax extended headers
+	FormatPAX Format = iota
+	// FormatGNU uses GNU long name/link entries and base-256 numbers
+	FormatGNU
+)
+
+type Header struct {
+	Typeflag   byte
+	Name       string
+	Linkname   string
+	Size       int64
+	Mode       int64
+	Uid        int
+	Gid        int
+	Uname      string
+	Gname      string
+	ModTime    time.Time
+	AccessTime time.Time
+	ChangeTime time.Time
+	Devmajor   int64
+	Devminor   int64
+	// PAXRecords holds extended records such as xattrs, written as a pax
+	// header before the entry
+	PAXRecords map[string]string
+}
+
+// hasData reports whether the entry is followed by Size bytes of content
+func (h *Header) hasData() bool {
+	switch h.Typeflag {
+	case TypeLink, TypeSymlink, TypeChar, TypeBlock, TypeDir, TypeFifo:
+		return false
+	}
+	return true
+}
+
+type block [blockSize]byte
+
+func (b *block) isZero() bool {
+	return *b == block{}
+}
+
+// checksums returns the unsigned and signed sums of the block with the
+// checksum field itself counted as spaces. Some old tars used signed bytes
+func (b *block) checksums() (int64, int64) {
+	var unsigned, signed int64
+	for i, c := range b {
+		if i >= offChksum && i < offChksum+8 {
+			c = ' '
+		}
+		unsigned += int64(c)
+		signed += int64(int8(c))
+	}
+	return unsigned, signed
+}
+
+func (b *block) setChecksum() {
+	unsigned, _ := b.checksums()
+	field := b[offChksum : offChksum+8]
+	copy(field, fmt.Sprintf("%06o\x00 ", unsigned))
+}
+
+func (b *block) verifyChecksum() error {
+	stored, err := parseNumeric(b[offChksum : offChksum+8])
+	if err != nil {
+		return ErrHeader
+	}
+
+	unsigned, signed := b.checksums()
+	if stored != unsigned && stored != signed {
+		return ErrChecksum
+	}
+	return nil
+}
+
+func (b *block) isGNU() bool {
+	return string(b[offMagic:offVersion]) == magicGNU && string(b[offVersion:offVersion+2]) == versionGNU
+}
+
+func (b *block) isUSTAR() bool {
+	return string(b[offMagic:offVersion]) == magicUSTAR
+}
+
+// parseString returns the field up to the first NUL
+func parseString(field []byte) string {
+	if i := bytes.IndexByte(field, 0); i >= 0 {
+		return string(field[:i])
+	}
+	return string(field)
+}
+
+// parseNumeric parses an octal field, or a base-256 field when the high bit
+// of the first byte is set
+func parseNumeric(field []byte) (int64, error) {
+	if len(field) > 0 && field[0]&0x80 != 0 {
+		return parseBase256(field)
+	}
+
+	s := strings.Trim(string(field), " \x00")
+	if s == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(s, 8, 64)
+	if err != nil {
+		return 0, ErrHeader
+	}
+	return n, nil
+}
+
+func parseBase256(field []byte) (int64, error) {
+	// bit 6 of the first byte is the sign of a two's complement number
+	inv := byte(0)
+	if field[0]&0x40 != 0 {
+		inv = 0xff
+	}
+
+	var n uint64
+	for i, c := range field {
+		c ^= inv
+		if i == 0 {
+			c &= 0x7f
+		}
+		if n>>56 > 0 {
+			return 0, ErrHeader
+		}
+		n = n<<8 | uint64(c)
+	}
+
+	if n>>63 > 0 {
+		return 0, ErrHeader
+	}
+	if inv == 0xff {
+		return ^int64(n), nil
+	}
+	return int64(n), nil
+}
+
+// fitsOctal reports whether n fits in the field as octal digits followed by
+// a NUL
+func fitsOctal(n int64, width int) bool {
+	return n >= 0 && (width >= 22 || n < 1<<(3*(width-1)))
+}
+
+func formatOctal(field []byte, n int64) {
+	s := strconv.FormatInt(n, 8)
+	s = strings.Repeat("0", len(field)-1-len(s)) + s
+	copy(field, s+"\x00")
+}
+
+// formatBase256 writes n as a big-endian binary number with the high bit of
+// the first byte set, the GNU extension for values that do not fit in octal
+func formatBase256(field []byte, n int64) bool {
+	if len(field) < 9 {
+		limit := int64(1) << (8*(len(field)-1) + 6)
+		if n >= limit || n < -limit {
+			return false
+		}
+	}
+
+	v := n
+	for i := len(field) - 1; i >= 0; i-- {
+		field[i] = byte(v)
+		v >>= 8
+	}
+	field[0] |= 0x80
+	return true
+}
+
+func formatString(field []byte, s string) bool {
+	if len(s) > len(field) {
+		return false
+	}
+	copy(field, s)
+	return true
+}
+
+// parsePAXRecords parses "<length> <key>=<value>\n" records
+func parsePAXRecords(data []byte) (map[string]string, error) {
+	records := map[string]string{}
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		if space <= 0 {
+			return nil, ErrHeader
+		}
+
+		length, err := strconv.Atoi(string(data[:space]))
+		if err != nil || length <= space || length > len(data) || data[length-1] != '\n' {
+			return nil, ErrHeader
+		}
+
+		record := string(data[space+1 : length-1])
+		key, value, ok := strings.Cut(record, "=")
+		if !ok || key == "" {
+			return nil, ErrHeader
+		}
+
+		records[key] = value
+		data = data[length:]
+	}
+	return records, nil
+}
+
+func formatPAXRecord(key, value string) string {
+	record := " " + key + "=" + value + "\n"
+	length := len(record)
+	// the length includes its own digits
+	for {
+		size := len(strconv.Itoa(length)) + len(record)
+		if size == length {
+			break
+		}
+		length = size
+	}
+	return strconv.Itoa(length) + record
+}
+
+// parsePAXTime parses seconds with an optional fraction, e.g. 1700000000.5
+func parsePAXTime(s string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(s, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrHeader
+	}
+
+	var nsec int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		frac += strings.Repeat("0", 9-len(frac))
+		nsec, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return time.Time{}, ErrHeader
+		}
+		if strings.HasPrefix(secs, "-") {
+			nsec = -nsec
+		}
+	}
+
+	return time.Unix(sec, nsec), nil
+}
+
+func formatPAXTime(t time.Time) string {
+	sec, nsec := t.Unix(), t.Nanosecond()
+	if nsec == 0 {
+		return strconv.FormatInt(sec, 10)
+	}
+
+	sign := ""
+	if sec < 0 {
+		sign = "-"
+		sec = -(sec + 1)
+		nsec = 1e9 - nsec
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%09d", sign, sec, nsec), "0")
+}
+
+// splitUSTARPath splits a long name into the ustar prefix and name fields
+func splitUSTARPath(name string) (string, string, bool) {
+	if len(name) <= lenName {
+		return "", name, true
+	}
+
+	if len(name) > lenPrefix+1+lenName {
+		return "", "", false
+	}
+
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] != '/' {
+			continue
+		}
+		prefix, suffix := name[:i], name[i+1:]
+		if len(prefix) <= lenPrefix && len(suffix) <= lenName && suffix != "" {
+			return prefix, suffix, true
+		}
+		if len(prefix) < len(name)-lenName-1 {
+			break
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type goldenEntry struct {
+	typeflag byte
+	linkname string
+	size     int64
+	mode     int64
+	content  string
+}
+
+var (
+	splitName  = "dir/" + strings.Repeat("d", 70) + "/" + strings.Repeat("f", 70) + ".txt"
+	longName   = "dir/" + strings.Repeat("x", 110) + ".txt"
+	longTarget = "target/" + strings.Repeat("t", 120)
+)
+
+// the testdata archives were created with GNU tar 1.34 and bsdtar 3.7 from
+// the same tree, the ustar ones leave out the names that need extensions
+func goldenTree(full bool) map[string]goldenEntry {
+	tree := map[string]goldenEntry{
+		"dir/":                                 {typeflag: TypeDir, mode: 0755},
+		"dir/" + strings.Repeat("d", 70) + "/": {typeflag: TypeDir, mode: 0755},
+		splitName:                              {typeflag: TypeReg, size: 6, mode: 0644, content: "split\n"},
+		"dir/file.txt":                         {typeflag: TypeReg, size: 6, mode: 0644, content: "hello\n"},
+		"dir/hard":                             {typeflag: TypeLink, linkname: "dir/file.txt", mode: 0644},
+		"dir/short-link":                       {typeflag: TypeSymlink, linkname: "file.txt", mode: 0777},
+	}
+
+	if full {
+		tree[longName] = goldenEntry{typeflag: TypeReg, size: 5, mode: 0644, content: "long\n"}
+		tree["dir/long-link"] = goldenEntry{typeflag: TypeSymlink, linkname: longTarget, mode: 0777}
+	}
+
+	return tree
+}
+
+var goldenFiles = []struct {
+	file string
+	full bool
+	uid  int
+}{
+	{"testdata/gnu.tar", true, 3000000},
+	{"testdata/pax.tar", true, 3000000},
+	{"testdata/ustar.tar", false, 1000},
+	{"testdata/bsdtar-pax.tar", true, 3000000},
+	{"testdata/bsdtar-ustar.tar", false, 1000},
+}
+
+type archiveEntry struct {
+	header  *Header
+	content string
+}
+
+func readArchive(t *testing.T, r io.Reader) []archiveEntry {
+	t.Helper()
+
+	entries := []archiveEntry{}
+	tr := NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error reading archive: %v", err)
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Error reading %s: %v", h.Name, err)
+		}
+		entries = append(entries, archiveEntry{header: h, content: string(content)})
+	}
+	return entries
+}
+
+func TestReadGolden(t *testing.T) {
+	for _, golden := range goldenFiles {
+		file, err := os.Open(golden.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries := readArchive(t, file)
+		file.Close()
+
+		expected := goldenTree(golden.full)
+		if len(entries) != len(expected) {
+			t.Errorf("%s: expected %d entries, got %d", golden.file, len(expected), len(entries))
+		}
+
+		for _, e := range entries {
+			h := e.header
+			want, ok := expected[h.Name]
+			if !ok {
+				t.Errorf("%s: unexpected entry %q", golden.file, h.Name)
+				continue
+			}
+
+			got := goldenEntry{typeflag: h.Typeflag, linkname: h.Linkname, size: h.Size, mode: h.Mode, content: e.content}
+			if got != want {
+				t.Errorf("%s: %s expected %+v, got %+v", golden.file, h.Name, want, got)
+			}
+
+			if h.Uid != golden.uid || h.Gid != 1000 || h.Uname != "alice" || h.Gname != "staff" {
+				t.Errorf("%s: %s unexpected owner %d:%d %s:%s", golden.file, h.Name, h.Uid, h.Gid, h.Uname, h.Gname)
+			}
+
+			if h.ModTime.Unix() != 1700000000 {
+				t.Errorf("%s: %s unexpected mtime %v", golden.file, h.Name, h.ModTime)
+			}
+		}
+	}
+}
+
+func TestRoundTripGolden(t *testing.T) {
+	for _, golden := range goldenFiles {
+		for _, format := range []Format{FormatPAX, FormatGNU} {
+			file, err := os.Open(golden.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries := readArchive(t, file)
+			file.Close()
+
+			var buf bytes.Buffer
+			tw := NewWriter(&buf)
+			tw.Format = format
+			for _, e := range entries {
+				h := *e.header
+				if format == FormatGNU {
+					h.PAXRecords = nil
+				}
+				if err := tw.WriteHeader(&h); err != nil {
+					t.Fatalf("%s: error writing header %s: %v", golden.file, h.Name, err)
+				}
+				if _, err := io.WriteString(tw, e.content); err != nil {
+					t.Fatalf("%s: error writing %s: %v", golden.file, h.Name, err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.Len()%recordSize != 0 {
+				t.Errorf("%s: archive size %d is not a multiple of the record size", golden.file, buf.Len())
+			}
+
+			archive := buf.Bytes()
+			written := readArchive(t, bytes.NewReader(archive))
+			if len(written) != len(entries) {
+				t.Fatalf("%s: expected %d entries, got %d", golden.file, len(entries), len(written))
+			}
+
+			for i, e := range entries {
+				got, want := written[i].header, e.header
+				if got.Name != want.Name || got.Linkname != want.Linkname || got.Typeflag != want.Typeflag ||
+					got.Size != want.Size || got.Mode != want.Mode || got.Uid != want.Uid || got.Gid != want.Gid ||
+					got.Uname != want.Uname || got.Gname != want.Gname || !got.ModTime.Equal(want.ModTime) ||
+					written[i].content != e.content {
+					t.Errorf("%s: expected %+v, got %+v", golden.file, want, got)
+				}
+			}
+
+			names := []string{}
+			for _, e := range entries {
+				names = append(names, e.header.Name)
+			}
+			checkWithSystemTar(t, "tar", archive, names)
+			checkWithSystemTar(t, "bsdtar", archive, names)
+		}
+	}
+}
+
+// checkWithSystemTar lists the archive with GNU tar or bsdtar when they are
+// installed
+func checkWithSystemTar(t *testing.T, command string, archive []byte, names []string) {
+	t.Helper()
+
+	if _, err := exec.LookPath(command); err != nil {
+		return
+	}
+
+	cmd := exec.Command(command, "-tf", "-")
+	cmd.Stdin = bytes.NewReader(archive)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s failed: %v\n%s", command, err, output)
+	}
+
+	listed := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	sort.Strings(listed)
+	expected := append([]string{}, names...)
+	sort.Strings(expected)
+
+	if strings.Join(listed, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("%s listed %v, expected %v", command, listed, expected)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	data, err := os.ReadFile("testdata/ustar.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data[0] ^= 0x01
+	_, err = NewReader(bytes.NewReader(data)).Next()
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+}
+
+func TestTruncatedArchive(t *testing.T) {
+	data, err := os.ReadFile("testdata/gnu.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := NewReader(bytes.NewReader(data[:blockSize+blockSize/2]))
+	for {
+		_, err = tr.Next()
+		if err != nil {
+			break
+		}
+		_, err = io.ReadAll(tr)
+		if err != nil {
+			break
+		}
+	}
+
+	if err == io.EOF {
+		t.Error("expected an error for a truncated archive")
+	}
+}
+
+func TestNumeric(t *testing.T) {
+	tests := []struct {
+		width int
+		value int64
+	}{
+		{12, 0},
+		{12, 8<<30 - 1},
+		{12, 8 << 30},
+		{12, 1 << 62},
+		{8, 3000000},
+		{12, -1},
+		{12, -1700000000},
+	}
+
+	for _, tt := range tests {
+		field := make([]byte, tt.width)
+		if fitsOctal(tt.value, tt.width) {
+			formatOctal(field, tt.value)
+		} else if !formatBase256(field, tt.value) {
+			t.Fatalf("%d does not fit in %d bytes", tt.value, tt.width)
+		}
+
+		got, err := parseNumeric(field)
+		if err != nil || got != tt.value {
+			t.Errorf("expected %d, got %d (%v)", tt.value, got, err)
+		}
+	}
+
+	if fitsOctal(8<<30, 12) {
+		t.Error("8 GiB should not fit in an octal size field")
+	}
+
+	if formatBase256(make([]byte, 8), 1<<62) {
+		t.Error("1<<62 should not fit in an 8 byte base-256 field")
+	}
+}
+
+func TestLargeFileHeader(t *testing.T) {
+	size := int64(10 << 30)
+
+	for _, format := range []Format{FormatGNU, FormatPAX} {
+		var buf bytes.Buffer
+		tw := NewWriter(&buf)
+		tw.Format = format
+		err := tw.WriteHeader(&Header{Typeflag: TypeReg, Name: "big.iso", Size: size, Mode: 0644, ModTime: time.Unix(1700000000, 0)})
+		if err != nil {
+			t.Fatalf("Error writing header: %v", err)
+		}
+
+		// the content is not written, append the end of archive by hand
+		buf.Write(make([]byte, 2*blockSize))
+
+		data := buf.Bytes()
+		header := data[len(data)-3*blockSize:]
+		if header[offSize]&0x80 == 0 {
+			t.Errorf("format %d: expected a base-256 size field", format)
+		}
+
+		tr := NewReader(bytes.NewReader(data))
+		h, err := tr.Next()
+		if err != nil {
+			t.Fatalf("Error reading header: %v", err)
+		}
+
+		if h.Size != size {
+			t.Errorf("expected size %d, got %d", size, h.Size)
+		}
+	}
+}
+
+func TestLongNames(t *testing.T) {
+	name := strings.Repeat("long/", 60) + "file.txt"
+	link := strings.Repeat("target/", 40)
+
+	for _, format := range []Format{FormatGNU, FormatPAX} {
+		var buf bytes.Buffer
+		tw := NewWriter(&buf)
+		tw.Format = format
+		headers := []*Header{
+			{Typeflag: TypeReg, Name: name, Size: 4, Mode: 0644},
+			{Typeflag: TypeSymlink, Name: name + ".link", Linkname: link, Mode: 0777},
+			{Typeflag: TypeLink, Name: name + ".hard", Linkname: name, Mode: 0644},
+		}
+		if err := tw.WriteHeader(headers[0]); err != nil {
+			t.Fatalf("Error writing header: %v", err)
+		}
+		if err := tw.Close(); !errors.Is(err, ErrMissingData) {
+			t.Errorf("expected missing data error, got %v", err)
+		}
+
+		buf.Reset()
+		tw = NewWriter(&buf)
+		tw.Format = format
+		for _, h := range headers {
+			if err := tw.WriteHeader(h); err != nil {
+				t.Fatalf("Error writing header: %v", err)
+			}
+			if h.Typeflag == TypeReg {
+				if _, err := tw.Write([]byte("data!")); !errors.Is(err, ErrWriteTooLong) {
+					t.Errorf("expected write too long error, got %v", err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		entries := readArchive(t, &buf)
+		if len(entries) != 3 {
+			t.Fatalf("expected 3 entries, got %d", len(entries))
+		}
+
+		for i, e := range entries {
+			if e.header.Name != headers[i].Name || e.header.Linkname != headers[i].Linkname {
+				t.Errorf("expected %s -> %s, got %s -> %s", headers[i].Name, headers[i].Linkname, e.header.Name, e.header.Linkname)
+			}
+		}
+
+		if entries[0].content != "data" {
+			t.Errorf("expected data, got %q", entries[0].content)
+		}
+	}
+}
+
+func TestPAXRecords(t *testing.T) {
+	// the length grows from 2 to 3 digits once it counts itself
+	record := formatPAXRecord("path", strings.Repeat("a", 92))
+	if !strings.HasPrefix(record, "102 path=") || len(record) != 102 {
+		t.Errorf("unexpected record %q", record)
+	}
+
+	records, err := parsePAXRecords([]byte(formatPAXRecord("mtime", "1700000000.5") + formatPAXRecord("SCHILY.xattr.user.a", "b=c")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if records["mtime"] != "1700000000.5" || records["SCHILY.xattr.user.a"] != "b=c" {
+		t.Errorf("unexpected records %v", records)
+	}
+
+	mtime, err := parsePAXTime(records["mtime"])
+	if err != nil || !mtime.Equal(time.Unix(1700000000, 5e8)) {
+		t.Errorf("unexpected time %v", mtime)
+	}
+
+	if formatPAXTime(time.Unix(-2, 5e8)) != "-1.5" {
+		t.Errorf("unexpected formatted time %s", formatPAXTime(time.Unix(-2, 5e8)))
+	}
+
+	if _, err := parsePAXRecords([]byte("10 path=abc\n")); err == nil {
+		t.Error("Should return error for a wrong record length")
+	}
+}
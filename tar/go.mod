@@ -1,3 +1,9 @@
 module tar
 
 go 1.21.1
+
+require (
+	github.com/dsnet/compress v0.0.1
+	github.com/klauspost/compress v1.17.9
+	github.com/ulikunitz/xz v0.5.12
+)
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// lister prints the members of an archive, as names, in the long format of
+// GNU tar -tv, or as one JSON object per line
+type lister struct {
+	w       io.Writer
+	verbose bool
+	json    *json.Encoder
+	// width of the owner and size columns, it only grows so the columns
+	// stay aligned like in GNU tar
+	ugsWidth int
+}
+
+func newLister(w io.Writer, verbose, asJSON bool) *lister {
+	l := &lister{w: w, verbose: verbose, ugsWidth: 18}
+	if asJSON {
+		l.json = json.NewEncoder(w)
+	}
+	return l
+}
+
+func (l *lister) list(h *Header) error {
+	switch {
+	case l.json != nil:
+		return l.json.Encode(newMemberJSON(h))
+	case l.verbose:
+		_, err := fmt.Fprintln(l.w, l.longFormat(h))
+		return err
+	}
+
+	_, err := fmt.Fprintln(l.w, h.Name)
+	return err
+}
+
+// longFormat returns the member like GNU tar does:
+// -rw-r--r-- alice/staff       6 2023-11-14 22:13 dir/file.txt
+func (l *lister) longFormat(h *Header) string {
+	owner := h.Uname
+	if owner == "" {
+		owner = strconv.Itoa(h.Uid)
+	}
+	group := h.Gname
+	if group == "" {
+		group = strconv.Itoa(h.Gid)
+	}
+
+	size := "0"
+	if h.hasData() {
+		size = strconv.FormatInt(h.Size, 10)
+	}
+	if h.Typeflag == TypeChar || h.Typeflag == TypeBlock {
+		size = fmt.Sprintf("%d,%d", h.Devmajor, h.Devminor)
+	}
+
+	pad := len(owner) + 1 + len(group) + len(size)
+	if pad > l.ugsWidth {
+		l.ugsWidth = pad
+	}
+
+	line := fmt.Sprintf("%s %s/%s %*s %s %s",
+		modeString(h), owner, group, l.ugsWidth-pad+len(size), size,
+		h.ModTime.Local().Format("2006-01-02 15:04"), h.Name)
+
+	switch h.Typeflag {
+	case TypeSymlink:
+		line += " -> " + h.Linkname
+	case TypeLink:
+		line += " link to " + h.Linkname
+	}
+	return line
+}
+
+// modeString returns the permissions as ls prints them, prefixed by the
+// member type
+func modeString(h *Header) string {
+	mode := []byte("?rwxrwxrwx")
+	for i := 0; i < 9; i++ {
+		if h.Mode&(1<<(8-i)) == 0 {
+			mode[i+1] = '-'
+		}
+	}
+
+	special := []struct {
+		bit   int64
+		index int
+		set   byte
+	}{
+		{modeSetuid, 3, 's'},
+		{modeSetgid, 6, 's'},
+		{modeSticky, 9, 't'},
+	}
+	for _, s := range special {
+		if h.Mode&s.bit == 0 {
+			continue
+		}
+		if mode[s.index] == '-' {
+			// set without the execute bit
+			mode[s.index] = s.set - 'a' + 'A'
+		} else {
+			mode[s.index] = s.set
+		}
+	}
+
+	types := map[byte]byte{
+		TypeReg:     '-',
+		TypeRegA:    '-',
+		TypeLink:    'h',
+		TypeSymlink: 'l',
+		TypeChar:    'c',
+		TypeBlock:   'b',
+		TypeDir:     'd',
+		TypeFifo:    'p',
+		TypeCont:    'C',
+	}
+	if c, ok := types[h.Typeflag]; ok {
+		mode[0] = c
+	}
+	return string(mode)
+}
+
+// memberJSON is the JSON representation of a member for --json
+type memberJSON struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Mode       string            `json:"mode"`
+	Size       int64             `json:"size"`
+	Uid        int               `json:"uid"`
+	Gid        int               `json:"gid"`
+	Uname      string            `json:"uname,omitempty"`
+	Gname      string            `json:"gname,omitempty"`
+	ModTime    time.Time         `json:"mtime"`
+	AccessTime *time.Time        `json:"atime,omitempty"`
+	ChangeTime *time.Time        `json:"ctime,omitempty"`
+	Linkname   string            `json:"linkname,omitempty"`
+	Devmajor   int64             `json:"devmajor,omitempty"`
+	Devminor   int64             `json:"devminor,omitempty"`
+	PAXRecords map[string]string `json:"pax,omitempty"`
+}
+
+var typeNames = map[byte]string{
+	TypeReg:     "file",
+	TypeRegA:    "file",
+	TypeCont:    "file",
+	TypeLink:    "hardlink",
+	TypeSymlink: "symlink",
+	TypeChar:    "char",
+	TypeBlock:   "block",
+	TypeDir:     "dir",
+	TypeFifo:    "fifo",
+}
+
+func newMemberJSON(h *Header) memberJSON {
+	m := memberJSON{
+		Name:       h.Name,
+		Type:       typeNames[h.Typeflag],
+		Mode:       fmt.Sprintf("%04o", h.Mode),
+		Uid:        h.Uid,
+		Gid:        h.Gid,
+		Uname:      h.Uname,
+		Gname:      h.Gname,
+		ModTime:    h.ModTime.UTC(),
+		Linkname:   h.Linkname,
+		Devmajor:   h.Devmajor,
+		Devminor:   h.Devminor,
+		PAXRecords: h.PAXRecords,
+	}
+
+	if m.Type == "" {
+		m.Type = string(h.Typeflag)
+	}
+	if h.hasData() {
+		m.Size = h.Size
+	}
+	if !h.AccessTime.IsZero() {
+		atime := h.AccessTime.UTC()
+		m.AccessTime = &atime
+	}
+	if !h.ChangeTime.IsZero() {
+		ctime := h.ChangeTime.UTC()
+		m.ChangeTime = &ctime
+	}
+	return m
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLongFormat(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	file, err := os.Open("testdata/ustar.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var out bytes.Buffer
+	lister := newLister(&out, true, false)
+	tr := NewReader(file)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if err := lister.list(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{
+		"drwxr-xr-x alice/staff       0 2023-11-14 22:13 dir/",
+		"-rw-r--r-- alice/staff       6 2023-11-14 22:13 dir/file.txt",
+		"hrw-r--r-- alice/staff       0 2023-11-14 22:13 dir/hard link to dir/file.txt",
+		"lrwxrwxrwx alice/staff       0 2023-11-14 22:13 dir/short-link -> file.txt",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestLongFormatColumns(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 0, 0, time.Local)
+	lister := newLister(nil, true, false)
+
+	tests := []struct {
+		header   Header
+		expected string
+	}{
+		{Header{Typeflag: TypeReg, Name: "a", Mode: 04755, Uname: "root", Gname: "root", Size: 12, ModTime: mtime},
+			"-rwsr-xr-x root/root        12 2024-01-02 03:04 a"},
+		{Header{Typeflag: TypeChar, Name: "null", Mode: 0666, Uid: 0, Gid: 0, Devmajor: 1, Devminor: 3, ModTime: mtime},
+			"crw-rw-rw- 0/0             1,3 2024-01-02 03:04 null"},
+		{Header{Typeflag: TypeDir, Name: "tmp/", Mode: 01777, Uname: "root", Gname: "root", ModTime: mtime},
+			"drwxrwxrwt root/root         0 2024-01-02 03:04 tmp/"},
+		{Header{Typeflag: TypeFifo, Name: "p", Mode: 02640, Uname: "a-very-long-user-name", Gname: "g", ModTime: mtime},
+			"prw-r-S--- a-very-long-user-name/g 0 2024-01-02 03:04 p"},
+		// the column stays as wide as the widest owner seen
+		{Header{Typeflag: TypeReg, Name: "b", Mode: 0644, Uname: "root", Gname: "root", Size: 1, ModTime: mtime},
+			"-rw-r--r-- root/root               1 2024-01-02 03:04 b"},
+	}
+
+	for _, test := range tests {
+		if line := lister.longFormat(&test.header); line != test.expected {
+			t.Errorf("expected\n%q, got\n%q", test.expected, line)
+		}
+	}
+}
+
+func TestJSONListing(t *testing.T) {
+	file, err := os.Open("testdata/pax.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var out bytes.Buffer
+	lister := newLister(&out, false, true)
+	tr := NewReader(file)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if err := lister.list(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	members := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("Error decoding %q: %v", line, err)
+		}
+		members[m["name"].(string)] = m
+	}
+
+	file1 := members["dir/file.txt"]
+	if file1["type"] != "file" || file1["size"] != 6.0 || file1["mode"] != "0644" || file1["uname"] != "alice" || file1["mtime"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("unexpected file member %v", file1)
+	}
+
+	link := members["dir/short-link"]
+	if link["type"] != "symlink" || link["linkname"] != "file.txt" || link["size"] != 0.0 {
+		t.Errorf("unexpected symlink member %v", link)
+	}
+
+	if members["dir/hard"]["type"] != "hardlink" {
+		t.Errorf("unexpected hard link member %v", members["dir/hard"])
+	}
+}
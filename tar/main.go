@@ -1,23 +1,33 @@
 package main
 
 import (
-	"archive/tar"
-	"flag"
 	"fmt"
 	"io"
 	"os"
-	"os/user"
-	"syscall"
+	"path/filepath"
 )
 
 type Tar struct {
-	file       *os.File
-	newTarName string
+	file        *os.File
+	tarName     string
+	Exclude     []string    // glob patterns of the files left out of new archives
+	Compression Compression // detected from the archive when reading if none
+
+	StripComponents int      // leading path components removed on extraction
+	Members         []string // glob patterns of the members to extract or compare
+	Verbose         bool     // print the names of the processed members
+	JSON            bool     // list the members as JSON objects
+	Reproducible    bool     // create byte-identical archives of the same files
 }
 
+// NewTar opens the archive, "-" reads from stdin or writes to stdout
 func NewTar(tarName string, create bool) (*Tar, error) {
 	if create {
-		return &Tar{newTarName: tarName}, nil
+		return &Tar{tarName: tarName}, nil
+	}
+
+	if tarName == "-" {
+		return &Tar{file: os.Stdin}, nil
 	}
 
 	file, err := os.Open(tarName)
@@ -31,31 +41,31 @@ func (t *Tar) Close() error {
 	return t.file.Close()
 }
 
-func (t *Tar) ListFiles() error {
-	tarReader := tar.NewReader(t.file)
-
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		fmt.Println(header.Name)
+// verboseWriter returns where the names of the processed members go, stderr
+// when the archive itself is written to stdout
+func (t *Tar) verboseWriter() io.Writer {
+	if !t.Verbose {
+		return nil
 	}
 
-	return nil
+	if t.file == nil && t.tarName == "-" {
+		return os.Stderr
+	}
+	return os.Stdout
 }
 
-func (t *Tar) ExtractFiles(path string) error {
-	_, err := t.file.Seek(0, 0)
+// ListFiles prints the members matching t.Members, in the long format when
+// t.Verbose is set or as JSON when t.JSON is
+func (t *Tar) ListFiles() error {
+	decompressor, err := newDecompressor(t.file, t.Compression)
 	if err != nil {
 		return err
 	}
+	defer decompressor.Close()
 
-	tarReader := tar.NewReader(t.file)
+	members := newMemberPatterns(t.Members)
+	lister := newLister(os.Stdout, t.Verbose, t.JSON)
+	tarReader := NewReader(decompressor)
 
 	for {
 		header, err := tarReader.Next()
@@ -66,150 +76,164 @@ func (t *Tar) ExtractFiles(path string) error {
 			return err
 		}
 
-		content, err := io.ReadAll(tarReader)
-		if err != nil {
-			return err
+		if !members.match(header.Name) {
+			continue
 		}
-		file, err := os.Create(path + "/" + header.Name)
-		if err != nil {
+
+		if err := lister.list(header); err != nil {
 			return err
 		}
-		defer file.Close()
-		_, err = file.Write(content)
+	}
+
+	return members.missing()
+}
+
+// archiver returns an archiver writing to tarWriter with the options of t
+func (t *Tar) archiver(tarWriter *Writer, archiveInfo os.FileInfo) (*archiver, error) {
+	archiver := newArchiver(tarWriter, t.Exclude, archiveInfo)
+	archiver.verbose = t.verboseWriter()
+
+	if t.Reproducible {
+		epoch, err := sourceDateEpoch()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		archiver.reproducible = true
+		archiver.epoch = epoch
 	}
 
-	return nil
+	return archiver, nil
 }
 
-func (t *Tar) CreateTar(args []string) error {
-	newTarFile, err := os.Create(t.newTarName)
+// ExtractFiles extracts the archive below path, only the members matching
+// t.Members when it is not empty
+func (t *Tar) ExtractFiles(path string) error {
+	decompressor, err := newDecompressor(t.file, t.Compression)
 	if err != nil {
 		return err
 	}
-	defer newTarFile.Close()
+	defer decompressor.Close()
 
-	tarWriter := tar.NewWriter(newTarFile)
+	extractor := newExtractor(path, t.StripComponents, t.Members)
+	extractor.verbose = t.verboseWriter()
+	return extractor.extract(NewReader(decompressor))
+}
 
-	for _, arg := range args {
-		file, err := os.Open(arg)
+// CreateTar archives the given files, directories are added recursively
+func (t *Tar) CreateTar(args []string) error {
+	newTarFile := os.Stdout
+	if t.tarName != "-" {
+		file, err := os.Create(t.tarName)
 		if err != nil {
 			return err
 		}
 		defer file.Close()
+		newTarFile = file
+	}
 
-		stat, err := file.Stat()
-		if err != nil {
-			return err
-		}
-
-		sysStat, ok := stat.Sys().(*syscall.Stat_t)
-		if !ok {
-			return fmt.Errorf("failed to get system-specific file info for %s", arg)
-		}
-
-		u, err := user.LookupId(fmt.Sprint(sysStat.Uid))
-		if err != nil {
-			return err
-		}
-
-		group, err := user.LookupGroupId(fmt.Sprint(sysStat.Gid))
-		if err != nil {
-			return err
-		}
+	archiveInfo, err := newTarFile.Stat()
+	if err != nil {
+		return err
+	}
 
-		header := &tar.Header{
-			Name:    file.Name(),
-			Size:    stat.Size(),
-			Mode:    int64(stat.Mode()),
-			ModTime: stat.ModTime(),
-			Uname:   u.Username,
-			Gname:   group.Name,
-		}
+	compressor, err := newCompressor(newTarFile, t.Compression)
+	if err != nil {
+		return err
+	}
 
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return err
-		}
+	tarWriter := NewWriter(compressor)
+	archiver, err := t.archiver(tarWriter, archiveInfo)
+	if err != nil {
+		return err
+	}
 
-		if _, err := io.Copy(tarWriter, file); err != nil {
-			return err
-		}
+	if err := archiver.addAll(args); err != nil {
+		return err
 	}
 
 	if err := tarWriter.Close(); err != nil {
 		return err
 	}
 
-	return nil
-
+	return compressor.Close()
 }
 
 func main() {
-	t := flag.Bool("t", false, "list files for stdin")
-	tf := flag.Bool("tf", false, "list files")
-	xf := flag.Bool("xf", false, "extract files")
-	cf := flag.Bool("cf", false, "create tar file")
-	C := flag.String("C", "", "extract to path")
-
-	flag.Parse()
+	opts, err := parseOptions(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error:", err)
+		fmt.Println(usage)
+		os.Exit(1)
+	}
 
-	tarName := ""
-	args := flag.Args()
+	os.Exit(run(opts))
+}
 
-	if *tf || *xf || *cf {
-		if len(args) == 0 {
-			fmt.Println("Usage: tar <tarName>")
-			os.Exit(1)
-		}
-		tarName = args[0]
-	} else if *t {
-		stdContent, err := io.ReadAll(os.Stdin)
-		if err != nil {
-			fmt.Println("Error reading input: ", err)
-			os.Exit(1)
-		}
+// run executes the operation and returns the exit status
+func run(opts *options) int {
+	tarName := opts.file
+	create := opts.op != opExtract && opts.op != opList && opts.op != opCompare
 
-		tmpfile, err := os.CreateTemp("", "tar-")
-		if err != nil {
-			fmt.Println("Error creating temporary file:", err)
-			os.Exit(1)
+	// files are added relative to -C, the archive relative to where we are
+	if create && opts.dir != "" {
+		if tarName != "-" {
+			abs, err := filepath.Abs(tarName)
+			if err != nil {
+				fmt.Println("Error opening tar file:", err)
+				return 1
+			}
+			tarName = abs
 		}
-		defer os.Remove(tmpfile.Name())
 
-		if _, err := tmpfile.Write(stdContent); err != nil {
-			fmt.Println("Error writing to temporary file:", err)
-			os.Exit(1)
+		if err := os.Chdir(opts.dir); err != nil {
+			fmt.Println("Error changing directory:", err)
+			return 1
 		}
-		tarName = tmpfile.Name()
 	}
 
-	tar, err := NewTar(tarName, *cf)
+	tar, err := NewTar(tarName, create)
 	if err != nil {
-		fmt.Println("Error opening tar file: ", err)
-		os.Exit(1)
+		fmt.Println("Error opening tar file:", err)
+		return 1
 	}
-
 	defer tar.Close()
 
-	if *xf {
-		err := tar.ExtractFiles(*C)
-		if err != nil {
-			fmt.Println("Error extracting files:", err)
-			os.Exit(1)
-		}
-	} else if *tf || *t {
-		err := tar.ListFiles()
-		if err != nil {
-			fmt.Println("Error listing files:", err)
-			os.Exit(1)
-		}
-	} else if *cf {
-		err := tar.CreateTar(args[1:])
-		if err != nil {
-			fmt.Println("Error creating tar file:", err)
-			os.Exit(1)
+	tar.Exclude = opts.exclude
+	tar.Compression = opts.compression
+	tar.StripComponents = opts.stripComponents
+	tar.Verbose = opts.verbose
+	tar.JSON = opts.json
+	tar.Reproducible = opts.reproducible
+
+	switch opts.op {
+	case opCreate:
+		err = tar.CreateTar(opts.args)
+	case opExtract:
+		tar.Members = opts.args
+		err = tar.ExtractFiles(opts.dir)
+	case opList:
+		tar.Members = opts.args
+		err = tar.ListFiles()
+	case opAppend:
+		err = tar.Append(opts.args)
+	case opUpdate:
+		err = tar.Update(opts.args)
+	case opDelete:
+		err = tar.Delete(opts.args)
+	case opConcatenate:
+		err = tar.Concatenate(opts.args)
+	case opCompare:
+		tar.Members = opts.args
+		var differ int
+		differ, err = tar.Compare(opts.dir, os.Stdout)
+		if err == nil && differ > 0 {
+			return 1
 		}
 	}
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	return 0
 }
@@ -62,6 +62,7 @@ func TestExtractTar(t *testing.T) {
 	defer tarFile.Close()
 
 	pathToExtract := "test"
+	defer os.RemoveAll(pathToExtract)
 	err = tarFile.ExtractFiles("test")
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const usage = `Usage: tar [-]{c|x|t|r|u|d|A} [-vzjJ] [-f ARCHIVE] [-C DIR] [OPTION...] [FILE...]
+
+Operations:
+  -c, --create            create a new archive
+  -x, --extract           extract files from an archive
+  -t, --list              list the contents of an archive
+  -r, --append            append files to the end of an archive
+  -u, --update            append only files newer than their copy in the archive
+  -d, --diff, --compare   find differences between the archive and the file system
+  -A, --concatenate       append the members of other archives
+      --delete            delete members from the archive
+
+Options:
+  -f, --file=ARCHIVE      use the archive file, - for stdin or stdout
+  -C, --directory=DIR     change to DIR before doing anything
+  -v, --verbose           print the names of the processed files, list them
+                          in the long format
+      --json              list the members as JSON, one object per line
+  -z, --gzip              filter the archive through gzip
+  -j, --bzip2             filter the archive through bzip2
+  -J, --xz                filter the archive through xz
+      --zstd              filter the archive through zstd
+      --exclude=PATTERN   exclude files matching the glob pattern
+      --reproducible      create the same archive from the same files: sorted,
+                          mtime from SOURCE_DATE_EPOCH, no owners or atime
+      --strip-components=N
+                          remove N leading components from names when extracting`
+
+type operation int
+
+const (
+	opNone operation = iota
+	opCreate
+	opExtract
+	opList
+	opAppend
+	opUpdate
+	opDelete
+	opCompare
+	opConcatenate
+)
+
+// options are the parsed command line
+type options struct {
+	op              operation
+	file            string
+	dir             string
+	verbose         bool
+	json            bool
+	reproducible    bool
+	compression     Compression
+	exclude         []string
+	stripComponents int
+	args            []string // files, member patterns or archives
+}
+
+// shortOptions maps the short options to their long names
+var shortOptions = map[byte]string{
+	'c': "create",
+	'x': "extract",
+	't': "list",
+	'r': "append",
+	'u': "update",
+	'd': "diff",
+	'A': "concatenate",
+	'f': "file",
+	'C': "directory",
+	'v': "verbose",
+	'z': "gzip",
+	'j': "bzip2",
+	'J': "xz",
+}
+
+// valueOptions take an argument
+var valueOptions = map[string]bool{
+	"file":             true,
+	"directory":        true,
+	"exclude":          true,
+	"strip-components": true,
+}
+
+// parseOptions parses the arguments like GNU tar: short options can be
+// bundled (-czvf), long ones take their value after = or in the next
+// argument and the first argument may omit the dash (tar czf)
+func parseOptions(args []string) (*options, error) {
+	o := &options{file: "-"}
+
+	i := 0
+	next := func(name string) (string, error) {
+		if i+1 >= len(args) {
+			return "", fmt.Errorf("option '%s' requires an argument", name)
+		}
+		i++
+		return args[i], nil
+	}
+
+	// old style, the values of the letters follow in order
+	if len(args) > 0 && args[0] != "" && !strings.HasPrefix(args[0], "-") {
+		bundle := args[0]
+		args = args[1:]
+		values := 0
+		for j := 0; j < len(bundle); j++ {
+			name, ok := shortOptions[bundle[j]]
+			if !ok {
+				return nil, fmt.Errorf("invalid option -- '%c'", bundle[j])
+			}
+
+			value := ""
+			if valueOptions[name] {
+				if values >= len(args) {
+					return nil, fmt.Errorf("option '%c' requires an argument", bundle[j])
+				}
+				value = args[values]
+				values++
+			}
+			if err := o.set(name, value); err != nil {
+				return nil, err
+			}
+		}
+		args = args[values:]
+	}
+
+	for ; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			o.args = append(o.args, args[i+1:]...)
+			i = len(args)
+
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			if valueOptions[name] && !hasValue {
+				var err error
+				if value, err = next("--" + name); err != nil {
+					return nil, err
+				}
+			} else if !valueOptions[name] && hasValue {
+				return nil, fmt.Errorf("option '--%s' doesn't allow an argument", name)
+			}
+
+			if err := o.set(name, value); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			for j := 1; j < len(arg); j++ {
+				name, ok := shortOptions[arg[j]]
+				if !ok {
+					return nil, fmt.Errorf("invalid option -- '%c'", arg[j])
+				}
+
+				if !valueOptions[name] {
+					if err := o.set(name, ""); err != nil {
+						return nil, err
+					}
+					continue
+				}
+
+				// the value is the rest of the bundle or the next argument
+				value := arg[j+1:]
+				if value == "" {
+					var err error
+					if value, err = next("-" + string(arg[j])); err != nil {
+						return nil, err
+					}
+				}
+				if err := o.set(name, value); err != nil {
+					return nil, err
+				}
+				break
+			}
+
+		default:
+			o.args = append(o.args, arg)
+		}
+	}
+
+	if o.op == opNone {
+		return nil, errors.New("you must specify one of the '-Acdtrux' or '--delete' options")
+	}
+	return o, nil
+}
+
+func (o *options) set(name, value string) error {
+	switch name {
+	case "create":
+		return o.setOperation(opCreate)
+	case "extract", "get":
+		return o.setOperation(opExtract)
+	case "list":
+		return o.setOperation(opList)
+	case "append":
+		return o.setOperation(opAppend)
+	case "update":
+		return o.setOperation(opUpdate)
+	case "delete":
+		return o.setOperation(opDelete)
+	case "diff", "compare":
+		return o.setOperation(opCompare)
+	case "concatenate", "catenate":
+		return o.setOperation(opConcatenate)
+	case "file":
+		o.file = value
+	case "directory":
+		o.dir = value
+	case "verbose":
+		o.verbose = true
+	case "json":
+		o.json = true
+	case "reproducible":
+		o.reproducible = true
+	case "gzip", "gunzip":
+		o.compression = CompressionGzip
+	case "bzip2":
+		o.compression = CompressionBzip2
+	case "xz":
+		o.compression = CompressionXz
+	case "zstd":
+		o.compression = CompressionZstd
+	case "exclude":
+		o.exclude = append(o.exclude, value)
+	case "strip-components":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number of components '%s'", value)
+		}
+		o.stripComponents = n
+	default:
+		return fmt.Errorf("unrecognized option '--%s'", name)
+	}
+	return nil
+}
+
+func (o *options) setOperation(op operation) error {
+	if o.op != opNone && o.op != op {
+		return errors.New("you may not specify more than one '-Acdtrux' or '--delete' option")
+	}
+	o.op = op
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected options
+	}{
+		{[]string{"-czvf", "out.tar.gz", "dir"}, options{op: opCreate, file: "out.tar.gz", verbose: true, compression: CompressionGzip, args: []string{"dir"}}},
+		{[]string{"czvf", "out.tar.gz", "dir"}, options{op: opCreate, file: "out.tar.gz", verbose: true, compression: CompressionGzip, args: []string{"dir"}}},
+		{[]string{"-xf", "in.tar", "-C", "dest", "a", "b"}, options{op: opExtract, file: "in.tar", dir: "dest", args: []string{"a", "b"}}},
+		{[]string{"-x", "-fin.tar", "--strip-components=2"}, options{op: opExtract, file: "in.tar", stripComponents: 2}},
+		{[]string{"xfC", "in.tar", "dest"}, options{op: opExtract, file: "in.tar", dir: "dest"}},
+		{[]string{"-t"}, options{op: opList, file: "-"}},
+		{[]string{"--list", "--file", "in.tar", "--zstd"}, options{op: opList, file: "in.tar", compression: CompressionZstd}},
+		{[]string{"-rf", "a.tar", "--exclude", "*.o", "--exclude=*.log", "src"}, options{op: opAppend, file: "a.tar", exclude: []string{"*.o", "*.log"}, args: []string{"src"}}},
+		{[]string{"--delete", "-f", "a.tar", "--", "-odd"}, options{op: opDelete, file: "a.tar", args: []string{"-odd"}}},
+		{[]string{"-Af", "a.tar", "b.tar"}, options{op: opConcatenate, file: "a.tar", args: []string{"b.tar"}}},
+		{[]string{"--compare", "-jf", "a.tar.bz2"}, options{op: opCompare, file: "a.tar.bz2", compression: CompressionBzip2}},
+		{[]string{"-uJf", "a.tar.xz", "new"}, options{op: opUpdate, file: "a.tar.xz", compression: CompressionXz, args: []string{"new"}}},
+	}
+
+	for _, test := range tests {
+		opts, err := parseOptions(test.args)
+		if err != nil {
+			t.Errorf("%v: Error parsing: %v", test.args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(*opts, test.expected) {
+			t.Errorf("%v: expected %+v, got %+v", test.args, test.expected, *opts)
+		}
+	}
+}
+
+func TestParseOptionsErrors(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"-f", "a.tar"},
+		{"-cx"},
+		{"-cf"},
+		{"-cq"},
+		{"--unknown"},
+		{"--verbose=yes", "-c"},
+		{"-x", "--strip-components=-1"},
+		{"cf"},
+	}
+
+	for _, args := range tests {
+		if _, err := parseOptions(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reader reads ustar, pax and GNU tar archives
+type Reader struct {
+	r         io.Reader
+	remaining int64 // bytes left in the current entry
+	padding   int64 // padding after the current entry
+	global    map[string]string
+	offset    int64 // bytes consumed from r
+	end       int64 // offset of the end-of-archive blocks, once reached
+	err       error
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, global: map[string]string{}}
+}
+
+// Next advances to the next entry, skipping what is left of the current one.
+// It returns io.EOF at the end of the archive
+func (tr *Reader) Next() (*Header, error) {
+	if tr.err != nil {
+		return nil, tr.err
+	}
+
+	h, err := tr.next()
+	tr.err = err
+	return h, err
+}
+
+func (tr *Reader) next() (*Header, error) {
+	var pax map[string]string
+	var longName, longLink string
+	hasLongName, hasLongLink := false, false
+
+	for {
+		if err := tr.skip(tr.remaining + tr.padding); err != nil {
+			return nil, err
+		}
+		tr.remaining, tr.padding = 0, 0
+
+		b, err := tr.readHeaderBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		h, err := parseHeader(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.Size < 0 {
+			return nil, ErrHeader
+		}
+		tr.remaining = h.Size
+		tr.padding = blockPadding(h.Size)
+
+		switch h.Typeflag {
+		case TypeXHeader, TypeXGlobalHeader:
+			data, err := tr.readMeta(h.Size)
+			if err != nil {
+				return nil, err
+			}
+
+			records, err := parsePAXRecords(data)
+			if err != nil {
+				return nil, err
+			}
+
+			if h.Typeflag == TypeXGlobalHeader {
+				for key, value := range records {
+					tr.global[key] = value
+				}
+				continue
+			}
+
+			if pax == nil {
+				pax = map[string]string{}
+			}
+			for key, value := range records {
+				pax[key] = value
+			}
+			continue
+
+		case TypeGNULongName, TypeGNULongLink:
+			data, err := tr.readMeta(h.Size)
+			if err != nil {
+				return nil, err
+			}
+
+			if h.Typeflag == TypeGNULongName {
+				longName, hasLongName = parseString(data), true
+			} else {
+				longLink, hasLongLink = parseString(data), true
+			}
+			continue
+
+		case TypeGNUSparse:
+			return nil, ErrUnsupported
+		}
+
+		if hasLongName {
+			h.Name = longName
+		}
+		if hasLongLink {
+			h.Linkname = longLink
+		}
+
+		records := map[string]string{}
+		for key, value := range tr.global {
+			records[key] = value
+		}
+		for key, value := range pax {
+			records[key] = value
+		}
+
+		if err := applyPAXRecords(h, records); err != nil {
+			return nil, err
+		}
+
+		// links, directories and devices never carry data, whatever the size
+		// field says
+		tr.remaining, tr.padding = 0, 0
+		if h.hasData() {
+			tr.remaining = h.Size
+			tr.padding = blockPadding(h.Size)
+		}
+
+		return h, nil
+	}
+}
+
+// readHeaderBlock reads the next header, two zero blocks mark the end of
+// the archive
+func (tr *Reader) readHeaderBlock() (*block, error) {
+	tr.end = tr.offset
+
+	b := &block{}
+	n, err := io.ReadFull(tr.r, b[:])
+	tr.offset += int64(n)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrHeader
+		}
+		return nil, err
+	}
+
+	if !b.isZero() {
+		return b, nil
+	}
+
+	// some writers end the archive with a single zero block
+	n, err = io.ReadFull(tr.r, b[:])
+	tr.offset += int64(n)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, ErrHeader
+	}
+
+	if !b.isZero() {
+		return nil, ErrHeader
+	}
+	return nil, io.EOF
+}
+
+func (tr *Reader) readMeta(size int64) ([]byte, error) {
+	// guard against huge sizes in corrupted headers
+	if size > 1<<20 {
+		return nil, ErrFieldTooLong
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(tr, data); err != nil {
+		return nil, ErrHeader
+	}
+	return data, nil
+}
+
+// Read reads the content of the current entry
+func (tr *Reader) Read(p []byte) (int, error) {
+	if tr.err != nil {
+		return 0, tr.err
+	}
+
+	if tr.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > tr.remaining {
+		p = p[:tr.remaining]
+	}
+
+	n, err := tr.r.Read(p)
+	tr.remaining -= int64(n)
+	tr.offset += int64(n)
+	if err == io.EOF && tr.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+		tr.err = err
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (tr *Reader) skip(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+
+	if seeker, ok := tr.r.(io.Seeker); ok {
+		if _, err := seeker.Seek(n, io.SeekCurrent); err == nil {
+			tr.offset += n
+			return nil
+		}
+	}
+
+	copied, err := io.CopyN(io.Discard, tr.r, n)
+	tr.offset += copied
+	if copied < n && err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func parseHeader(b *block) (*Header, error) {
+	if err := b.verifyChecksum(); err != nil {
+		return nil, err
+	}
+
+	h := &Header{
+		Typeflag: b[offTypeflag],
+		Name:     parseString(b[offName : offName+lenName]),
+		Linkname: parseString(b[offLinkname : offLinkname+lenName]),
+	}
+
+	var uid, gid, mtime int64
+	numbers := map[*int64][]byte{
+		&h.Mode: b[offMode : offMode+8],
+		&uid:    b[offUid : offUid+8],
+		&gid:    b[offGid : offGid+8],
+		&h.Size: b[offSize : offSize+12],
+		&mtime:  b[offMtime : offMtime+12],
+	}
+
+	for value, field := range numbers {
+		n, err := parseNumeric(field)
+		if err != nil {
+			return nil, err
+		}
+		*value = n
+	}
+
+	h.Uid = int(uid)
+	h.Gid = int(gid)
+	h.ModTime = time.Unix(mtime, 0)
+
+	if !b.isUSTAR() && !b.isGNU() {
+		// old v7 format, a trailing slash marks directories
+		if h.Typeflag == TypeRegA && strings.HasSuffix(h.Name, "/") {
+			h.Typeflag = TypeDir
+		}
+		return h, nil
+	}
+
+	h.Uname = parseString(b[offUname : offUname+lenUname])
+	h.Gname = parseString(b[offGname : offGname+lenUname])
+
+	var err error
+	if h.Devmajor, err = parseNumeric(b[offDevmajor : offDevmajor+8]); err != nil {
+		return nil, err
+	}
+	if h.Devminor, err = parseNumeric(b[offDevminor : offDevminor+8]); err != nil {
+		return nil, err
+	}
+
+	if b.isGNU() {
+		atime, err := parseNumeric(b[offAtime : offAtime+12])
+		if err != nil {
+			return nil, err
+		}
+		ctime, err := parseNumeric(b[offCtime : offCtime+12])
+		if err != nil {
+			return nil, err
+		}
+		if atime != 0 {
+			h.AccessTime = time.Unix(atime, 0)
+		}
+		if ctime != 0 {
+			h.ChangeTime = time.Unix(ctime, 0)
+		}
+	} else if prefix := parseString(b[offPrefix : offPrefix+lenPrefix]); prefix != "" {
+		h.Name = prefix + "/" + h.Name
+	}
+
+	if h.Typeflag == TypeRegA && strings.HasSuffix(h.Name, "/") {
+		h.Typeflag = TypeDir
+	}
+
+	return h, nil
+}
+
+func applyPAXRecords(h *Header, records map[string]string) error {
+	for key, value := range records {
+		var err error
+		switch key {
+		case "path":
+			h.Name = value
+		case "linkpath":
+			h.Linkname = value
+		case "uname":
+			h.Uname = value
+		case "gname":
+			h.Gname = value
+		case "uid", "gid":
+			var id int64
+			id, err = strconv.ParseInt(value, 10, 64)
+			if key == "uid" {
+				h.Uid = int(id)
+			} else {
+				h.Gid = int(id)
+			}
+		case "size":
+			h.Size, err = strconv.ParseInt(value, 10, 64)
+		case "mtime":
+			h.ModTime, err = parsePAXTime(value)
+		case "atime":
+			h.AccessTime, err = parsePAXTime(value)
+		case "ctime":
+			h.ChangeTime, err = parsePAXTime(value)
+		default:
+			if strings.HasPrefix(key, "GNU.sparse.") {
+				return ErrUnsupported
+			}
+			if h.PAXRecords == nil {
+				h.PAXRecords = map[string]string{}
+			}
+			h.PAXRecords[key] = value
+		}
+
+		if err != nil {
+			return ErrHeader
+		}
+	}
+	return nil
+}
+
+func blockPadding(size int64) int64 {
+	return -size & (blockSize - 1)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type fileStat struct {
+	uid      int
+	gid      int
+	dev      uint64
+	ino      uint64
+	nlink    uint64
+	devmajor int64
+	devminor int64
+	atime    time.Time
+	ctime    time.Time
+}
+
+func statFile(info os.FileInfo) (fileStat, bool) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+
+	rdev := uint64(sys.Rdev)
+	return fileStat{
+		uid:      int(sys.Uid),
+		gid:      int(sys.Gid),
+		dev:      uint64(sys.Dev),
+		ino:      uint64(sys.Ino),
+		nlink:    uint64(sys.Nlink),
+		devmajor: int64((rdev>>8)&0xfff | (rdev>>32)&^0xfff),
+		devminor: int64(rdev&0xff | (rdev>>12)&^0xff),
+		atime:    time.Unix(sys.Atim.Unix()),
+		ctime:    time.Unix(sys.Ctim.Unix()),
+	}, true
+}
+
+// readXattrs returns the extended attributes of the file, it follows
+// symlinks so it must not be called for them
+func readXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		// not supported by the filesystem
+		return nil, nil
+	}
+
+	list := make([]byte, size)
+	size, err = syscall.Listxattr(path, list)
+	if err != nil {
+		return nil, nil
+	}
+
+	xattrs := map[string]string{}
+	for _, name := range strings.Split(strings.TrimRight(string(list[:size]), "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+
+		valueSize, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			continue
+		}
+
+		value := make([]byte, valueSize)
+		valueSize, err = syscall.Getxattr(path, name, value)
+		if err != nil {
+			continue
+		}
+		xattrs[name] = string(value[:valueSize])
+	}
+
+	return xattrs, nil
+}
+
+func makeFifo(path string) error {
+	return syscall.Mkfifo(path, 0600)
+}
+
+// makeDevice creates a device node, it only works when running as root
+func makeDevice(path string, h *Header) error {
+	mode := uint32(syscall.S_IFBLK)
+	if h.Typeflag == TypeChar {
+		mode = syscall.S_IFCHR
+	}
+
+	major, minor := uint64(h.Devmajor), uint64(h.Devminor)
+	dev := (minor & 0xff) | (major&0xfff)<<8 | (minor&^0xff)<<12 | (major&^0xfff)<<32
+	return syscall.Mknod(path, mode|0600, int(dev))
+}
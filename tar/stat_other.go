@@ -0,0 +1,38 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+type fileStat struct {
+	uid      int
+	gid      int
+	dev      uint64
+	ino      uint64
+	nlink    uint64
+	devmajor int64
+	devminor int64
+	atime    time.Time
+	ctime    time.Time
+}
+
+// statFile only knows the Linux stat layout, other systems archive files
+// without owners, links and device numbers
+func statFile(info os.FileInfo) (fileStat, bool) {
+	return fileStat{}, false
+}
+
+func readXattrs(path string) (map[string]string, error) {
+	return nil, nil
+}
+
+func makeFifo(path string) error {
+	return ErrUnsupported
+}
+
+func makeDevice(path string, h *Header) error {
+	return ErrUnsupported
+}
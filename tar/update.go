@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrCompressed  = errors.New("tar: cannot update compressed archives")
+	ErrUpdateStdio = errors.New("tar: options '-Aru' are incompatible with '-f -'")
+)
+
+// Append adds the files at the end of the archive, creating it when it
+// does not exist
+func (t *Tar) Append(args []string) error {
+	return t.appendFiles(args, nil, nil)
+}
+
+// Update adds the files that are not in the archive or that are newer than
+// their last copy in it
+func (t *Tar) Update(args []string) error {
+	latest := map[string]time.Time{}
+	scan := func(h *Header) {
+		if mtime, ok := latest[h.Name]; !ok || h.ModTime.After(mtime) {
+			latest[h.Name] = h.ModTime
+		}
+	}
+
+	skip := func(h *Header) bool {
+		mtime, ok := latest[h.Name]
+		// archives only keep seconds unless pax times are used
+		return ok && h.ModTime.Unix() <= mtime.Unix()
+	}
+
+	return t.appendFiles(args, scan, skip)
+}
+
+// appendFiles passes the members already in the archive to scan, then adds
+// the files skip returns false for
+func (t *Tar) appendFiles(args []string, scan func(*Header), skip func(*Header) bool) error {
+	file, tarWriter, err := t.openForUpdate(scan)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archiveInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	archiver, err := t.archiver(tarWriter, archiveInfo)
+	if err != nil {
+		return err
+	}
+	archiver.skip = skip
+
+	if err := archiver.addAll(args); err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Concatenate appends the members of the other archives, which may be
+// compressed, to the archive
+func (t *Tar) Concatenate(archives []string) error {
+	file, tarWriter, err := t.openForUpdate(nil)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, name := range archives {
+		if err := t.concatenateArchive(tarWriter, name); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (t *Tar) concatenateArchive(tarWriter *Writer, name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decompressor, err := newDecompressor(file, CompressionNone)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+
+	return copyMembers(tarWriter, NewReader(decompressor), nil)
+}
+
+// Delete rewrites the archive without the members matching the patterns
+func (t *Tar) Delete(patterns []string) error {
+	if len(patterns) == 0 {
+		return errors.New("no members to delete")
+	}
+	// the blocks written would not be compressed
+	if t.Compression != CompressionNone {
+		return ErrCompressed
+	}
+
+	file, err := os.Open(t.tarName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := checkUncompressed(file); err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the new archive is written next to the old one and renamed over it,
+	// so a failure leaves the original untouched
+	tmp, err := os.CreateTemp(filepath.Dir(t.tarName), ".tar-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	members := newMemberPatterns(patterns)
+	tarWriter := NewWriter(tmp)
+	if err := copyMembers(tarWriter, NewReader(file), func(h *Header) bool {
+		return members.match(h.Name)
+	}); err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), t.tarName); err != nil {
+		return err
+	}
+	return members.missing()
+}
+
+// openForUpdate opens the archive for writing, creating it if needed. It
+// passes the existing members to scan and returns a writer positioned over
+// the end-of-archive blocks
+func (t *Tar) openForUpdate(scan func(*Header)) (*os.File, *Writer, error) {
+	// stdin cannot be rewritten and "-" is not the name of a file
+	if t.tarName == "-" {
+		return nil, nil, ErrUpdateStdio
+	}
+	// the blocks written would not be compressed
+	if t.Compression != CompressionNone {
+		return nil, nil, ErrCompressed
+	}
+
+	file, err := os.OpenFile(t.tarName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	end, err := scanArchive(file, scan)
+	if err == nil {
+		err = file.Truncate(end)
+	}
+	if err == nil {
+		_, err = file.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	tarWriter := NewWriter(file)
+	// records are counted from the start of the archive
+	tarWriter.written = end
+	return file, tarWriter, nil
+}
+
+// scanArchive reads every member and returns the offset of the
+// end-of-archive blocks
+func scanArchive(file *os.File, scan func(*Header)) (int64, error) {
+	if err := checkUncompressed(file); err != nil {
+		return 0, err
+	}
+
+	tarReader := NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return tarReader.end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if scan != nil {
+			scan(header)
+		}
+	}
+}
+
+// checkUncompressed fails for compressed archives, which cannot be
+// modified in place, and rewinds the file
+func checkUncompressed(file *os.File) error {
+	if detectCompression(bufio.NewReader(file)) != CompressionNone {
+		return ErrCompressed
+	}
+
+	_, err := file.Seek(0, io.SeekStart)
+	return err
+}
+
+// copyMembers writes the members of tarReader to tarWriter, leaving out
+// the ones skip returns true for
+func copyMembers(tarWriter *Writer, tarReader *Reader, skip func(*Header) bool) error {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if skip != nil && skip(header) {
+			continue
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memberNames returns the names of the members of the archive
+func memberNames(t *testing.T, name string) []string {
+	t.Helper()
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	decompressor, err := newDecompressor(file, CompressionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	tr := NewReader(decompressor)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("Error reading %s: %v", name, err)
+		}
+		names = append(names, h.Name)
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func createArchive(t *testing.T, name string, compression Compression, files ...string) {
+	t.Helper()
+
+	tar, err := NewTar(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tar.Compression = compression
+	if err := tar.CreateTar(files); err != nil {
+		t.Fatalf("Error creating %s: %v", name, err)
+	}
+}
+
+func TestAppendAndUpdate(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	createArchive(t, "archive.tar", CompressionNone, "a.txt")
+
+	tar, _ := NewTar("archive.tar", true)
+	if err := tar.Append([]string{"b.txt"}); err != nil {
+		t.Fatalf("Error appending: %v", err)
+	}
+	if names := memberNames(t, "archive.tar"); !reflect.DeepEqual(names, []string{"a.txt", "b.txt"}) {
+		t.Errorf("unexpected members after append: %v", names)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes("a.txt", future, future); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"c.txt": "c"})
+
+	if err := tar.Update([]string{"a.txt", "b.txt", "c.txt"}); err != nil {
+		t.Fatalf("Error updating: %v", err)
+	}
+	if names := memberNames(t, "archive.tar"); !reflect.DeepEqual(names, []string{"a.txt", "b.txt", "a.txt", "c.txt"}) {
+		t.Errorf("unexpected members after update: %v", names)
+	}
+
+	info, err := os.Stat("archive.tar")
+	if err != nil || info.Size()%recordSize != 0 {
+		t.Errorf("expected the archive to end on a record boundary, got %v", info.Size())
+	}
+
+	if _, err := exec.LookPath("tar"); err == nil {
+		out, err := exec.Command("tar", "-tf", "archive.tar").CombinedOutput()
+		if err != nil || string(out) != "a.txt\nb.txt\na.txt\nc.txt\n" {
+			t.Errorf("tar rejects the archive: %v\n%s", err, out)
+		}
+	}
+
+	createArchive(t, "archive.tar.gz", CompressionGzip, "a.txt")
+	tar, _ = NewTar("archive.tar.gz", true)
+	if err := tar.Append([]string{"b.txt"}); !errors.Is(err, ErrCompressed) {
+		t.Errorf("expected ErrCompressed, got %v", err)
+	}
+}
+
+func TestUpdateCompressed(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	createArchive(t, "archive.tar", CompressionNone, "a.txt")
+	before, err := os.ReadFile("archive.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -rzf on an uncompressed archive would append uncompressed blocks
+	tar, _ := NewTar("archive.tar", true)
+	tar.Compression = CompressionGzip
+	if err := tar.Append([]string{"b.txt"}); !errors.Is(err, ErrCompressed) {
+		t.Errorf("append: expected ErrCompressed, got %v", err)
+	}
+	if err := tar.Update([]string{"b.txt"}); !errors.Is(err, ErrCompressed) {
+		t.Errorf("update: expected ErrCompressed, got %v", err)
+	}
+	if err := tar.Concatenate([]string{"archive.tar"}); !errors.Is(err, ErrCompressed) {
+		t.Errorf("concatenate: expected ErrCompressed, got %v", err)
+	}
+	if err := tar.Delete([]string{"a.txt"}); !errors.Is(err, ErrCompressed) {
+		t.Errorf("delete: expected ErrCompressed, got %v", err)
+	}
+
+	after, err := os.ReadFile("archive.tar")
+	if err != nil || !bytes.Equal(before, after) {
+		t.Errorf("expected the archive unchanged, %v", err)
+	}
+}
+
+func TestUpdateStdio(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{"a.txt": "a"})
+
+	tar, _ := NewTar("-", true)
+	if err := tar.Append([]string{"a.txt"}); !errors.Is(err, ErrUpdateStdio) {
+		t.Errorf("append: expected ErrUpdateStdio, got %v", err)
+	}
+	if err := tar.Update([]string{"a.txt"}); !errors.Is(err, ErrUpdateStdio) {
+		t.Errorf("update: expected ErrUpdateStdio, got %v", err)
+	}
+	if err := tar.Concatenate([]string{"a.txt"}); !errors.Is(err, ErrUpdateStdio) {
+		t.Errorf("concatenate: expected ErrUpdateStdio, got %v", err)
+	}
+
+	if _, err := os.Lstat("-"); err == nil {
+		t.Errorf("expected no file named -")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	chdir(t, t.TempDir())
+	if err := os.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"a.txt": "a", "b.txt": "b", "dir/c.txt": "c"})
+	createArchive(t, "archive.tar", CompressionNone, "a.txt", "b.txt", "dir")
+
+	tar, _ := NewTar("archive.tar", true)
+	if err := tar.Delete([]string{"b.txt", "dir"}); err != nil {
+		t.Fatalf("Error deleting: %v", err)
+	}
+	if names := memberNames(t, "archive.tar"); !reflect.DeepEqual(names, []string{"a.txt"}) {
+		t.Errorf("unexpected members after delete: %v", names)
+	}
+
+	if err := tar.Delete([]string{"missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestConcatenate(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"})
+	createArchive(t, "first.tar", CompressionNone, "a.txt")
+	createArchive(t, "second.tar", CompressionNone, "b.txt")
+	createArchive(t, "third.tar.gz", CompressionGzip, "c.txt")
+
+	tar, _ := NewTar("first.tar", true)
+	if err := tar.Concatenate([]string{"second.tar", "third.tar.gz"}); err != nil {
+		t.Fatalf("Error concatenating: %v", err)
+	}
+	if names := memberNames(t, "first.tar"); !reflect.DeepEqual(names, []string{"a.txt", "b.txt", "c.txt"}) {
+		t.Errorf("unexpected members after concatenate: %v", names)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{"same.txt": "same", "content.txt": "1234", "size.txt": "12", "gone.txt": "x"})
+	if err := os.Symlink("same.txt", "link"); err != nil {
+		t.Fatal(err)
+	}
+	createArchive(t, "archive.tar", CompressionNone, "same.txt", "content.txt", "size.txt", "gone.txt", "link")
+
+	// keep the mtime so only the content differs
+	info, err := os.Stat("content.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"content.txt": "4321", "size.txt": "123"})
+	if err := os.Chtimes("content.txt", info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes("size.txt", info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove("gone.txt")
+	os.Remove("link")
+	if err := os.Symlink("content.txt", "link"); err != nil {
+		t.Fatal(err)
+	}
+
+	tar, err := NewTar("archive.tar", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tar.Close()
+
+	var out bytes.Buffer
+	differ, err := tar.Compare("", &out)
+	if err != nil {
+		t.Fatalf("Error comparing: %v", err)
+	}
+
+	expected := []string{
+		"content.txt: Contents differ",
+		"size.txt: Size differs",
+		"gone.txt: Warning: Cannot stat: No such file or directory",
+		"link: Symlink differs",
+	}
+	if differ != len(expected) || out.String() != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("expected %d differences, got %d:\n%s", len(expected), differ, out.String())
+	}
+}
+
+func TestCompareInsecure(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []testMember
+	}{
+		{"parent", []testMember{{header: Header{Typeflag: TypeReg, Name: "../secret.txt"}, content: "x"}}},
+		{"absolute", []testMember{{header: Header{Typeflag: TypeReg, Name: "/etc/passwd"}, content: "x"}}},
+		{"hard link outside", []testMember{{header: Header{Typeflag: TypeLink, Name: "hard", Linkname: "../secret.txt"}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tar := writeArchive(t, test.members)
+			root := t.TempDir()
+			dir := filepath.Join(root, "a")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "hard"), []byte("x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			if _, err := tar.Compare(dir, &out); !errors.Is(err, ErrInsecurePath) {
+				t.Errorf("expected ErrInsecurePath, got %v", err)
+			}
+		})
+	}
+}
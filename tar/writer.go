@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// Writer writes ustar archives, using pax or GNU extensions for the values
+// that do not fit in a ustar header
+type Writer struct {
+	w         io.Writer
+	Format    Format
+	remaining int64 // bytes left to write in the current entry
+	padding   int64
+	written   int64
+	closed    bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteHeader finishes the current entry and writes the header of the next
+// one. Size bytes must be written for regular files
+func (tw *Writer) WriteHeader(h *Header) error {
+	if tw.closed {
+		return ErrWriteAfterEnd
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	b := &block{}
+	pax := map[string]string{}
+	for key, value := range h.PAXRecords {
+		pax[key] = value
+	}
+
+	isGNU := tw.Format == FormatGNU
+	if isGNU {
+		copy(b[offMagic:], magicGNU)
+		copy(b[offVersion:], versionGNU)
+	} else {
+		copy(b[offMagic:], magicUSTAR)
+		copy(b[offVersion:], versionUSTAR)
+	}
+
+	// names
+	if isGNU {
+		if len(h.Name) > lenName {
+			if err := tw.writeGNULong(TypeGNULongName, h.Name); err != nil {
+				return err
+			}
+		}
+		if len(h.Linkname) > lenName {
+			if err := tw.writeGNULong(TypeGNULongLink, h.Linkname); err != nil {
+				return err
+			}
+		}
+		formatString(b[offName:offName+lenName], truncate(h.Name, lenName))
+	} else {
+		prefix, name, ok := splitUSTARPath(h.Name)
+		if !ok {
+			pax["path"] = h.Name
+			name = truncate(h.Name, lenName)
+		}
+		formatString(b[offName:offName+lenName], name)
+		formatString(b[offPrefix:offPrefix+lenPrefix], prefix)
+
+		if len(h.Linkname) > lenName {
+			pax["linkpath"] = h.Linkname
+		}
+	}
+	formatString(b[offLinkname:offLinkname+lenName], truncate(h.Linkname, lenName))
+
+	if len(h.Uname) > lenUname {
+		pax["uname"] = h.Uname
+	}
+	if len(h.Gname) > lenUname {
+		pax["gname"] = h.Gname
+	}
+	formatString(b[offUname:offUname+lenUname], truncate(h.Uname, lenUname))
+	formatString(b[offGname:offGname+lenUname], truncate(h.Gname, lenUname))
+
+	// numbers, pax records are written as a fallback for readers that do
+	// not understand base-256
+	size := h.Size
+	if !h.hasData() {
+		size = 0
+	}
+
+	numbers := []struct {
+		key   string
+		field []byte
+		value int64
+	}{
+		{"", b[offMode : offMode+8], h.Mode},
+		{"uid", b[offUid : offUid+8], int64(h.Uid)},
+		{"gid", b[offGid : offGid+8], int64(h.Gid)},
+		{"size", b[offSize : offSize+12], size},
+		{"mtime", b[offMtime : offMtime+12], h.ModTime.Unix()},
+		{"", b[offDevmajor : offDevmajor+8], h.Devmajor},
+		{"", b[offDevminor : offDevminor+8], h.Devminor},
+	}
+
+	for _, n := range numbers {
+		if fitsOctal(n.value, len(n.field)) {
+			formatOctal(n.field, n.value)
+			continue
+		}
+
+		if !formatBase256(n.field, n.value) || (n.key == "" && !isGNU) {
+			return fmt.Errorf("%w: %d does not fit in the header", ErrFieldTooLong, n.value)
+		}
+
+		if !isGNU {
+			pax[n.key] = strconv.FormatInt(n.value, 10)
+		}
+	}
+
+	if !isGNU && h.ModTime.Nanosecond() != 0 {
+		pax["mtime"] = formatPAXTime(h.ModTime)
+	}
+
+	if isGNU {
+		if !h.AccessTime.IsZero() {
+			formatOctal(b[offAtime:offAtime+12], h.AccessTime.Unix())
+		}
+		if !h.ChangeTime.IsZero() {
+			formatOctal(b[offCtime:offCtime+12], h.ChangeTime.Unix())
+		}
+	} else {
+		if !h.AccessTime.IsZero() {
+			pax["atime"] = formatPAXTime(h.AccessTime)
+		}
+		if !h.ChangeTime.IsZero() {
+			pax["ctime"] = formatPAXTime(h.ChangeTime)
+		}
+	}
+
+	if len(pax) > 0 {
+		if isGNU {
+			return fmt.Errorf("%w: pax records need the pax format", ErrUnsupported)
+		}
+		if err := tw.writePAXHeader(h.Name, pax); err != nil {
+			return err
+		}
+	}
+
+	b[offTypeflag] = h.Typeflag
+	b.setChecksum()
+
+	if err := tw.writeBlock(b); err != nil {
+		return err
+	}
+
+	tw.remaining = size
+	tw.padding = blockPadding(size)
+	return nil
+}
+
+func (tw *Writer) writePAXHeader(name string, records map[string]string) error {
+	keys := []string{}
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := ""
+	for _, key := range keys {
+		data += formatPAXRecord(key, records[key])
+	}
+
+	dir, file := path.Split(path.Clean(name))
+	paxName := path.Join(dir, "PaxHeaders.0", file)
+
+	return tw.writeMetaEntry(TypeXHeader, paxName, data)
+}
+
+func (tw *Writer) writeGNULong(typeflag byte, name string) error {
+	return tw.writeMetaEntry(typeflag, "././@LongLink", name+"\x00")
+}
+
+// writeMetaEntry writes an entry that describes the next one
+func (tw *Writer) writeMetaEntry(typeflag byte, name, data string) error {
+	b := &block{}
+	if tw.Format == FormatGNU {
+		copy(b[offMagic:], magicGNU)
+		copy(b[offVersion:], versionGNU)
+	} else {
+		copy(b[offMagic:], magicUSTAR)
+		copy(b[offVersion:], versionUSTAR)
+	}
+
+	formatString(b[offName:offName+lenName], truncate(name, lenName))
+	formatOctal(b[offMode:offMode+8], 0644)
+	formatOctal(b[offUid:offUid+8], 0)
+	formatOctal(b[offGid:offGid+8], 0)
+	formatOctal(b[offSize:offSize+12], int64(len(data)))
+	formatOctal(b[offMtime:offMtime+12], 0)
+	b[offTypeflag] = typeflag
+	b.setChecksum()
+
+	if err := tw.writeBlock(b); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(tw.w, data); err != nil {
+		return err
+	}
+	tw.written += int64(len(data))
+
+	return tw.writePadding(blockPadding(int64(len(data))))
+}
+
+// Write writes the content of the current entry
+func (tw *Writer) Write(p []byte) (int, error) {
+	if tw.closed {
+		return 0, ErrWriteAfterEnd
+	}
+
+	tooLong := false
+	if int64(len(p)) > tw.remaining {
+		p = p[:tw.remaining]
+		tooLong = true
+	}
+
+	n, err := tw.w.Write(p)
+	tw.remaining -= int64(n)
+	tw.written += int64(n)
+	if err == nil && tooLong {
+		err = ErrWriteTooLong
+	}
+	return n, err
+}
+
+// Flush pads the current entry to a full block
+func (tw *Writer) Flush() error {
+	if tw.remaining > 0 {
+		return fmt.Errorf("%w: %d bytes left", ErrMissingData, tw.remaining)
+	}
+
+	err := tw.writePadding(tw.padding)
+	tw.padding = 0
+	return err
+}
+
+// Close writes the two zero blocks that end the archive and pads it to a
+// full record like GNU tar does
+func (tw *Writer) Close() error {
+	if tw.closed {
+		return nil
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	tw.closed = true
+
+	end := 2 * blockSize
+	if rest := (tw.written + int64(end)) % recordSize; rest != 0 {
+		end += int(recordSize - rest)
+	}
+	return tw.writePadding(int64(end))
+}
+
+func (tw *Writer) writeBlock(b *block) error {
+	_, err := tw.w.Write(b[:])
+	tw.written += blockSize
+	return err
+}
+
+func (tw *Writer) writePadding(n int64) error {
+	if n == 0 {
+		return nil
+	}
+
+	_, err := tw.w.Write(make([]byte, n))
+	tw.written += n
+	return err
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}